@@ -0,0 +1,293 @@
+// Package admin serves the local HTTP API used to control a running serve, and provides a client for it
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jslowik/commacloner/approval"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/log"
+	"github.com/jslowik/commacloner/monitor"
+	"github.com/jslowik/commacloner/pause"
+	"github.com/jslowik/commacloner/state"
+	"go.uber.org/zap"
+)
+
+// Routes served by the admin server
+const (
+	ApprovalsRoute = "/approvals"
+	ApproveRoute   = "/approvals/{id:[0-9]+}/approve"
+	RejectRoute    = "/approvals/{id:[0-9]+}/reject"
+	PauseRoute     = "/pause"
+	ResumeRoute    = "/resume"
+	// MappingPauseRoute and MappingResumeRoute pause and resume a single mapping
+	MappingPauseRoute  = "/mappings/{mapping}/pause"
+	MappingResumeRoute = "/mappings/{mapping}/resume"
+	// HealthRoute reports whether serve is alive, ReadyRoute whether it is receiving deals
+	HealthRoute    = "/healthz"
+	ReadyRoute     = "/readyz"
+	MappingsRoute  = "/mappings"
+	DecisionsRoute = "/decisions"
+	LogLevelRoute  = "/log/level"
+	MetricsRoute   = "/metrics"
+)
+
+// MaxMessageAge is how long serve may go without a message from the deals stream before it is no longer ready.
+// 3Commas pings every few seconds, so this is only reached if the connection has stalled.
+const MaxMessageAge = time.Minute
+
+// Approvals decides the deals waiting for approval, as websockets.DealsStream does
+type Approvals interface {
+	PendingApprovals() []state.Approval
+	Approve(id int) (state.Approval, error)
+	Reject(id int) (state.Approval, error)
+}
+
+// Pauses pauses and resumes mappings, as pause.Switch does.  An empty mapping means every mapping.
+type Pauses interface {
+	Status() pause.Status
+	Paused(mapping string) (bool, string)
+	Pause(mapping string) error
+	Resume(mapping string) error
+}
+
+// Monitor reports the state of the deals stream and what was decided for each deal, as monitor.Monitor does
+type Monitor interface {
+	Health() monitor.Health
+	Ready(maxAge time.Duration) (bool, string)
+	Mappings() []monitor.Mapping
+	Decisions(mapping string, limit int) []monitor.Decision
+}
+
+// Server is the admin HTTP API.  Every request must carry the token as a bearer token, unless the token is empty.
+// Without a token only requests a browser could not have been tricked into sending are served, see authenticate.
+// Routes are only served for the parts which are set.
+type Server struct {
+	Token     string
+	Approvals Approvals
+	Pauses    Pauses
+	Monitor   Monitor
+	// LogLevel is the level of the running logger, ie log.Level()
+	LogLevel *zap.AtomicLevel
+	// Metrics serves the Prometheus metrics, ie metrics.Metrics.Handler()
+	Metrics http.Handler
+}
+
+// HealthResponse is the body of the health and readiness routes
+type HealthResponse struct {
+	// Status is "ok", or "unavailable" if serve is not ready, with the reason why
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+	monitor.Health
+}
+
+// MappingStatus is a mapping as listed by the mappings route
+type MappingStatus struct {
+	monitor.Mapping
+	Paused      bool   `json:"paused"`
+	PauseReason string `json:"pause_reason,omitempty"`
+}
+
+// errorResponse is the body of every failed request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler routes the admin API
+func (s Server) Handler() http.Handler {
+	// mapping ids are matched escaped, so they may contain a slash
+	rtr := mux.NewRouter().UseEncodedPath()
+	if s.Approvals != nil {
+		rtr.HandleFunc(ApprovalsRoute, s.listApprovals).Methods(http.MethodGet)
+		rtr.HandleFunc(ApproveRoute, s.decide(s.Approvals.Approve)).Methods(http.MethodPost)
+		rtr.HandleFunc(RejectRoute, s.decide(s.Approvals.Reject)).Methods(http.MethodPost)
+	}
+	if s.Pauses != nil {
+		rtr.HandleFunc(PauseRoute, s.pauseStatus).Methods(http.MethodGet)
+		rtr.HandleFunc(PauseRoute, s.changePause(s.Pauses.Pause)).Methods(http.MethodPost)
+		rtr.HandleFunc(ResumeRoute, s.changePause(s.Pauses.Resume)).Methods(http.MethodPost)
+		rtr.HandleFunc(MappingPauseRoute, s.changePause(s.Pauses.Pause)).Methods(http.MethodPost)
+		rtr.HandleFunc(MappingResumeRoute, s.changePause(s.Pauses.Resume)).Methods(http.MethodPost)
+	}
+	if s.Monitor != nil {
+		rtr.HandleFunc(HealthRoute, s.health).Methods(http.MethodGet)
+		rtr.HandleFunc(ReadyRoute, s.ready).Methods(http.MethodGet)
+		rtr.HandleFunc(MappingsRoute, s.listMappings).Methods(http.MethodGet)
+		rtr.HandleFunc(DecisionsRoute, s.listDecisions).Methods(http.MethodGet)
+	}
+	if s.LogLevel != nil {
+		// zap serves the level as {"level":"info"}, changing it on PUT
+		rtr.Handle(LogLevelRoute, s.LogLevel).Methods(http.MethodGet, http.MethodPut)
+	}
+	if s.Metrics != nil {
+		rtr.Handle(MetricsRoute, s.Metrics).Methods(http.MethodGet)
+	}
+	rtr.Use(s.authenticate)
+	return rtr
+}
+
+// Start serves the admin API on addr in the background, returning once it is listening
+func (s Server) Start(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Handler: s.Handler()}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.NewLogger("admin").Errorf("admin server stopped: %v", err)
+		}
+	}()
+	return server, nil
+}
+
+// authenticate rejects requests which do not carry the token.  Without a token, the server only listens on localhost,
+// but any web page open in a browser on the same machine can still reach it: a form may post to it across origins,
+// and a page whose name is rebound to 127.0.0.1 may read from it.  Browsers mark both, so requests which carry an
+// Origin header, or name a host other than localhost, are refused.  Clients such as curl and the commacloner
+// commands send neither.
+func (s Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.Token == "" {
+			if r.Header.Get("Origin") != "" {
+				writeError(w, http.StatusForbidden, "requests from a browser are refused unless a token is configured")
+				return
+			}
+			if !localHost(r.Host) {
+				writeError(w, http.StatusForbidden, "requests for host "+strconv.Quote(r.Host)+" are refused unless a token is configured")
+				return
+			}
+		} else {
+			token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="commacloner"`)
+				writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// localHost reports whether the Host of a request names localhost or a loopback address
+func localHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	return config.IsLoopback(strings.Trim(host, "[]"))
+}
+
+func (s Server) listApprovals(w http.ResponseWriter, r *http.Request) {
+	pending := s.Approvals.PendingApprovals()
+	if pending == nil {
+		pending = []state.Approval{}
+	}
+	writeJSON(w, http.StatusOK, pending)
+}
+
+// decide handles approving or rejecting the approval named in the route
+func (s Server) decide(decision func(id int) (state.Approval, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(mux.Vars(r)["id"])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid approval id")
+			return
+		}
+		decided, err := decision(id)
+		switch err {
+		case nil:
+			writeJSON(w, http.StatusOK, decided)
+		case approval.ErrNotFound:
+			writeError(w, http.StatusNotFound, err.Error())
+		case approval.ErrDecided:
+			writeError(w, http.StatusConflict, err.Error()+" ("+string(decided.Status)+")")
+		case pause.ErrPaused:
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+	}
+}
+
+func (s Server) pauseStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.Pauses.Status())
+}
+
+// changePause handles pausing or resuming the mapping named in the route, or every mapping if there is none
+func (s Server) changePause(change func(mapping string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		mapping, err := url.PathUnescape(mux.Vars(r)["mapping"])
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid mapping id")
+			return
+		}
+		switch err := change(mapping); err {
+		case nil:
+			writeJSON(w, http.StatusOK, s.Pauses.Status())
+		case pause.ErrUnknownMapping:
+			writeError(w, http.StatusNotFound, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+	}
+}
+
+func (s Server) health(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, HealthResponse{Status: "ok", Health: s.Monitor.Health()})
+}
+
+// ready succeeds only while the deals stream is subscribed and messages are arriving
+func (s Server) ready(w http.ResponseWriter, r *http.Request) {
+	ready, reason := s.Monitor.Ready(MaxMessageAge)
+	if !ready {
+		writeJSON(w, http.StatusServiceUnavailable, HealthResponse{Status: "unavailable", Reason: reason, Health: s.Monitor.Health()})
+		return
+	}
+	writeJSON(w, http.StatusOK, HealthResponse{Status: "ok", Health: s.Monitor.Health()})
+}
+
+func (s Server) listMappings(w http.ResponseWriter, r *http.Request) {
+	mappings := s.Monitor.Mappings()
+	listed := make([]MappingStatus, 0, len(mappings))
+	for _, mapping := range mappings {
+		status := MappingStatus{Mapping: mapping}
+		if s.Pauses != nil {
+			status.Paused, status.PauseReason = s.Pauses.Paused(mapping.ID)
+		}
+		listed = append(listed, status)
+	}
+	writeJSON(w, http.StatusOK, listed)
+}
+
+// listDecisions lists the most recent decisions, filtered by the mapping and limit query parameters
+func (s Server) listDecisions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit "+strconv.Quote(value))
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, s.Monitor.Decisions(query.Get("mapping"), limit))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
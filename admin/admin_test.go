@@ -0,0 +1,276 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jslowik/commacloner/approval"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/monitor"
+	"github.com/jslowik/commacloner/pause"
+	"github.com/jslowik/commacloner/state"
+	"go.uber.org/zap"
+)
+
+// testApprovals holds approvals in memory, approving or rejecting them without starting anything
+type testApprovals map[int]state.Approval
+
+func (a testApprovals) PendingApprovals() []state.Approval {
+	var pending []state.Approval
+	for id := 1; id <= len(a); id++ {
+		if a[id].Status == state.ApprovalPending {
+			pending = append(pending, a[id])
+		}
+	}
+	return pending
+}
+
+func (a testApprovals) Approve(id int) (state.Approval, error) {
+	return a.decide(id, state.ApprovalApproved)
+}
+
+func (a testApprovals) Reject(id int) (state.Approval, error) {
+	return a.decide(id, state.ApprovalRejected)
+}
+
+func (a testApprovals) decide(id int, status state.ApprovalStatus) (state.Approval, error) {
+	item, ok := a[id]
+	if !ok {
+		return item, approval.ErrNotFound
+	}
+	if item.Status != state.ApprovalPending {
+		return item, approval.ErrDecided
+	}
+	item.Status = status
+	a[id] = item
+	return item, nil
+}
+
+func newTestApprovals() testApprovals {
+	return testApprovals{
+		1: {ID: 1, Mapping: "gated", SourceDealID: 100, Status: state.ApprovalPending},
+		2: {ID: 2, Mapping: "gated", SourceDealID: 101, Status: state.ApprovalPending},
+	}
+}
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(Server{Token: "t0k3n", Approvals: newTestApprovals()}.Handler())
+	defer server.Close()
+	client := Client{URL: server.URL, Token: "t0k3n"}
+
+	pending, err := client.Approvals()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("Approvals() = %+v, want 2", pending)
+	}
+	if approved, err := client.Approve(1); err != nil || approved.Status != state.ApprovalApproved {
+		t.Errorf("Approve() = %+v, %v, want approved", approved, err)
+	}
+	if rejected, err := client.Reject(2); err != nil || rejected.Status != state.ApprovalRejected {
+		t.Errorf("Reject() = %+v, %v, want rejected", rejected, err)
+	}
+	if pending, err := client.Approvals(); err != nil || len(pending) != 0 {
+		t.Errorf("Approvals() = %+v, %v, want none", pending, err)
+	}
+
+	errorTests := []struct {
+		name   string
+		client Client
+		decide func(Client) (state.Approval, error)
+		want   string
+	}{
+		{name: "decided", client: client, decide: func(c Client) (state.Approval, error) { return c.Approve(1) }, want: "409 Conflict"},
+		{name: "missing", client: client, decide: func(c Client) (state.Approval, error) { return c.Reject(9) }, want: "404 Not Found"},
+		{
+			name:   "bad token",
+			client: Client{URL: server.URL, Token: "wrong"},
+			decide: func(c Client) (state.Approval, error) { return c.Reject(1) },
+			want:   "401 Unauthorized",
+		},
+		{name: "no token", client: Client{URL: server.URL}, decide: func(c Client) (state.Approval, error) { return c.Reject(1) }, want: "401 Unauthorized"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.decide(tt.client); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want %s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_noToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		host   string
+		origin string
+		want   int
+	}{
+		{name: "loopback address", want: http.StatusOK},
+		{name: "localhost", host: "localhost:8421", want: http.StatusOK},
+		{name: "ipv6 loopback", host: "[::1]:8421", want: http.StatusOK},
+		{name: "browser", origin: "https://example.com", want: http.StatusForbidden},
+		{name: "rebound name", host: "attacker.example.com:8421", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(Server{Approvals: newTestApprovals()}.Handler())
+			defer server.Close()
+
+			req, err := http.NewRequest(http.MethodPost, server.URL+"/approvals/1/approve", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("POST with host %q and origin %q = %s, want %d", req.Host, tt.origin, resp.Status, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	tests := []struct {
+		name    string
+		admin   config.Admin
+		want    Client
+		wantErr bool
+	}{
+		{name: "localhost", admin: config.Admin{Listen: "127.0.0.1:8421", Token: "t"}, want: Client{URL: "http://127.0.0.1:8421", Token: "t"}},
+		{name: "every interface", admin: config.Admin{Listen: ":8421"}, want: Client{URL: "http://127.0.0.1:8421"}},
+		{name: "ipv6", admin: config.Admin{Listen: "[::1]:8421"}, want: Client{URL: "http://[::1]:8421"}},
+		{name: "not configured", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewClient(tt.admin)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewClient() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_pause(t *testing.T) {
+	pauses, err := pause.New(nil, "", []string{"a", "b/c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(Server{Pauses: pauses}.Handler())
+	defer server.Close()
+	client := Client{URL: server.URL}
+
+	if status, err := client.Pause("b/c"); err != nil || !reflect.DeepEqual(status.Mappings, []string{"b/c"}) {
+		t.Errorf("Pause() = %+v, %v, want b/c paused", status, err)
+	}
+	if status, err := client.Pause(""); err != nil || !status.All {
+		t.Errorf("Pause() of every mapping = %+v, %v, want all paused", status, err)
+	}
+	if status, err := client.Resume(""); err != nil || status.All || len(status.Mappings) != 0 {
+		t.Errorf("Resume() of every mapping = %+v, %v, want all resumed", status, err)
+	}
+	if _, err := client.Pause("missing"); err == nil || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Errorf("Pause() of an unknown mapping error = %v, want 404 Not Found", err)
+	}
+	if _, err := client.Approvals(); err == nil || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Errorf("Approvals() without approvals error = %v, want 404 Not Found", err)
+	}
+	if paused, _ := pauses.Paused("b/c"); paused {
+		t.Error("Paused(b/c) = true, want it resumed with every mapping")
+	}
+	if status, err := client.PauseStatus(); err != nil || !reflect.DeepEqual(status.Mappings, []string{}) {
+		t.Errorf("PauseStatus() = %+v, %v, want nothing paused", status, err)
+	}
+}
+
+func TestServer_monitor(t *testing.T) {
+	mappings := []config.BotMapping{
+		{ID: "live", Source: config.BotConfig{ID: 1}, Destination: config.BotConfig{ID: 2}},
+		{ID: "paused", Source: config.BotConfig{ID: 1}, Destination: config.BotConfig{ID: 3}},
+	}
+	mon := monitor.New(mappings, monitor.DefaultDecisions)
+	pauses, err := pause.New(nil, "", []string{"live", "paused"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pauses.Pause("paused"); err != nil {
+		t.Fatal(err)
+	}
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	server := httptest.NewServer(Server{Token: "t0k3n", Pauses: pauses, Monitor: mon, LogLevel: &level}.Handler())
+	defer server.Close()
+	client := Client{URL: server.URL, Token: "t0k3n"}
+
+	request := func(method, route, body string) int {
+		req, err := http.NewRequest(method, server.URL+route, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer t0k3n")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if health, err := client.Health(); err != nil || health.Status != "ok" || health.State != monitor.StateConnecting {
+		t.Errorf("Health() = %+v, %v, want ok while connecting", health, err)
+	}
+	if status := request(http.MethodGet, ReadyRoute, ""); status != http.StatusServiceUnavailable {
+		t.Errorf("GET %s before subscribing = %d, want %d", ReadyRoute, status, http.StatusServiceUnavailable)
+	}
+	mon.SetState(monitor.StateSubscribed)
+	mon.Message(true)
+	if status := request(http.MethodGet, ReadyRoute, ""); status != http.StatusOK {
+		t.Errorf("GET %s once subscribed = %d, want %d", ReadyRoute, status, http.StatusOK)
+	}
+
+	mon.Received("live")
+	mon.Decide(monitor.Decision{Mapping: "live", SourceDealID: 42, Outcome: monitor.OutcomeCloned})
+	mon.Decide(monitor.Decision{Mapping: "paused", SourceDealID: 42, Outcome: monitor.OutcomeSkipped, Reason: monitor.ReasonPaused})
+	listed, err := client.Mappings()
+	if err != nil || len(listed) != 2 {
+		t.Fatalf("Mappings() = %+v, %v, want both mappings", listed, err)
+	}
+	if listed[0].Counters.Received != 1 || listed[0].Counters.Cloned != 1 || listed[0].Paused {
+		t.Errorf("Mappings()[0] = %+v, want 1 deal received and cloned", listed[0])
+	}
+	if !listed[1].Paused || listed[1].Counters.Skipped != 1 {
+		t.Errorf("Mappings()[1] = %+v, want paused with 1 deal skipped", listed[1])
+	}
+	if decisions, err := client.Decisions("paused", 0); err != nil || len(decisions) != 1 || decisions[0].Outcome != monitor.OutcomeSkipped {
+		t.Errorf("Decisions(paused) = %+v, %v, want the skipped deal", decisions, err)
+	}
+	if decisions, err := client.Decisions("", 1); err != nil || len(decisions) != 1 || decisions[0].Mapping != "paused" {
+		t.Errorf("Decisions() limited to 1 = %+v, %v, want the latest decision", decisions, err)
+	}
+	if status := request(http.MethodGet, DecisionsRoute+"?limit=-1", ""); status != http.StatusBadRequest {
+		t.Errorf("GET %s with a negative limit = %d, want %d", DecisionsRoute, status, http.StatusBadRequest)
+	}
+
+	if status := request(http.MethodPut, LogLevelRoute, `{"level":"debug"}`); status != http.StatusOK || level.Level() != zap.DebugLevel {
+		t.Errorf("PUT %s = %d leaving %s, want %d and debug", LogLevelRoute, status, level.Level(), http.StatusOK)
+	}
+	if status := request(http.MethodPut, LogLevelRoute, `{"level":"loud"}`); status != http.StatusBadRequest {
+		t.Errorf("PUT %s of an unknown level = %d, want %d", LogLevelRoute, status, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,160 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/monitor"
+	"github.com/jslowik/commacloner/pause"
+	"github.com/jslowik/commacloner/state"
+)
+
+// clientTimeout bounds how long a request to the admin server may take
+const clientTimeout = 30 * time.Second
+
+// Client talks to the admin server of a running serve
+type Client struct {
+	// URL is the base URL of the admin server, ie http://127.0.0.1:8421
+	URL   string
+	Token string
+}
+
+// NewClient creates a client for the admin server the config describes.  A server listening on every interface is
+// reached through localhost.
+func NewClient(c config.Admin) (Client, error) {
+	if c.Listen == "" {
+		return Client{}, errors.New("no admin server is configured, set admin.listen")
+	}
+	host, port, err := net.SplitHostPort(c.Listen)
+	if err != nil {
+		return Client{}, fmt.Errorf("invalid admin listen address %q: %v", c.Listen, err)
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return Client{URL: "http://" + net.JoinHostPort(host, port), Token: c.Token}, nil
+}
+
+// Approvals lists the deals waiting for approval
+func (c Client) Approvals() ([]state.Approval, error) {
+	var approvals []state.Approval
+	err := c.do(http.MethodGet, ApprovalsRoute, &approvals)
+	return approvals, err
+}
+
+// Approve starts the destination deal of a pending approval
+func (c Client) Approve(id int) (state.Approval, error) {
+	var approved state.Approval
+	err := c.do(http.MethodPost, approvalRoute(ApproveRoute, id), &approved)
+	return approved, err
+}
+
+// Reject drops a pending approval
+func (c Client) Reject(id int) (state.Approval, error) {
+	var rejected state.Approval
+	err := c.do(http.MethodPost, approvalRoute(RejectRoute, id), &rejected)
+	return rejected, err
+}
+
+// PauseStatus returns what is paused
+func (c Client) PauseStatus() (pause.Status, error) {
+	var status pause.Status
+	err := c.do(http.MethodGet, PauseRoute, &status)
+	return status, err
+}
+
+// Pause pauses a mapping, or every mapping if mapping is empty, returning what is then paused
+func (c Client) Pause(mapping string) (pause.Status, error) {
+	var status pause.Status
+	err := c.do(http.MethodPost, mappingRoute(PauseRoute, MappingPauseRoute, mapping), &status)
+	return status, err
+}
+
+// Resume resumes a mapping, or every mapping if mapping is empty, returning what is then paused
+func (c Client) Resume(mapping string) (pause.Status, error) {
+	var status pause.Status
+	err := c.do(http.MethodPost, mappingRoute(ResumeRoute, MappingResumeRoute, mapping), &status)
+	return status, err
+}
+
+// Health returns the state of the deals stream
+func (c Client) Health() (HealthResponse, error) {
+	var health HealthResponse
+	err := c.do(http.MethodGet, HealthRoute, &health)
+	return health, err
+}
+
+// Mappings lists the mappings with their counters and whether they are paused
+func (c Client) Mappings() ([]MappingStatus, error) {
+	var mappings []MappingStatus
+	err := c.do(http.MethodGet, MappingsRoute, &mappings)
+	return mappings, err
+}
+
+// Decisions lists up to limit of the most recent decisions, of the mapping if one is given, newest first
+func (c Client) Decisions(mapping string, limit int) ([]monitor.Decision, error) {
+	query := url.Values{}
+	if mapping != "" {
+		query.Set("mapping", mapping)
+	}
+	if limit != 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	route := DecisionsRoute
+	if len(query) != 0 {
+		route += "?" + query.Encode()
+	}
+	var decisions []monitor.Decision
+	err := c.do(http.MethodGet, route, &decisions)
+	return decisions, err
+}
+
+// mappingRoute returns the route for a mapping, or the route for every mapping if mapping is empty
+func mappingRoute(all, single, mapping string) string {
+	if mapping == "" {
+		return all
+	}
+	return strings.Replace(single, "{mapping}", url.PathEscape(mapping), 1)
+}
+
+// approvalRoute fills in the approval id of a route
+func approvalRoute(route string, id int) string {
+	return strings.Replace(route, "{id:[0-9]+}", fmt.Sprint(id), 1)
+}
+
+// do sends a request to the admin server, decoding the response into out
+func (c Client) do(method, route string, out interface{}) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(c.URL, "/")+route, nil)
+	if err != nil {
+		return fmt.Errorf("could not create admin request: %v", err)
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := (&http.Client{Timeout: clientTimeout}).Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach the admin server, is serve running? %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+			return fmt.Errorf("admin server returned %s", resp.Status)
+		}
+		return fmt.Errorf("admin server returned %s: %s", resp.Status, body.Error)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("could not decode admin response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package api
+
+// manualStrategy is the start condition of bots whose deals are only started manually or through the API
+const manualStrategy = "manual"
+
+// Bot is a DCA bot as returned by the 3Commas REST API
+type Bot struct {
+	ID               int           `json:"id"`
+	Name             string        `json:"name"`
+	AccountID        int           `json:"account_id"`
+	AccountName      string        `json:"account_name"`
+	Pairs            []string      `json:"pairs"`
+	Strategy         string        `json:"strategy"`
+	IsEnabled        bool          `json:"is_enabled"`
+	ActiveDealsCount int           `json:"active_deals_count"`
+	StrategyList     []BotStrategy `json:"strategy_list"`
+}
+
+// BotStrategy is one of the start conditions of a bot
+type BotStrategy struct {
+	Strategy string `json:"strategy"`
+}
+
+// ManualStart reports whether the bot's start condition is "Manually/API", which destination bots need so they only
+// open the deals they are sent
+func (b Bot) ManualStart() bool {
+	for _, s := range b.StrategyList {
+		if s.Strategy == manualStrategy {
+			return true
+		}
+	}
+	return false
+}
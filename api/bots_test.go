@@ -0,0 +1,39 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBot_ManualStart(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want bool
+	}{
+		{
+			name: "manual start condition",
+			data: `{"id":1,"strategy_list":[{"options":{},"strategy":"manual"}]}`,
+			want: true,
+		},
+		{
+			name: "signal start condition",
+			data: `{"id":1,"strategy_list":[{"options":{"time":"5m"},"strategy":"rsi"}]}`,
+		},
+		{
+			name: "no start conditions",
+			data: `{"id":1}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bot Bot
+			if err := json.Unmarshal([]byte(tt.data), &bot); err != nil {
+				t.Fatal(err)
+			}
+			if got := bot.ManualStart(); got != tt.want {
+				t.Errorf("ManualStart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
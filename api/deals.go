@@ -0,0 +1,35 @@
+package api
+
+import "time"
+
+// Deal is a deal as returned by the 3Commas REST API.  Amounts are returned as strings to preserve their precision.
+type Deal struct {
+	ID                    int        `json:"id"`
+	BotID                 int        `json:"bot_id"`
+	BotName               string     `json:"bot_name"`
+	AccountName           string     `json:"account_name"`
+	Pair                  string     `json:"pair"`
+	Status                string     `json:"status"`
+	CreatedAt             time.Time  `json:"created_at"`
+	ClosedAt              *time.Time `json:"closed_at"`
+	BoughtVolume          string     `json:"bought_volume"`
+	FinalProfit           string     `json:"final_profit"`
+	FinalProfitPercentage string     `json:"final_profit_percentage"`
+}
+
+// closedStatuses are the statuses of deals which are closed, or being closed
+var closedStatuses = map[string]bool{
+	"completed":          true,
+	"cancelled":          true,
+	"cancel_pending":     true,
+	"panic_sold":         true,
+	"panic_sell_pending": true,
+	"stop_loss_finished": true,
+	"failed":             true,
+	"switched":           true,
+}
+
+// Active reports whether the deal is still open
+func (d Deal) Active() bool {
+	return d.ClosedAt == nil && !closedStatuses[d.Status]
+}
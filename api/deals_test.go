@@ -0,0 +1,27 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeal_Active(t *testing.T) {
+	closed := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		deal Deal
+		want bool
+	}{
+		{name: "bought", deal: Deal{Status: "bought"}, want: true},
+		{name: "completed", deal: Deal{Status: "completed"}},
+		{name: "panic selling", deal: Deal{Status: "panic_sell_pending"}},
+		{name: "closed at", deal: Deal{Status: "bought", ClosedAt: &closed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.deal.Active(); got != tt.want {
+				t.Errorf("Active() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -55,6 +55,10 @@ type DealDetails struct {
 	CompletedManualSafetyOrdersCount int    `json:"completed_manual_safety_orders_count"`
 	Pair                             string `json:"pair"`
 	Status                           string `json:"status"`
+	// Amounts are sent as strings to preserve their precision
+	BoughtVolume          string `json:"bought_volume"`
+	FinalProfit           string `json:"final_profit"`
+	FinalProfitPercentage string `json:"final_profit_percentage"`
 }
 
 type PingMessage struct {
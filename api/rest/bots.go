@@ -1,11 +1,14 @@
 package rest
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/jslowik/commacloner/log"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/jslowik/commacloner/api"
@@ -13,7 +16,12 @@ import (
 )
 
 const (
-	pairParameter = "pair"
+	pairParameter   = "pair"
+	limitParameter  = "limit"
+	offsetParameter = "offset"
+	botIDParameter  = "bot_id"
+	scopeParameter  = "scope"
+	fromParameter   = "from"
 	// skipSignalChecks    = "skip_signal_checks"
 	// skipOpenDealsChecks = "skip_open_deals_checks"
 	// botID               = "bot_id"
@@ -23,8 +31,66 @@ const (
 	StartNewBotDeal  = "/ver1/bots/%d/start_new_deal"
 	CancelBotDeal    = "/ver1/deals/%d/cancel"
 	PanicSellBotDeal = "/ver1/deals/%d/panic_sell"
+	DisableBotRoute  = "/ver1/bots/%d/disable"
+	ListBotsRoute    = "/ver1/bots"
+	ListDealsRoute   = "/ver1/deals"
+	ShowDealRoute    = "/ver1/deals/%d/show"
 )
 
+// listPageSize is the number of records requested per page, the most 3Commas allows
+const listPageSize = 100
+
+// DealError is returned when 3Commas refuses to start a new deal
+type DealError struct {
+	StatusCode int
+	Body       string
+	// Reason classifies the refusal, see config.UnavailablePolicy
+	Reason config.UnavailableReason
+}
+
+func (e *DealError) Error() string {
+	if e.StatusCode == http.StatusUnprocessableEntity {
+		return fmt.Sprintf("cannot create new deal: %s", e.Body)
+	}
+	return fmt.Sprintf("bad status %d - %s", e.StatusCode, e.Body)
+}
+
+// dealErrorReasons maps fragments of 3Commas error messages to the reason a deal was refused.  They are checked in
+// order as messages about deal limits and funds usually also mention the pair.
+var dealErrorReasons = []struct {
+	fragments []string
+	reason    config.UnavailableReason
+}{
+	{[]string{"max active deals", "max deals", "active deals limit", "deals limit"}, config.ReasonDealLimit},
+	{[]string{"insufficient funds", "not enough funds", "insufficient balance", "not enough balance"}, config.ReasonFunds},
+	{[]string{"pair"}, config.ReasonPairMissing},
+}
+
+// classifyDealError determines why 3Commas refused a deal from the body of its response
+func classifyDealError(statusCode int, body string) config.UnavailableReason {
+	if statusCode != http.StatusUnprocessableEntity {
+		return config.ReasonOther
+	}
+	body = strings.ToLower(body)
+	for _, r := range dealErrorReasons {
+		for _, fragment := range r.fragments {
+			if strings.Contains(body, fragment) {
+				return r.reason
+			}
+		}
+	}
+	return config.ReasonOther
+}
+
+// UnavailableReason returns why a deal could not be started from the error returned by StartNewDeal
+func UnavailableReason(err error) config.UnavailableReason {
+	var dealErr *DealError
+	if errors.As(err, &dealErr) {
+		return dealErr.Reason
+	}
+	return config.ReasonOther
+}
+
 func generateQuery(path string, queryParameters map[string]string) *url.URL {
 	u, _ := url.Parse(path)
 	q, _ := url.ParseQuery(u.RawQuery)
@@ -37,98 +103,91 @@ func generateQuery(path string, queryParameters map[string]string) *url.URL {
 	return u
 }
 
-// StartNewDeal invokes the API to start a new deal based on the bot mapping for the given pair
-func StartNewDeal(apiConfig config.API, bot config.BotMapping, pair string) error {
+// StartNewDeal invokes the API to start a new deal based on the bot mapping for the given pair, returning the deal
+// started and the call made.  The deal is empty if 3Commas did not describe it.
+func StartNewDeal(apiConfig config.API, bot config.BotMapping, pair string) (api.Deal, Call, error) {
 	logger := log.NewLogger("bots")
-	route := fmt.Sprintf(StartNewBotDeal, bot.Destination.ID)
-	path := apiConfig.RestURL + route
-
-	// override the pair if set
-	pairSplit := strings.Split(pair, "_")
-	if bot.Overrides.QuoteCurrency != "" {
-		pairSplit[0] = bot.Overrides.QuoteCurrency
-	}
-	if bot.Overrides.BaseCurrency != "" {
-		pairSplit[1] = bot.Overrides.BaseCurrency
-	}
-
-	params := make(map[string]string)
-	params[pairParameter] = fmt.Sprintf("%s_%s", pairSplit[0], pairSplit[1])
-
-	query := generateQuery(path, params)
+	request := StartNewDealRequest(bot, pair)
+	query := generateQuery(apiConfig.RestURL+request.Route, request.Params)
+	call := Call{Method: request.Method, URL: query.String()}
 
 	logger.Infof("generating new deal: %s", query.String())
 
 	// Generate Signature
 	sig := api.ComputeSignature(fmt.Sprintf("%s?%s", query.Path, query.RawQuery), apiConfig.Secret)
 
-	req, err := http.NewRequest("POST", query.String(), nil)
+	req, err := http.NewRequest(request.Method, query.String(), nil)
 	if err != nil {
-		return fmt.Errorf("could not generate new deal request: %v", err)
+		return api.Deal{}, call, fmt.Errorf("could not generate new deal request: %v", err)
 	}
 
 	req.Header.Set("APIKEY", apiConfig.Key)
 	req.Header.Set("Signature", sig)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := do(req, request.Route)
 	if err != nil {
-		return fmt.Errorf("could not send new deal request: %v", err)
+		return api.Deal{}, call, fmt.Errorf("could not send new deal request: %v", err)
 	}
 	defer resp.Body.Close()
+	call.Status = resp.StatusCode
 
 	responseBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return api.Deal{}, call, err
 	}
+	call.Body = summarize(responseBody)
 
 	switch resp.StatusCode {
 	case http.StatusOK:
 	case http.StatusCreated:
 		break
-	case 422:
-		return fmt.Errorf("cannot create new deal: %s", string(responseBody))
 	default:
-		return fmt.Errorf("bad status %d - %s", resp.StatusCode, string(responseBody))
+		return api.Deal{}, call, &DealError{
+			StatusCode: resp.StatusCode,
+			Body:       string(responseBody),
+			Reason:     classifyDealError(resp.StatusCode, string(responseBody)),
+		}
 	}
-	return nil
-}
-
-// CancelDeal cancels an existing deal
-func CancelDeal(apiConfig config.API, dealID int, panicSell bool) error {
-	logger := log.NewLogger("CancelDeal")
-	route := fmt.Sprintf(CancelBotDeal, dealID)
 
-	if panicSell {
-		route = fmt.Sprintf(PanicSellBotDeal, dealID)
+	var deal api.Deal
+	if err := json.Unmarshal(responseBody, &deal); err != nil {
+		logger.Warnf("could not parse new deal: %v", err)
 	}
+	return deal, call, nil
+}
 
-	path := apiConfig.RestURL + route
-
-	query := generateQuery(path, nil)
+// CancelDeal cancels an existing deal, returning the call made
+func CancelDeal(apiConfig config.API, dealID int, panicSell bool) (Call, error) {
+	logger := log.NewLogger("CancelDeal")
+	request := CancelDealRequest(dealID, panicSell)
+	query := generateQuery(apiConfig.RestURL+request.Route, request.Params)
+	call := Call{Method: request.Method, URL: query.String()}
 
 	logger.Infof("cancelling deal: %s", query.String())
 
 	// Generate Signature
 	sig := api.ComputeSignature(fmt.Sprintf("%s?%s", query.Path, query.RawQuery), apiConfig.Secret)
 
-	req, err := http.NewRequest("POST", query.String(), nil)
+	req, err := http.NewRequest(request.Method, query.String(), nil)
 	if err != nil {
-		return fmt.Errorf("could not generate new deal request: %v", err)
+		return call, fmt.Errorf("could not generate new deal request: %v", err)
 	}
 
 	req.Header.Set("APIKEY", apiConfig.Key)
 	req.Header.Set("Signature", sig)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := do(req, request.Route)
 	if err != nil {
-		return fmt.Errorf("could not send new deal request: %v", err)
+		return call, fmt.Errorf("could not send new deal request: %v", err)
 	}
 	defer resp.Body.Close()
+	call.Status = resp.StatusCode
 
 	responseBody, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return call, err
 	}
+	call.Body = summarize(responseBody)
 
 	switch resp.StatusCode {
 	case http.StatusCreated:
@@ -136,7 +195,77 @@ func CancelDeal(apiConfig config.API, dealID int, panicSell bool) error {
 	case http.StatusUnprocessableEntity:
 		logger.Warnf("cannot cancel deal: %s", string(responseBody))
 	default:
-		return fmt.Errorf("bad status %d - %s", resp.StatusCode, string(responseBody))
+		return call, fmt.Errorf("bad status %d - %s", resp.StatusCode, string(responseBody))
+	}
+	return call, nil
+}
+
+// DisableBot disables a bot so it starts no new deals, returning the call made.  Deals already open are left running.
+func DisableBot(apiConfig config.API, botID int) (Call, error) {
+	logger := log.NewLogger("DisableBot")
+	request := DisableBotRequest(botID)
+	call := Call{Method: request.Method, URL: request.URL(apiConfig)}
+
+	logger.Infof("disabling bot %d", botID)
+
+	status, body, err := signedRequest(apiConfig, request.Method, request.Route, request.Params)
+	call.Status, call.Body = status, summarize(body)
+	if err != nil {
+		return call, fmt.Errorf("could not disable bot: %v", err)
+	}
+
+	switch status {
+	case http.StatusOK, http.StatusCreated:
+	default:
+		return call, fmt.Errorf("bad status %d - %s", status, string(body))
+	}
+	return call, nil
+}
+
+// ListBots returns every bot on the account the API key belongs to
+func ListBots(apiConfig config.API) ([]api.Bot, error) {
+	var bots []api.Bot
+	for offset := 0; ; offset += listPageSize {
+		params := map[string]string{
+			limitParameter:  strconv.Itoa(listPageSize),
+			offsetParameter: strconv.Itoa(offset),
+		}
+		status, body, err := signedRequest(apiConfig, "GET", ListBotsRoute, params)
+		if err != nil {
+			return nil, fmt.Errorf("could not list bots: %v", err)
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("bad status %d - %s", status, string(body))
+		}
+
+		var page []api.Bot
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("could not parse bots: %v", err)
+		}
+		bots = append(bots, page...)
+		if len(page) < listPageSize {
+			return bots, nil
+		}
+	}
+}
+
+// WriteAccess reports whether the API key has the bots write permission, which starting and cancelling deals needs.
+// 3Commas has no endpoint describing a key's permissions, so this deliberately sends a real, mutating request with
+// the key: it cancels deal 0, which cannot exist.  A key without write access is refused outright, while a key with
+// it is told the deal cannot be found.  Any other answer proves nothing either way and is returned as an error.
+func WriteAccess(apiConfig config.API) (bool, error) {
+	status, body, err := signedRequest(apiConfig, "POST", fmt.Sprintf(CancelBotDeal, 0), nil)
+	if err != nil {
+		return false, fmt.Errorf("could not check write access: %v", err)
+	}
+
+	switch status {
+	case http.StatusNotFound:
+		return true, nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		logger := log.NewLogger("WriteAccess")
+		logger.Debugf("write access refused: %s", string(body))
+		return false, nil
 	}
-	return nil
+	return false, fmt.Errorf("could not check write access: unexpected status %d - %s", status, string(body))
 }
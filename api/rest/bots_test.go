@@ -1,11 +1,14 @@
 package rest
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
 
 	"github.com/gorilla/mux"
+	"github.com/jslowik/commacloner/api"
 	"github.com/jslowik/commacloner/config"
 )
 
@@ -13,6 +16,7 @@ const (
 	StartNewDealPath  = "/ver1/bots/{id:[a-zA-Z0-9]+}/start_new_deal"
 	CancelDealPath    = "/ver1/deals/{id:[a-zA-Z0-9]+}/cancel"
 	PanicSellDealPath = "/ver1/deals/{id:[a-zA-Z0-9]+}/panic_sell"
+	DisableBotPath    = "/ver1/bots/{id:[a-zA-Z0-9]+}/disable"
 )
 
 // newTest3CServer mocks the 3Commas API Server.  pass in a func to set a custom request handler
@@ -151,7 +155,7 @@ func TestStartNewDeal(t *testing.T) {
 			test3CServer, _ := newTest3CServer(tt.handler.handlerPath, tt.handler.handler)
 			tt.apiConfig.RestURL = test3CServer.URL
 
-			if err := StartNewDeal(tt.apiConfig, tt.bot, tt.pair); (err != nil) != tt.wantErr {
+			if _, _, err := StartNewDeal(tt.apiConfig, tt.bot, tt.pair); (err != nil) != tt.wantErr {
 				t.Errorf("StartNewDeal() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -233,9 +237,174 @@ func TestCancelDeal(t *testing.T) {
 			test3CServer, _ := newTest3CServer(tt.handler.handlerPath, tt.handler.handler)
 			tt.apiConfig.RestURL = test3CServer.URL
 
-			if err := CancelDeal(tt.apiConfig, 1234, tt.panicSell); (err != nil) != tt.wantErr {
+			if _, err := CancelDeal(tt.apiConfig, 1234, tt.panicSell); (err != nil) != tt.wantErr {
 				t.Errorf("StartNewDeal() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestUnavailableReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   config.UnavailableReason
+	}{
+		{
+			name:   "pair missing",
+			status: http.StatusUnprocessableEntity,
+			body:   `{"error":"record_invalid","error_attributes":{"pair":["No market data for this pair: USDT_XYZ"]}}`,
+			want:   config.ReasonPairMissing,
+		},
+		{
+			name:   "deal limit",
+			status: http.StatusUnprocessableEntity,
+			body:   `{"error":"record_invalid","error_description":"Max active deals reached for pair BTC_USDT"}`,
+			want:   config.ReasonDealLimit,
+		},
+		{
+			name:   "funds",
+			status: http.StatusUnprocessableEntity,
+			body:   `{"error":"record_invalid","error_description":"Insufficient funds to open a deal on USDT_BTC"}`,
+			want:   config.ReasonFunds,
+		},
+		{
+			name:   "unrecognised refusal",
+			status: http.StatusUnprocessableEntity,
+			body:   `{"error":"record_invalid"}`,
+			want:   config.ReasonOther,
+		},
+		{
+			name:   "server error",
+			status: http.StatusInternalServerError,
+			body:   "pair",
+			want:   config.ReasonOther,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			test3CServer, _ := newTest3CServer(StartNewDealPath, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+			apiConfig := config.API{RestURL: test3CServer.URL}
+			bot := config.BotMapping{Destination: config.BotConfig{ID: 2}}
+
+			_, _, err := StartNewDeal(apiConfig, bot, "BTC_USDT")
+			if got := UnavailableReason(err); got != tt.want {
+				t.Errorf("UnavailableReason(%v) = %v, want %v", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisableBot(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{name: "disabled", status: http.StatusOK},
+		{name: "refused", status: http.StatusUnprocessableEntity, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			test3CServer, _ := newTest3CServer(DisableBotPath, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			})
+			apiConfig := config.API{RestURL: test3CServer.URL}
+
+			if _, err := DisableBot(apiConfig, 1234); (err != nil) != tt.wantErr {
+				t.Errorf("DisableBot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestListBots(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   int
+		status  int
+		wantErr bool
+	}{
+		{name: "single page", total: 3, status: http.StatusOK},
+		{name: "several pages", total: 2*listPageSize + 1, status: http.StatusOK},
+		{name: "exact page", total: listPageSize, status: http.StatusOK},
+		{name: "bad credentials", status: http.StatusUnauthorized, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rtr := mux.NewRouter()
+			rtr.HandleFunc(ListBotsRoute, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != "GET" || r.Header.Get("Signature") == "" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				if tt.status != http.StatusOK {
+					w.WriteHeader(tt.status)
+					return
+				}
+				offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+				limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+				page := []api.Bot{}
+				for id := offset; id < tt.total && id < offset+limit; id++ {
+					page = append(page, api.Bot{ID: id})
+				}
+				json.NewEncoder(w).Encode(page)
+			})
+			test3CServer := httptest.NewServer(rtr)
+			defer test3CServer.Close()
+
+			bots, err := ListBots(config.API{Key: "abcd1234", Secret: "zyxw9876", RestURL: test3CServer.URL})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListBots() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(bots) != tt.total {
+				t.Fatalf("ListBots() returned %d bots, want %d", len(bots), tt.total)
+			}
+			for i, bot := range bots {
+				if bot.ID != i {
+					t.Fatalf("ListBots()[%d].ID = %d, want %d", i, bot.ID, i)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteAccess(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		want    bool
+		wantErr bool
+	}{
+		{name: "deal not found", status: http.StatusNotFound, want: true},
+		{name: "cannot cancel", status: http.StatusUnprocessableEntity, wantErr: true},
+		{name: "unauthorized", status: http.StatusUnauthorized, want: false},
+		{name: "forbidden", status: http.StatusForbidden, want: false},
+		{name: "server error", status: http.StatusInternalServerError, wantErr: true},
+		{name: "cancelled", status: http.StatusCreated, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			test3CServer, _ := newTest3CServer(CancelDealPath, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != "POST" || mux.Vars(r)["id"] != "0" {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				w.WriteHeader(tt.status)
+			})
+			defer test3CServer.Close()
+
+			got, err := WriteAccess(config.API{Key: "abcd1234", Secret: "zyxw9876", RestURL: test3CServer.URL})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WriteAccess() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("WriteAccess() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
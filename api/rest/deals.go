@@ -0,0 +1,95 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/config"
+)
+
+// DealScopes are the deal statuses ListDeals can filter on
+var DealScopes = []string{"active", "finished", "completed", "cancelled", "failed"}
+
+// DealFilter narrows the deals returned by ListDeals.  Zero fields do not filter.
+type DealFilter struct {
+	BotID int
+	// Scope is one of DealScopes
+	Scope string
+	// From and To bound when the deal was created
+	From time.Time
+	To   time.Time
+	// Limit caps the number of deals returned
+	Limit int
+}
+
+func (f DealFilter) match(deal api.Deal) bool {
+	return (f.From.IsZero() || !deal.CreatedAt.Before(f.From)) && (f.To.IsZero() || deal.CreatedAt.Before(f.To))
+}
+
+// ListDeals returns the deals on the account matching the filter, most recent first
+func ListDeals(apiConfig config.API, filter DealFilter) ([]api.Deal, error) {
+	params := map[string]string{limitParameter: strconv.Itoa(listPageSize)}
+	if filter.BotID != 0 {
+		params[botIDParameter] = strconv.Itoa(filter.BotID)
+	}
+	if filter.Scope != "" {
+		params[scopeParameter] = filter.Scope
+	}
+	if !filter.From.IsZero() {
+		params[fromParameter] = filter.From.UTC().Format(time.RFC3339)
+	}
+
+	var deals []api.Deal
+	for offset := 0; ; offset += listPageSize {
+		params[offsetParameter] = strconv.Itoa(offset)
+		status, body, err := signedRequest(apiConfig, "GET", ListDealsRoute, params)
+		if err != nil {
+			return nil, fmt.Errorf("could not list deals: %v", err)
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("bad status %d - %s", status, string(body))
+		}
+
+		var page []api.Deal
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("could not parse deals: %v", err)
+		}
+		for _, deal := range page {
+			if !filter.match(deal) {
+				continue
+			}
+			deals = append(deals, deal)
+			if filter.Limit != 0 && len(deals) == filter.Limit {
+				return deals, nil
+			}
+		}
+		if len(page) < listPageSize {
+			return deals, nil
+		}
+	}
+}
+
+// GetDeal returns a single deal along with the full JSON 3Commas describes it with
+func GetDeal(apiConfig config.API, dealID int) (api.Deal, json.RawMessage, error) {
+	status, body, err := signedRequest(apiConfig, "GET", fmt.Sprintf(ShowDealRoute, dealID), nil)
+	if err != nil {
+		return api.Deal{}, nil, fmt.Errorf("could not get deal: %v", err)
+	}
+	switch status {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return api.Deal{}, nil, fmt.Errorf("deal %d not found", dealID)
+	default:
+		return api.Deal{}, nil, fmt.Errorf("bad status %d - %s", status, string(body))
+	}
+
+	var deal api.Deal
+	if err := json.Unmarshal(body, &deal); err != nil {
+		return api.Deal{}, nil, fmt.Errorf("could not parse deal: %v", err)
+	}
+	return deal, body, nil
+}
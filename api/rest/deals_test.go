@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/config"
+)
+
+const ShowDealPath = "/ver1/deals/{id:[0-9]+}/show"
+
+// newTestDealsServer serves total deals, one per hour counting back from start, filtered by bot_id and scope
+func newTestDealsServer(total int, start time.Time) *httptest.Server {
+	deals := make([]api.Deal, 0, total)
+	for i := 0; i < total; i++ {
+		deals = append(deals, api.Deal{ID: i + 1, BotID: 1 + i%2, Status: "completed", CreatedAt: start.Add(-time.Duration(i) * time.Hour)})
+	}
+
+	rtr := mux.NewRouter()
+	rtr.HandleFunc(ListDealsRoute, func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		offset, _ := strconv.Atoi(q.Get("offset"))
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		var matched []api.Deal
+		for _, deal := range deals {
+			if q.Get("bot_id") != "" && q.Get("bot_id") != strconv.Itoa(deal.BotID) {
+				continue
+			}
+			if q.Get("scope") != "" && q.Get("scope") != deal.Status {
+				continue
+			}
+			matched = append(matched, deal)
+		}
+		page := []api.Deal{}
+		for i := offset; i < len(matched) && i < offset+limit; i++ {
+			page = append(page, matched[i])
+		}
+		json.NewEncoder(w).Encode(page)
+	})
+	rtr.HandleFunc(ShowDealPath, func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(mux.Vars(r)["id"])
+		if id < 1 || id > total {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, `{"id":%d,"bot_id":%d,"pair":"USDT_BTC","base_order_volume":"10.0"}`, id, deals[id-1].BotID)
+	})
+	return httptest.NewServer(rtr)
+}
+
+func TestListDeals(t *testing.T) {
+	start := time.Date(2022, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		filter  DealFilter
+		wantIDs []int
+	}{
+		{name: "bot", filter: DealFilter{BotID: 2, Limit: 3}, wantIDs: []int{2, 4, 6}},
+		{name: "scope", filter: DealFilter{Scope: "active"}},
+		{name: "time range", filter: DealFilter{From: start.Add(-3 * time.Hour), To: start.Add(-time.Hour)}, wantIDs: []int{3, 4}},
+		{name: "across pages", filter: DealFilter{BotID: 1, From: start.Add(-time.Duration(2*listPageSize+1) * time.Hour)}, wantIDs: nil},
+	}
+	// deals 1, 3, ... 201 on bot 1 were created within the range of the last test
+	for id := 1; id <= 2*listPageSize+1; id += 2 {
+		tests[3].wantIDs = append(tests[3].wantIDs, id)
+	}
+
+	test3CServer := newTestDealsServer(3*listPageSize, start)
+	defer test3CServer.Close()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deals, err := ListDeals(config.API{RestURL: test3CServer.URL}, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int
+			for _, deal := range deals {
+				ids = append(ids, deal.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.wantIDs) {
+				t.Errorf("ListDeals() = %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestGetDeal(t *testing.T) {
+	test3CServer := newTestDealsServer(3, time.Now())
+	defer test3CServer.Close()
+	apiConfig := config.API{RestURL: test3CServer.URL}
+
+	deal, raw, err := GetDeal(apiConfig, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deal.ID != 2 || deal.Pair != "USDT_BTC" || string(raw) != `{"id":2,"bot_id":2,"pair":"USDT_BTC","base_order_volume":"10.0"}` {
+		t.Errorf("GetDeal() = %+v, %s", deal, raw)
+	}
+
+	if _, _, err := GetDeal(apiConfig, 4); err == nil {
+		t.Errorf("GetDeal() of a missing deal did not fail")
+	}
+}
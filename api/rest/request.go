@@ -0,0 +1,138 @@
+package rest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/config"
+)
+
+// Request is a call to the 3Commas REST API, less the credentials needed to sign it
+type Request struct {
+	Method string
+	Route  string
+	Params map[string]string
+}
+
+// URL returns the full URL the request is sent to
+func (r Request) URL(apiConfig config.API) string {
+	return generateQuery(apiConfig.RestURL+r.Route, r.Params).String()
+}
+
+// Call is a call made to the 3Commas API and a summary of its response, as kept in the audit log.  The URL carries no
+// credentials, which are sent as headers.
+type Call struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	// Status is the status code of the response, 0 if none was received
+	Status int `json:"status"`
+	// Body is the start of the response body
+	Body string `json:"body,omitempty"`
+}
+
+// maxSummary is the most of a response body kept in a Call
+const maxSummary = 512
+
+// summarize returns the start of a response body, on a single line
+func summarize(body []byte) string {
+	summary := strings.Join(strings.Fields(string(body)), " ")
+	if len(summary) > maxSummary {
+		summary = summary[:maxSummary] + "..."
+	}
+	return summary
+}
+
+// StartNewDealRequest is the request StartNewDeal sends to start a deal on the mapping's destination bot, with the
+// mapping's overrides applied to the pair
+func StartNewDealRequest(bot config.BotMapping, pair string) Request {
+	return Request{
+		Method: "POST",
+		Route:  fmt.Sprintf(StartNewBotDeal, bot.Destination.ID),
+		Params: map[string]string{pairParameter: bot.Overrides.Pair(pair)},
+	}
+}
+
+// CancelDealRequest is the request CancelDeal sends to cancel or panic sell a deal
+func CancelDealRequest(dealID int, panicSell bool) Request {
+	route := fmt.Sprintf(CancelBotDeal, dealID)
+	if panicSell {
+		route = fmt.Sprintf(PanicSellBotDeal, dealID)
+	}
+	return Request{Method: "POST", Route: route}
+}
+
+// DisableBotRequest is the request DisableBot sends to disable a bot
+func DisableBotRequest(botID int) Request {
+	return Request{Method: "POST", Route: fmt.Sprintf(DisableBotRoute, botID)}
+}
+
+// signedRequest sends a request to the 3Commas REST API signed with the API key and secret, returning the status code
+// and body of the response
+func signedRequest(apiConfig config.API, method, route string, params map[string]string) (int, []byte, error) {
+	query := generateQuery(apiConfig.RestURL+route, params)
+
+	// Generate Signature
+	sig := api.ComputeSignature(fmt.Sprintf("%s?%s", query.Path, query.RawQuery), apiConfig.Secret)
+
+	req, err := http.NewRequest(method, query.String(), nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not generate request: %v", err)
+	}
+
+	req.Header.Set("APIKEY", apiConfig.Key)
+	req.Header.Set("Signature", sig)
+
+	resp, err := do(req, route)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+	return resp.StatusCode, responseBody, nil
+}
+
+// Observer is told how long each call to the 3Commas API took.  endpoint is the route called with ids replaced by {id},
+// and status is 0 if no response was received.
+type Observer func(method, endpoint string, status int, duration time.Duration)
+
+// observer is told about every call, if set
+var observer Observer
+
+// SetObserver sets the observer told about every call to the 3Commas API, nil for none.  It must be set before any
+// calls are made.
+func SetObserver(o Observer) {
+	observer = o
+}
+
+// do sends a request to route, telling the observer how long it took
+func do(req *http.Request, route string) (*http.Response, error) {
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if observer != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		observer(req.Method, Endpoint(route), status, time.Since(start))
+	}
+	return resp, err
+}
+
+// Endpoint returns a route with the ids in it replaced by {id}, ie /ver1/deals/{id}/cancel
+func Endpoint(route string) string {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if segment != "" && strings.Trim(segment, "0123456789") == "" {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jslowik/commacloner/config"
+)
+
+func TestRequest_URL(t *testing.T) {
+	apiConfig := config.API{RestURL: "https://api.3commas.io/public/api"}
+	tests := []struct {
+		name    string
+		request Request
+		want    string
+	}{
+		{
+			name:    "start new deal",
+			request: StartNewDealRequest(config.BotMapping{Destination: config.BotConfig{ID: 5678}}, "USDT_BTC"),
+			want:    "https://api.3commas.io/public/api/ver1/bots/5678/start_new_deal?pair=USDT_BTC",
+		},
+		{
+			name: "start new deal with overrides",
+			request: StartNewDealRequest(config.BotMapping{
+				Destination: config.BotConfig{ID: 5678},
+				Overrides:   config.BotOverrides{QuoteCurrency: "USD"},
+			}, "USDT_BTC"),
+			want: "https://api.3commas.io/public/api/ver1/bots/5678/start_new_deal?pair=USD_BTC",
+		},
+		{name: "cancel", request: CancelDealRequest(42, false), want: "https://api.3commas.io/public/api/ver1/deals/42/cancel"},
+		{name: "panic sell", request: CancelDealRequest(42, true), want: "https://api.3commas.io/public/api/ver1/deals/42/panic_sell"},
+		{name: "disable bot", request: DisableBotRequest(1234), want: "https://api.3commas.io/public/api/ver1/bots/1234/disable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.request.URL(apiConfig); got != tt.want {
+				t.Errorf("URL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	tests := []struct {
+		route string
+		want  string
+	}{
+		{route: "/ver1/bots/5678/start_new_deal", want: "/ver1/bots/{id}/start_new_deal"},
+		{route: "/ver1/deals/42/panic_sell", want: "/ver1/deals/{id}/panic_sell"},
+		{route: "/ver1/bots", want: "/ver1/bots"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			if got := Endpoint(tt.route); got != tt.want {
+				t.Errorf("Endpoint() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_summarize(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "empty", body: "", want: ""},
+		{name: "one line", body: "{\n  \"error\": \"record_invalid\"\n}\n", want: `{ "error": "record_invalid" }`},
+		{name: "truncated", body: strings.Repeat("a", maxSummary+10), want: strings.Repeat("a", maxSummary) + "..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarize([]byte(tt.body)); got != tt.want {
+				t.Errorf("summarize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetObserver(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	var observed []string
+	SetObserver(func(method, endpoint string, status int, duration time.Duration) {
+		observed = append(observed, fmt.Sprintf("%s %s %d", method, endpoint, status))
+	})
+	defer SetObserver(nil)
+
+	if _, err := CancelDeal(config.API{RestURL: server.URL}, 42, true); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"POST /ver1/deals/{id}/panic_sell 201"}; !reflect.DeepEqual(observed, want) {
+		t.Errorf("observed %v, want %v", observed, want)
+	}
+}
@@ -0,0 +1,208 @@
+package websockets
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/api/rest"
+	"github.com/jslowik/commacloner/approval"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/log"
+	"github.com/jslowik/commacloner/monitor"
+	"github.com/jslowik/commacloner/pause"
+	"github.com/jslowik/commacloner/state"
+	"go.uber.org/zap"
+)
+
+// errNoApprovals is returned when deciding an approval without an approval queue
+var errNoApprovals = errors.New("there is no approval queue")
+
+// queue holds a new source deal of a mapping which requires approval until it is decided
+func (d DealsStream) queue(logger *zap.SugaredLogger, bot config.BotMapping, source api.DealDetails) {
+	if d.Approvals == nil {
+		logger.Warnf("mapping %s requires approval but there is no approval queue, not starting deal %d", bot.ID, source.ID)
+		d.decide(bot, source, monitor.Decision{Outcome: monitor.OutcomeSkipped, Reason: monitor.ReasonNoApproval})
+		return
+	}
+	queued, err := d.Approvals.Add(bot, source)
+	if err == approval.ErrQueued {
+		logger.Debugf("deal %d of mapping %s is already approval %d (%s)", source.ID, bot.ID, queued.ID, queued.Status)
+		return
+	}
+	if err != nil {
+		logger.Errorf("could not queue deal %d of mapping %s for approval: %v", source.ID, bot.ID, err)
+		d.decide(bot, source, monitor.Decision{Outcome: monitor.OutcomeFailed, Error: err.Error()})
+		return
+	}
+	d.decide(bot, source, monitor.Decision{Outcome: monitor.OutcomeQueued, Reason: approvalReason(queued.ID)})
+	logger.Infof("deal %d of mapping %s on %s is awaiting approval %d, which expires at %s",
+		source.ID, bot.ID, queued.DestPair, queued.ID, queued.Expires.Local().Format(time.RFC3339))
+}
+
+// PendingApprovals returns the deals waiting for approval, ordered by id
+func (d DealsStream) PendingApprovals() []state.Approval {
+	if d.Approvals == nil {
+		return nil
+	}
+	return d.Approvals.Pending()
+}
+
+// Approve starts the destination deal of a pending approval.  Should the deal not start, the mapping's on_unavailable
+// policy is applied and the reason recorded on the returned approval; the error is only set if the approval could not
+// be decided.  Deals of paused mappings cannot be approved until the mapping is resumed, and a source deal which has
+// closed in the meantime is not cloned.
+func (d DealsStream) Approve(id int) (state.Approval, error) {
+	if d.Approvals == nil {
+		return state.Approval{}, errNoApprovals
+	}
+	logger := log.NewLogger("deals")
+
+	pending, err := d.Approvals.Get(id)
+	if err != nil {
+		return pending, err
+	}
+	bot, ok := d.mapping(pending.SourceBotID, pending.Mapping)
+	if !ok {
+		return pending, fmt.Errorf("mapping %s of approval %d is no longer configured", pending.Mapping, id)
+	}
+	if pending.Status != state.ApprovalPending {
+		return pending, approval.ErrDecided
+	}
+	if d.Pauses != nil {
+		if paused, reason := d.Pauses.Paused(bot.ID); paused {
+			logger.Warnf("not approving approval %d: %s", id, reason)
+			return pending, pause.ErrPaused
+		}
+	}
+	current, _, err := rest.GetDeal(d.APIConfig, pending.SourceDealID)
+	if err != nil {
+		return pending, fmt.Errorf("could not check deal %d: %v", pending.SourceDealID, err)
+	}
+	decided, err := d.Approvals.Decide(id, state.ApprovalApproved)
+	if err != nil {
+		return decided, err
+	}
+
+	source := api.DealDetails{ID: decided.SourceDealID, BotID: decided.SourceBotID, Pair: decided.Pair}
+	if !current.Active() {
+		logger.Warnf("approval %d approved but deal %d is already %s, not starting a deal", id, source.ID, current.Status)
+		decided.Error = fmt.Sprintf("deal %d is already %s", source.ID, current.Status)
+		d.decide(bot, source, monitor.Decision{
+			Outcome: monitor.OutcomeSkipped,
+			Reason:  monitor.ReasonAlreadyClosed,
+			Error:   approvalReason(id) + ": " + decided.Error,
+		})
+		if err := d.Approvals.Update(decided); err != nil {
+			logger.Warnf("could not record the outcome of approval %d: %v", id, err)
+		}
+		return decided, nil
+	}
+	if bot.DryRun {
+		d.shadow(logger, bot, source, rest.StartNewDealRequest(bot, source.Pair))
+		return decided, nil
+	}
+	logger.Infof("approval %d approved, start new deal for bot %d using pair %s", id, bot.Destination.ID, source.Pair)
+	deal, call, err := rest.StartNewDeal(d.APIConfig, bot, source.Pair)
+	if err != nil {
+		logger.Warnf("could not start approved deal: %v", err)
+		decided.Error = err.Error()
+		if policyErr := d.failed(logger, bot, source, err, call); policyErr != nil {
+			logger.Errorf("could not handle unavailable deal %d: %v", source.ID, policyErr)
+		}
+	} else {
+		decided.DestDealID = deal.ID
+		d.decide(bot, source, monitor.Decision{Outcome: monitor.OutcomeCloned, DestDealID: deal.ID, Reason: approvalReason(id)}, call)
+		d.link(logger, bot, source, deal)
+	}
+	if err := d.Approvals.Update(decided); err != nil {
+		logger.Warnf("could not record the outcome of approval %d: %v", id, err)
+	}
+	return decided, nil
+}
+
+// Reject drops a pending approval, leaving the source deal as it is
+func (d DealsStream) Reject(id int) (state.Approval, error) {
+	if d.Approvals == nil {
+		return state.Approval{}, errNoApprovals
+	}
+	decided, err := d.Approvals.Decide(id, state.ApprovalRejected)
+	if err != nil {
+		return decided, err
+	}
+	log.NewLogger("deals").Infof("approval %d rejected, deal %d of bot %d will not be cloned to bot %d by mapping %s",
+		id, decided.SourceDealID, decided.SourceBotID, decided.DestBotID, decided.Mapping)
+	bot, ok := d.mapping(decided.SourceBotID, decided.Mapping)
+	if !ok {
+		bot = config.BotMapping{ID: decided.Mapping, Source: config.BotConfig{ID: decided.SourceBotID}, Destination: config.BotConfig{ID: decided.DestBotID}}
+	}
+	source := api.DealDetails{ID: decided.SourceDealID, BotID: decided.SourceBotID, Pair: decided.Pair}
+	d.decide(bot, source, monitor.Decision{Outcome: monitor.OutcomeRejected, Reason: approvalReason(id)})
+	return decided, nil
+}
+
+// ExpireApprovals applies the on_unavailable policy of their mappings to the deals which were not approved in time.
+// The deals of paused mappings, and deals which are no longer open or cannot be checked, expire without the policy
+// being applied.
+func (d DealsStream) ExpireApprovals() error {
+	if d.Approvals == nil {
+		return nil
+	}
+	logger := log.NewLogger("deals")
+
+	expired, err := d.Approvals.Expire()
+	for _, approval := range expired {
+		logger.Warnf("approval %d of deal %d for mapping %s expired", approval.ID, approval.SourceDealID, approval.Mapping)
+		bot, ok := d.mapping(approval.SourceBotID, approval.Mapping)
+		if !ok {
+			logger.Warnf("mapping %s is no longer configured, leaving deal %d as it is", approval.Mapping, approval.SourceDealID)
+			continue
+		}
+		source := api.DealDetails{ID: approval.SourceDealID, BotID: approval.SourceBotID, Pair: approval.Pair}
+		if d.Pauses != nil {
+			if paused, reason := d.Pauses.Paused(bot.ID); paused {
+				logger.Warnf("leaving expired deal %d of mapping %s as it is: %s", source.ID, bot.ID, reason)
+				d.decide(bot, source, monitor.Decision{Outcome: monitor.OutcomeExpired, Reason: approvalReason(approval.ID) + ", " + monitor.ReasonPaused})
+				continue
+			}
+		}
+		current, _, dealErr := rest.GetDeal(d.APIConfig, source.ID)
+		if dealErr != nil {
+			logger.Errorf("could not check expired deal %d, leaving it as it is: %v", source.ID, dealErr)
+			d.decide(bot, source, monitor.Decision{Outcome: monitor.OutcomeExpired, Reason: approvalReason(approval.ID), Error: dealErr.Error()})
+			continue
+		}
+		if !current.Active() {
+			logger.Infof("expired deal %d is already %s, leaving it as it is", source.ID, current.Status)
+			d.decide(bot, source, monitor.Decision{Outcome: monitor.OutcomeExpired, Reason: approvalReason(approval.ID) + ", already " + current.Status})
+			continue
+		}
+		action, calls, policyErr := d.handleUnavailable(logger, bot, source, config.ReasonApprovalExpired)
+		decision := monitor.Decision{Outcome: monitor.OutcomeExpired, Reason: approvalReason(approval.ID), Action: action}
+		if policyErr != nil {
+			logger.Errorf("could not handle expired deal %d: %v", source.ID, policyErr)
+			decision.Error = policyErr.Error()
+		}
+		d.decide(bot, source, decision, calls...)
+	}
+	if err != nil {
+		return fmt.Errorf("could not expire approvals: %v", err)
+	}
+	return nil
+}
+
+// approvalReason is the reason recorded for decisions about an approval
+func approvalReason(id int) string {
+	return fmt.Sprintf("approval %d", id)
+}
+
+// mapping finds a mapping of the source bot by id
+func (d DealsStream) mapping(sourceBotID int, id string) (config.BotMapping, bool) {
+	for _, bot := range d.Bots[sourceBotID] {
+		if bot.ID == id {
+			return bot, true
+		}
+	}
+	return config.BotMapping{}, false
+}
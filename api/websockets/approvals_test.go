@@ -0,0 +1,169 @@
+package websockets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/approval"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/pause"
+	"github.com/jslowik/commacloner/state"
+)
+
+// newApprovalsServer mocks the 3Commas API for approvals, recording the requests which change anything.  The deals
+// given as closed are shown as completed, every other deal as bought.
+func newApprovalsServer(sent *[]string, closed ...string) *httptest.Server {
+	rtr := mux.NewRouter()
+	rtr.HandleFunc("/ver1/deals/{id:[0-9]+}/show", func(w http.ResponseWriter, r *http.Request) {
+		status := "bought"
+		for _, id := range closed {
+			if mux.Vars(r)["id"] == id {
+				status = "completed"
+			}
+		}
+		w.Write([]byte(`{"id":` + mux.Vars(r)["id"] + `,"status":"` + status + `"}`))
+	})
+	rtr.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*sent = append(*sent, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+		if r.URL.Path == "/ver1/bots/5678/start_new_deal" {
+			w.Write([]byte(`{"id":777,"bot_id":5678,"pair":"USDT_BTC"}`))
+		}
+	})
+	return httptest.NewServer(rtr)
+}
+
+func TestDealsStream_approvals(t *testing.T) {
+	var sent []string
+	test3CServer := newApprovalsServer(&sent, "45", "46")
+	defer test3CServer.Close()
+
+	queue, err := approval.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := DealsStream{
+		APIConfig: config.API{RestURL: test3CServer.URL},
+		Bots: map[int][]config.BotMapping{
+			1234: {{
+				ID:              "gated",
+				Source:          config.BotConfig{ID: 1234},
+				Destination:     config.BotConfig{ID: 5678},
+				Overrides:       config.BotOverrides{OnUnavailable: config.UnavailablePolicy{Default: config.ActionCancel}},
+				RequireApproval: true,
+				ApprovalTimeout: "50ms",
+			}},
+		},
+		Approvals: queue,
+	}
+	for _, dealID := range []int{42, 43, 44, 45, 46} {
+		deal := api.DealsMessage{Details: api.DealDetails{ID: dealID, BotID: 1234, Status: "bought", Pair: "USDT_BTC"}}
+		if err := d.HandleDeal(deal); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(sent) != 0 {
+		t.Fatalf("sent %v, want nothing sent before approval", sent)
+	}
+	if pending := d.PendingApprovals(); len(pending) != 5 {
+		t.Fatalf("PendingApprovals() = %+v, want 5", pending)
+	}
+
+	approved, err := d.Approve(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approved.Status != state.ApprovalApproved || approved.DestDealID != 777 {
+		t.Errorf("Approve() = %+v, want approved as deal 777", approved)
+	}
+	if _, err := d.Approve(1); err != approval.ErrDecided {
+		t.Errorf("Approve() twice error = %v, want %v", err, approval.ErrDecided)
+	}
+	d.Pauses, err = pause.New(nil, "", []string{"gated"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Pauses.Pause("gated"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Approve(2); err != pause.ErrPaused {
+		t.Errorf("Approve() of a paused mapping error = %v, want %v", err, pause.ErrPaused)
+	}
+	d.Pauses = nil
+	if rejected, err := d.Reject(2); err != nil || rejected.Status != state.ApprovalRejected {
+		t.Errorf("Reject() = %+v, %v, want rejected", rejected, err)
+	}
+	closed, err := d.Approve(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if closed.Status != state.ApprovalApproved || closed.DestDealID != 0 || closed.Error != "deal 45 is already completed" {
+		t.Errorf("Approve() of a closed deal = %+v, want approved without a deal", closed)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if err := d.ExpireApprovals(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"POST /ver1/bots/5678/start_new_deal", "POST /ver1/deals/44/cancel"}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %v, want %v", sent, want)
+	}
+	if pending := d.PendingApprovals(); len(pending) != 0 {
+		t.Errorf("PendingApprovals() = %+v, want none", pending)
+	}
+}
+
+func TestDealsStream_ExpireApprovals_dryRun(t *testing.T) {
+	var sent []string
+	test3CServer := newApprovalsServer(&sent)
+	defer test3CServer.Close()
+
+	queue, err := approval.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shadow, err := state.OpenShadow(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// queued before the mapping was made a dry run
+	bot := config.BotMapping{
+		ID:              "gated",
+		Source:          config.BotConfig{ID: 1234},
+		Destination:     config.BotConfig{ID: 5678},
+		Overrides:       config.BotOverrides{OnUnavailable: config.UnavailablePolicy{Default: config.ActionPanicSell}},
+		RequireApproval: true,
+		ApprovalTimeout: "1ms",
+	}
+	if _, err := queue.Add(bot, api.DealDetails{ID: 42, BotID: 1234, Pair: "USDT_BTC"}); err != nil {
+		t.Fatal(err)
+	}
+	bot.DryRun = true
+	d := DealsStream{
+		APIConfig: config.API{RestURL: test3CServer.URL},
+		Bots:      map[int][]config.BotMapping{1234: {bot}},
+		Approvals: queue,
+		Shadow:    shadow,
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if err := d.ExpireApprovals(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 0 {
+		t.Errorf("sent %v, want nothing sent by a dry run", sent)
+	}
+	calls, err := shadow.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || calls[0].URL != test3CServer.URL+"/ver1/deals/42/panic_sell" {
+		t.Errorf("All() = %+v, want the panic sell shadowed", calls)
+	}
+}
@@ -6,16 +6,46 @@ import (
 	"fmt"
 	"github.com/jslowik/commacloner/api"
 	"github.com/jslowik/commacloner/api/rest"
+	"github.com/jslowik/commacloner/approval"
+	"github.com/jslowik/commacloner/audit"
 	"github.com/jslowik/commacloner/config"
 	"github.com/jslowik/commacloner/log"
+	"github.com/jslowik/commacloner/metrics"
+	"github.com/jslowik/commacloner/monitor"
+	"github.com/jslowik/commacloner/pause"
+	"github.com/jslowik/commacloner/simulator"
+	"github.com/jslowik/commacloner/state"
+	"go.uber.org/zap"
+	"time"
 )
 
 const dealsEndpoint = "/deals"
 
+// closeRetry is how long to wait before checking a source deal again when it could not be checked before closing it
+const closeRetry = time.Minute
+
 // DealsStream a websocket stream to listen for new deals
 type DealsStream struct {
 	APIConfig config.API
 	Bots      map[int][]config.BotMapping
+	// Links records the destination deals started for each source deal, nil if they are not recorded
+	Links *state.Links
+	// Shadow records the calls dry run mappings would have made, nil if they are only logged
+	Shadow *state.Shadow
+	// Simulator follows the paper deals of mappings with simulated destinations
+	Simulator *simulator.Simulator
+	// Approvals queues the new deals of mappings which require approval
+	Approvals *approval.Queue
+	// Pauses stops paused mappings starting new deals, nil if mappings cannot be paused
+	Pauses *pause.Switch
+	// Monitor counts the deals of each mapping and keeps what was decided for them, nil if they are not kept
+	Monitor *monitor.Monitor
+	// Metrics counts the same for Prometheus, nil if there are no metrics
+	Metrics *metrics.Metrics
+	// Audit logs every decision along with what led to it, nil if there is no audit log
+	Audit *audit.Log
+	// Closes keeps the source deals waiting to be closed after a delay, nil if they are lost on restart
+	Closes *state.Closes
 }
 
 // BuildSignature computes the signature for the websocket subscription message
@@ -56,25 +86,337 @@ func (d DealsStream) HandleDeal(deal api.DealsMessage) error {
 	logger := log.NewLogger("deals")
 
 	details := deal.Details
-	if details.Status == "bought" && details.CompletedSafetyOrdersCount == 0 && details.CompletedManualSafetyOrdersCount == 0 {
+	isNew := details.Status == "bought" && details.CompletedSafetyOrdersCount == 0 && details.CompletedManualSafetyOrdersCount == 0
+	if isNew {
+		for _, bot := range d.Bots[details.BotID] {
+			d.Monitor.Received(bot.ID)
+			d.Metrics.Received(bot.ID)
+		}
+	}
+
+	// Simulated destinations follow every update of the deals they open.  Paused mappings open no new paper deals.
+	for _, bot := range d.Bots[details.BotID] {
+		if bot.Destination.Simulated() {
+			d.simulate(logger, bot, details, isNew && !d.paused(logger, bot, details))
+		}
+	}
+
+	if isNew {
 		logger.Infof("got new deal - bot id: %d, pair %s", details.BotID, details.Pair)
 		if d.Bots == nil {
 			return errors.New("no bots defined")
 		}
 		// Determine if we have a mapping which uses this source deal
 		for _, bot := range d.Bots[details.BotID] {
+			if bot.Destination.Simulated() || d.paused(logger, bot, details) {
+				continue
+			}
+			if bot.DryRun {
+				d.shadow(logger, bot, details, rest.StartNewDealRequest(bot, details.Pair))
+				continue
+			}
+			if bot.RequireApproval {
+				d.queue(logger, bot, details)
+				continue
+			}
 			logger.Infof("start new deal for bot %d using pair %s", bot.Destination.ID, details.Pair)
-			err := rest.StartNewDeal(d.APIConfig, bot, details.Pair)
+			deal, call, err := rest.StartNewDeal(d.APIConfig, bot, details.Pair)
 			if err != nil {
 				logger.Warnf("could not start new deal: %v", err)
-				if bot.Overrides.CancelUnavailableDeals {
-					e2 := rest.CancelDeal(d.APIConfig, details.ID, bot.Overrides.PanicSellUnavailableDeals)
-					if e2 != nil {
-						return fmt.Errorf("could not cancel deal: %v", e2)
-					}
+				if policyErr := d.failed(logger, bot, details, err, call); policyErr != nil {
+					return policyErr
 				}
+				continue
 			}
+			d.decide(bot, details, monitor.Decision{Outcome: monitor.OutcomeCloned, DestDealID: deal.ID}, call)
+			d.link(logger, bot, details, deal)
+		}
+	}
+	return nil
+}
+
+// paused reports whether a mapping is paused, logging and recording the source deal as skipped if it is
+func (d DealsStream) paused(logger *zap.SugaredLogger, bot config.BotMapping, source api.DealDetails) bool {
+	if d.Pauses == nil {
+		return false
+	}
+	paused, reason := d.Pauses.Paused(bot.ID)
+	if paused {
+		logger.Warnf("skipped deal %d of bot %d for mapping %s: %s", source.ID, source.BotID, bot.ID, reason)
+		d.decide(bot, source, monitor.Decision{Outcome: monitor.OutcomeSkipped, Reason: monitor.ReasonPaused})
+	}
+	return paused
+}
+
+// decide records what was done with a source deal for a mapping, and the calls made to do it
+func (d DealsStream) decide(bot config.BotMapping, source api.DealDetails, decision monitor.Decision, calls ...rest.Call) {
+	decision.Time = time.Now().UTC()
+	decision.Mapping = bot.ID
+	decision.SourceBotID = source.BotID
+	decision.SourceDealID = source.ID
+	decision.Pair = source.Pair
+	if !bot.Destination.Simulated() {
+		decision.DestBotID = bot.Destination.ID
+	}
+	d.Monitor.Decide(decision)
+	d.Metrics.Decide(decision)
+
+	err := d.Audit.Write(audit.Record{
+		Time:       decision.Time,
+		Source:     source,
+		Mapping:    bot,
+		Checks:     d.checks(bot),
+		Pair:       source.Pair,
+		DestPair:   bot.Overrides.Pair(source.Pair),
+		Calls:      calls,
+		Outcome:    decision.Outcome,
+		Reason:     decision.Reason,
+		Action:     decision.Action,
+		Error:      decision.Error,
+		DestDealID: decision.DestDealID,
+	})
+	if err != nil {
+		log.NewLogger("deals").Errorf("%v", err)
+	}
+}
+
+// checks returns the conditions which decide what is done with a new deal of a mapping, as they are now
+func (d DealsStream) checks(bot config.BotMapping) []audit.Check {
+	paused, reason := false, ""
+	if d.Pauses != nil {
+		paused, reason = d.Pauses.Paused(bot.ID)
+	}
+	return []audit.Check{
+		{Name: audit.CheckPaused, Result: paused, Detail: reason},
+		{Name: audit.CheckSimulated, Result: bot.Destination.Simulated()},
+		{Name: audit.CheckDryRun, Result: bot.DryRun},
+		{Name: audit.CheckRequireApproval, Result: bot.RequireApproval},
+	}
+}
+
+// failed applies the on_unavailable policy to a source deal which could not be started, recording the failure along
+// with the calls made.  The error is only set if the policy could not be applied.
+func (d DealsStream) failed(logger *zap.SugaredLogger, bot config.BotMapping, source api.DealDetails, startErr error, call rest.Call) error {
+	reason := rest.UnavailableReason(startErr)
+	action, calls, err := d.handleUnavailable(logger, bot, source, reason)
+	decision := monitor.Decision{Outcome: monitor.OutcomeFailed, Reason: string(reason), Action: action, Error: startErr.Error()}
+	if err != nil {
+		decision.Error += "; " + err.Error()
+	}
+	d.decide(bot, source, decision, append([]rest.Call{call}, calls...)...)
+	return err
+}
+
+// closed counts a source deal closed by a mapping's on_unavailable policy
+func (d DealsStream) closed(bot config.BotMapping, panicSell bool) {
+	d.Monitor.Closed(bot.ID, panicSell)
+	d.Metrics.Closed(bot.ID, panicSell)
+}
+
+// simulate passes an update of a source deal to the paper deal of a mapping with a simulated destination
+func (d DealsStream) simulate(logger *zap.SugaredLogger, bot config.BotMapping, source api.DealDetails, isNew bool) {
+	if d.Simulator == nil {
+		logger.Warnf("mapping %s has a simulated destination but there is no simulator", bot.ID)
+		return
+	}
+	deal, event, err := d.Simulator.Observe(bot, source, isNew)
+	if err != nil {
+		logger.Errorf("could not simulate deal %d for mapping %s: %v", source.ID, bot.ID, err)
+		if isNew {
+			d.decide(bot, source, monitor.Decision{Outcome: monitor.OutcomeFailed, Error: err.Error()})
+		}
+		return
+	}
+	logger = logger.With("mode", "simulated")
+	switch event {
+	case simulator.EventOpened:
+		d.decide(bot, source, monitor.Decision{Outcome: monitor.OutcomeSimulated, DestDealID: deal.ID})
+		logger.Infof("opened simulated deal %d of mapping %s on %s for deal %d", deal.ID, bot.ID, deal.Pair, source.ID)
+	case simulator.EventUpdated:
+		logger.Debugf("simulated deal %d of mapping %s has bought %g", deal.ID, bot.ID, deal.BoughtVolume)
+	case simulator.EventClosed:
+		logger.Infof("simulated deal %d of mapping %s %s on %s, profit %g (%g%%)",
+			deal.ID, bot.ID, deal.Status, deal.Pair, deal.Profit, deal.ProfitPercentage)
+	}
+}
+
+// shadow logs and records a request a dry run mapping would have sent.  Log lines carry a mode field of dry_run so
+// they can be told apart from live ones.
+func (d DealsStream) shadow(logger *zap.SugaredLogger, bot config.BotMapping, source api.DealDetails, request rest.Request) {
+	url := request.URL(d.APIConfig)
+	logger.With("mode", "dry_run").Infof("dry run: mapping %s would send %s %s", bot.ID, request.Method, url)
+	d.decide(bot, source, monitor.Decision{Outcome: monitor.OutcomeDryRun, Reason: "would send " + request.Method + " " + url})
+	if d.Shadow == nil {
+		return
+	}
+	err := d.Shadow.Add(state.ShadowCall{
+		Mapping:      bot.ID,
+		SourceBotID:  source.BotID,
+		SourceDealID: source.ID,
+		Method:       request.Method,
+		URL:          url,
+		Created:      time.Now().UTC(),
+	})
+	if err != nil {
+		logger.Warnf("could not record dry run call for deal %d: %v", source.ID, err)
+	}
+}
+
+// link records the destination deal started for a source deal, if a link store is configured
+func (d DealsStream) link(logger *zap.SugaredLogger, bot config.BotMapping, source api.DealDetails, dest api.Deal) {
+	if d.Links == nil || dest.ID == 0 {
+		return
+	}
+	err := d.Links.Add(state.Link{
+		Mapping:      bot.ID,
+		SourceBotID:  source.BotID,
+		SourceDealID: source.ID,
+		DestBotID:    bot.Destination.ID,
+		DestDealID:   dest.ID,
+		Pair:         dest.Pair,
+		Created:      time.Now().UTC(),
+	})
+	if err != nil {
+		logger.Warnf("could not record link from deal %d to deal %d: %v", source.ID, dest.ID, err)
+	}
+}
+
+// ScheduleCloses arms the closes of source deals which were waiting when serve last stopped.  Those already due are
+// checked and closed straight away.
+func (d DealsStream) ScheduleCloses() error {
+	if d.Closes == nil {
+		return nil
+	}
+	logger := log.NewLogger("deals")
+	pending, err := d.Closes.Pending()
+	if err != nil {
+		return fmt.Errorf("could not read pending closes: %v", err)
+	}
+	for _, p := range pending {
+		bot, ok := d.mapping(p.SourceBotID, p.Mapping)
+		if !ok {
+			logger.Warnf("mapping %s is no longer configured, leaving deal %d as it is", p.Mapping, p.SourceDealID)
+			continue
 		}
+		logger.Infof("closing deal %d of mapping %s at market at %s", p.SourceDealID, p.Mapping, p.Due.Format(time.RFC3339))
+		d.scheduleClose(bot, p)
 	}
 	return nil
 }
+
+// scheduleClose closes a source deal at market once it is due
+func (d DealsStream) scheduleClose(bot config.BotMapping, pending state.Close) {
+	time.AfterFunc(time.Until(pending.Due), func() { d.closeDue(bot, pending) })
+}
+
+// closeDue closes a source deal at market for close_at_market_after_delay, if it is still open.  If the deal cannot be
+// checked it is tried again later.  Dry run mappings only shadow the close.
+func (d DealsStream) closeDue(bot config.BotMapping, pending state.Close) {
+	logger := log.NewLogger("deals")
+	source := api.DealDetails{ID: pending.SourceDealID, BotID: pending.SourceBotID, Pair: pending.Pair}
+	decision := monitor.Decision{Outcome: monitor.OutcomeClosed, Reason: pending.Reason, Action: config.ActionCloseAfterDelay}
+
+	if bot.DryRun {
+		d.shadow(logger, bot, source, rest.CancelDealRequest(pending.SourceDealID, true))
+		pending.Done = true
+		d.saveClose(logger, pending)
+		return
+	}
+	deal, _, err := rest.GetDeal(d.APIConfig, pending.SourceDealID)
+	if err != nil {
+		logger.Errorf("could not check deal %d before closing it, trying again in %s: %v", pending.SourceDealID, closeRetry, err)
+		time.AfterFunc(closeRetry, func() { d.closeDue(bot, pending) })
+		return
+	}
+
+	var calls []rest.Call
+	if !deal.Active() {
+		logger.Infof("deal %d is already %s, not closing it", pending.SourceDealID, deal.Status)
+		decision.Reason += ", already " + deal.Status
+	} else {
+		call, err := rest.CancelDeal(d.APIConfig, pending.SourceDealID, true)
+		calls = append(calls, call)
+		if err != nil {
+			logger.Errorf("could not close deal %d: %v", pending.SourceDealID, err)
+			decision.Error = err.Error()
+		} else {
+			d.closed(bot, true)
+		}
+	}
+	pending.Done = true
+	d.saveClose(logger, pending)
+	d.decide(bot, source, decision, calls...)
+}
+
+// saveClose records the state of a pending close, if a close store is configured
+func (d DealsStream) saveClose(logger *zap.SugaredLogger, pending state.Close) {
+	if d.Closes == nil {
+		return
+	}
+	if err := d.Closes.Save(pending); err != nil {
+		logger.Warnf("could not record the close of deal %d: %v", pending.SourceDealID, err)
+	}
+}
+
+// handleUnavailable applies the mapping's on_unavailable policy to a source deal which could not be started on the
+// destination bot, returning the action applied and the calls made.  Deals closed after a delay are kept in the close
+// store until they are, and recorded as a decision of their own then.  Dry run mappings only shadow the call the
+// policy would make.
+func (d DealsStream) handleUnavailable(logger *zap.SugaredLogger, bot config.BotMapping, details api.DealDetails, reason config.UnavailableReason) (config.UnavailableAction, []rest.Call, error) {
+	policy := bot.Overrides.OnUnavailable
+	action := policy.Action(reason)
+	logger.Infof("deal %d unavailable on bot %d (%s), applying %s", details.ID, bot.Destination.ID, reason, action)
+
+	if bot.DryRun {
+		if request, ok := unavailableRequest(action, details); ok {
+			d.shadow(logger, bot, details, request)
+		}
+		return action, nil, nil
+	}
+
+	switch action {
+	case config.ActionCancel, config.ActionPanicSell:
+		call, err := rest.CancelDeal(d.APIConfig, details.ID, action == config.ActionPanicSell)
+		if err != nil {
+			return action, []rest.Call{call}, fmt.Errorf("could not cancel deal: %v", err)
+		}
+		d.closed(bot, action == config.ActionPanicSell)
+		return action, []rest.Call{call}, nil
+	case config.ActionCloseAfterDelay:
+		delay := policy.Delay()
+		logger.Infof("closing deal %d at market in %s", details.ID, delay)
+		pending := state.Close{
+			Mapping:      bot.ID,
+			SourceBotID:  details.BotID,
+			SourceDealID: details.ID,
+			Pair:         details.Pair,
+			Reason:       string(reason),
+			Due:          time.Now().Add(delay).UTC(),
+		}
+		d.saveClose(logger, pending)
+		d.scheduleClose(bot, pending)
+	case config.ActionDisableSourceBot:
+		call, err := rest.DisableBot(d.APIConfig, details.BotID)
+		if err != nil {
+			return action, []rest.Call{call}, fmt.Errorf("could not disable source bot: %v", err)
+		}
+		return action, []rest.Call{call}, nil
+	case config.ActionNotifyOnly:
+		logger.Errorf("deal %d on bot %d was not cloned to bot %d by mapping %s (%s)",
+			details.ID, details.BotID, bot.Destination.ID, bot.ID, reason)
+	}
+	return action, nil, nil
+}
+
+// unavailableRequest is the request an on_unavailable action makes for a source deal, if it makes one
+func unavailableRequest(action config.UnavailableAction, details api.DealDetails) (rest.Request, bool) {
+	switch action {
+	case config.ActionCancel, config.ActionPanicSell:
+		return rest.CancelDealRequest(details.ID, action == config.ActionPanicSell), true
+	case config.ActionCloseAfterDelay:
+		return rest.CancelDealRequest(details.ID, true), true
+	case config.ActionDisableSourceBot:
+		return rest.DisableBotRequest(details.BotID), true
+	}
+	return rest.Request{}, false
+}
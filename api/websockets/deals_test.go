@@ -1,20 +1,30 @@
 package websockets
 
 import (
+	"bytes"
+	"encoding/json"
 	"github.com/gorilla/mux"
 	"github.com/jslowik/commacloner/api"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/jslowik/commacloner/audit"
 	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/monitor"
+	"github.com/jslowik/commacloner/pause"
+	"github.com/jslowik/commacloner/simulator"
+	"github.com/jslowik/commacloner/state"
 )
 
 const (
 	StartNewDealPath  = "/ver1/bots/{id:[a-zA-Z0-9]+}/start_new_deal"
 	CancelDealPath    = "/ver1/deals/{id:[a-zA-Z0-9]+}/cancel"
 	PanicSellDealPath = "/ver1/deals/{id:[a-zA-Z0-9]+}/panic_sell"
+	DisableBotPath    = "/ver1/bots/{id:[a-zA-Z0-9]+}/disable"
 )
 
 // NewTest3CServer mocks the 3Commas API Server.  pass in a func to set a custom request handler
@@ -220,7 +230,7 @@ func TestDealsStream_HandleDeal(t *testing.T) {
 						ID: 5678,
 					},
 					Overrides: config.BotOverrides{
-						CancelUnavailableDeals: true,
+						OnUnavailable: config.UnavailablePolicy{Default: config.ActionCancel},
 					},
 				}},
 			},
@@ -240,6 +250,41 @@ func TestDealsStream_HandleDeal(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "disable source bot when pair missing",
+			botMaps: map[int][]config.BotMapping{
+				1234: {{
+					ID: "example",
+					Source: config.BotConfig{
+						ID: 1234,
+					},
+					Destination: config.BotConfig{
+						ID: 5678,
+					},
+					Overrides: config.BotOverrides{
+						OnUnavailable: config.UnavailablePolicy{Default: config.ActionCancel, PairMissing: config.ActionDisableSourceBot},
+					},
+				}},
+			},
+			deal: api.DealsMessage{
+				Details: api.DealDetails{
+					BotID:                      1234,
+					Status:                     "bought",
+					CompletedSafetyOrdersCount: 0,
+					Pair:                       "BTC_USD",
+				},
+			},
+			handler: customHandlerFields{
+				handlerPath: StartNewDealPath,
+				handler: func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(http.StatusUnprocessableEntity)
+					w.Write([]byte(`{"error_attributes":{"pair":["No market data for this pair"]}}`))
+				},
+			},
+			// the test server has no disable route, so the failure shows the source bot was disabled rather than
+			// the deal cancelled
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -257,3 +302,376 @@ func TestDealsStream_HandleDeal(t *testing.T) {
 		})
 	}
 }
+
+func TestDealsStream_HandleDeal_links(t *testing.T) {
+	test3CServer, _ := NewTest3CServer(StartNewDealPath, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":777,"bot_id":5678,"pair":"USD_BTC"}`))
+	})
+	defer test3CServer.Close()
+
+	dir := t.TempDir()
+	links, err := state.OpenLinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := DealsStream{
+		APIConfig: config.API{RestURL: test3CServer.URL},
+		Bots: map[int][]config.BotMapping{
+			1234: {{ID: "example", Source: config.BotConfig{ID: 1234}, Destination: config.BotConfig{ID: 5678}}},
+		},
+		Links: links,
+	}
+	deal := api.DealsMessage{Details: api.DealDetails{ID: 42, BotID: 1234, Status: "bought", Pair: "USDT_BTC"}}
+	if err := d.HandleDeal(deal); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := links.ForDeal(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("ForDeal() = %v, want a single link", got)
+	}
+	got[0].Created = time.Time{}
+	want := state.Link{Mapping: "example", SourceBotID: 1234, SourceDealID: 42, DestBotID: 5678, DestDealID: 777, Pair: "USD_BTC"}
+	if got[0] != want {
+		t.Errorf("ForDeal() = %+v, want %+v", got[0], want)
+	}
+}
+
+func TestDealsStream_HandleDeal_dryRun(t *testing.T) {
+	var sent []string
+	test3CServer, _ := NewTest3CServer(StartNewDealPath, func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer test3CServer.Close()
+
+	dir := t.TempDir()
+	shadow, err := state.OpenShadow(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := DealsStream{
+		APIConfig: config.API{RestURL: test3CServer.URL},
+		Bots: map[int][]config.BotMapping{
+			1234: {
+				{
+					ID:          "shadowed",
+					Source:      config.BotConfig{ID: 1234},
+					Destination: config.BotConfig{ID: 5678},
+					Overrides:   config.BotOverrides{QuoteCurrency: "USD"},
+					DryRun:      true,
+				},
+				{ID: "live", Source: config.BotConfig{ID: 1234}, Destination: config.BotConfig{ID: 9012}},
+			},
+		},
+		Shadow: shadow,
+	}
+	deal := api.DealsMessage{Details: api.DealDetails{ID: 42, BotID: 1234, Status: "bought", Pair: "USDT_BTC"}}
+	if err := d.HandleDeal(deal); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"/ver1/bots/9012/start_new_deal"}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %v, want only the live mapping's deal %v", sent, want)
+	}
+	calls, err := shadow.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("All() = %v, want a single call", calls)
+	}
+	calls[0].Created = time.Time{}
+	want := state.ShadowCall{
+		Mapping:      "shadowed",
+		SourceBotID:  1234,
+		SourceDealID: 42,
+		Method:       "POST",
+		URL:          test3CServer.URL + "/ver1/bots/5678/start_new_deal?pair=USD_BTC",
+	}
+	if calls[0] != want {
+		t.Errorf("All() = %+v, want %+v", calls[0], want)
+	}
+}
+
+func TestDealsStream_HandleDeal_simulated(t *testing.T) {
+	var sent []string
+	test3CServer, _ := NewTest3CServer(StartNewDealPath, func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer test3CServer.Close()
+
+	sim, err := simulator.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := DealsStream{
+		APIConfig: config.API{RestURL: test3CServer.URL},
+		Bots: map[int][]config.BotMapping{
+			1234: {{ID: "paper", Source: config.BotConfig{ID: 1234}, Destination: config.BotConfig{Type: config.BotTypeSimulated}}},
+		},
+		Simulator: sim,
+	}
+	updates := []api.DealDetails{
+		{ID: 42, BotID: 1234, Status: "bought", Pair: "USDT_BTC", BoughtVolume: "10"},
+		{ID: 42, BotID: 1234, Status: "bought", Pair: "USDT_BTC", BoughtVolume: "30", CompletedSafetyOrdersCount: 1},
+		{ID: 42, BotID: 1234, Status: "completed", Pair: "USDT_BTC", BoughtVolume: "30", FinalProfitPercentage: "1.5"},
+	}
+	for _, details := range updates {
+		if err := d.HandleDeal(api.DealsMessage{Details: details}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(sent) != 0 {
+		t.Errorf("sent %v, want nothing sent for a simulated destination", sent)
+	}
+	deals := sim.Deals()
+	if len(deals) != 1 {
+		t.Fatalf("Deals() = %v, want a single deal", deals)
+	}
+	if deals[0].Status != "completed" || deals[0].BoughtVolume != 30 || deals[0].Profit != 0.45 {
+		t.Errorf("Deals() = %+v, want a completed deal of 30 making 0.45", deals[0])
+	}
+}
+
+func TestDealsStream_HandleDeal_paused(t *testing.T) {
+	var sent []string
+	test3CServer, _ := NewTest3CServer(StartNewDealPath, func(w http.ResponseWriter, r *http.Request) {
+		sent = append(sent, r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+	})
+	defer test3CServer.Close()
+
+	pauses, err := pause.New(nil, "", []string{"paused", "live", "paper"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pauses.Pause("paused"); err != nil {
+		t.Fatal(err)
+	}
+	sim, err := simulator.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := DealsStream{
+		APIConfig: config.API{RestURL: test3CServer.URL},
+		Bots: map[int][]config.BotMapping{
+			1234: {
+				{ID: "paused", Source: config.BotConfig{ID: 1234}, Destination: config.BotConfig{ID: 5678}},
+				{ID: "live", Source: config.BotConfig{ID: 1234}, Destination: config.BotConfig{ID: 9012}},
+				{ID: "paper", Source: config.BotConfig{ID: 1234}, Destination: config.BotConfig{Type: config.BotTypeSimulated}},
+			},
+		},
+		Simulator: sim,
+		Pauses:    pauses,
+	}
+	deal := api.DealsMessage{Details: api.DealDetails{ID: 42, BotID: 1234, Status: "bought", Pair: "USDT_BTC"}}
+	if err := d.HandleDeal(deal); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/ver1/bots/9012/start_new_deal"}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %v, want only the live mapping's deal %v", sent, want)
+	}
+
+	// Pausing every mapping stops paper deals opening too
+	if err := pauses.Pause(""); err != nil {
+		t.Fatal(err)
+	}
+	deal.Details.ID = 43
+	if err := d.HandleDeal(deal); err != nil {
+		t.Fatal(err)
+	}
+	if len(sent) != 1 {
+		t.Errorf("sent %v while every mapping was paused", sent)
+	}
+	if deals := sim.Deals(); len(deals) != 1 || deals[0].SourceDealID != 42 {
+		t.Errorf("Deals() = %+v, want only the paper deal opened before the pause", deals)
+	}
+}
+
+func TestDealsStream_HandleDeal_decisions(t *testing.T) {
+	var cancelled []string
+	rtr := mux.NewRouter()
+	rtr.HandleFunc(StartNewDealPath, func(w http.ResponseWriter, r *http.Request) {
+		if mux.Vars(r)["id"] == "9012" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":777,"bot_id":5678,"pair":"USDT_BTC"}`))
+	})
+	rtr.HandleFunc(PanicSellDealPath, func(w http.ResponseWriter, r *http.Request) {
+		cancelled = append(cancelled, r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+	})
+	test3CServer := httptest.NewServer(rtr)
+	defer test3CServer.Close()
+
+	pauses, err := pause.New(nil, "", []string{"live", "failing", "paused", "paper"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pauses.Pause("paused"); err != nil {
+		t.Fatal(err)
+	}
+	sim, err := simulator.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mappings := []config.BotMapping{
+		{ID: "live", Source: config.BotConfig{ID: 1234}, Destination: config.BotConfig{ID: 5678}},
+		{
+			ID:          "failing",
+			Source:      config.BotConfig{ID: 1234},
+			Destination: config.BotConfig{ID: 9012},
+			Overrides:   config.BotOverrides{OnUnavailable: config.UnavailablePolicy{Default: config.ActionPanicSell}},
+		},
+		{ID: "paused", Source: config.BotConfig{ID: 1234}, Destination: config.BotConfig{ID: 3456}},
+		{ID: "paper", Source: config.BotConfig{ID: 1234}, Destination: config.BotConfig{Type: config.BotTypeSimulated}},
+	}
+	mon := monitor.New(mappings, monitor.DefaultDecisions)
+	var audited auditBuffer
+	d := DealsStream{
+		APIConfig: config.API{RestURL: test3CServer.URL},
+		Bots:      map[int][]config.BotMapping{1234: mappings},
+		Simulator: sim,
+		Pauses:    pauses,
+		Monitor:   mon,
+		Audit:     audit.New(&audited, nil, 0),
+	}
+	deal := api.DealsMessage{Details: api.DealDetails{ID: 42, BotID: 1234, Status: "bought", Pair: "USDT_BTC"}}
+	if err := d.HandleDeal(deal); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]monitor.Outcome)
+	for _, decision := range mon.Decisions("", 0) {
+		got[decision.Mapping] = decision.Outcome
+	}
+	want := map[string]monitor.Outcome{
+		"live":    monitor.OutcomeCloned,
+		"failing": monitor.OutcomeFailed,
+		"paused":  monitor.OutcomeSkipped,
+		"paper":   monitor.OutcomeSimulated,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decisions() = %v, want %v", got, want)
+	}
+	for _, mapping := range mon.Mappings() {
+		if mapping.Counters.Received != 1 {
+			t.Errorf("mapping %s received %d deals, want 1", mapping.ID, mapping.Counters.Received)
+		}
+		if mapping.ID == "failing" && mapping.Counters.PanicSold != 1 {
+			t.Errorf("mapping failing panic sold %d deals, want 1", mapping.Counters.PanicSold)
+		}
+	}
+	if len(cancelled) != 1 {
+		t.Errorf("panic sold %v, want the source deal panic sold", cancelled)
+	}
+
+	records := make(map[string]audit.Record)
+	dec := json.NewDecoder(&audited)
+	for dec.More() {
+		var record audit.Record
+		if err := dec.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+		records[record.Mapping.ID] = record
+	}
+	if len(records) != len(want) {
+		t.Fatalf("audited %d mappings, want %d", len(records), len(want))
+	}
+	for mapping, outcome := range want {
+		if records[mapping].Outcome != outcome || records[mapping].Source.ID != 42 {
+			t.Errorf("audit record of %s = %+v, want outcome %s for deal 42", mapping, records[mapping], outcome)
+		}
+	}
+	var statuses []int
+	for _, call := range records["failing"].Calls {
+		statuses = append(statuses, call.Status)
+	}
+	if want := []int{http.StatusInternalServerError, http.StatusCreated}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("failing mapping made calls with statuses %v, want %v", statuses, want)
+	}
+	if checks := records["paused"].Checks; len(checks) == 0 || checks[0].Name != audit.CheckPaused || !checks[0].Result {
+		t.Errorf("paused mapping checks = %v, want it paused", checks)
+	}
+}
+
+// auditBuffer holds an audit log in memory
+type auditBuffer struct {
+	bytes.Buffer
+}
+
+func (b *auditBuffer) Close() error {
+	return nil
+}
+
+func TestDealsStream_ScheduleCloses(t *testing.T) {
+	var mu sync.Mutex
+	var sold []string
+	rtr := mux.NewRouter()
+	rtr.HandleFunc("/ver1/deals/{id:[0-9]+}/show", func(w http.ResponseWriter, r *http.Request) {
+		status := "bought"
+		if mux.Vars(r)["id"] == "43" {
+			status = "completed"
+		}
+		w.Write([]byte(`{"id":` + mux.Vars(r)["id"] + `,"status":"` + status + `"}`))
+	})
+	rtr.HandleFunc(PanicSellDealPath, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sold = append(sold, mux.Vars(r)["id"])
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	})
+	test3CServer := httptest.NewServer(rtr)
+	defer test3CServer.Close()
+
+	dir := t.TempDir()
+	closes, err := state.OpenCloses(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// closes left pending by an earlier run, both already due
+	due := time.Now().Add(-time.Minute).UTC()
+	for _, id := range []int{42, 43} {
+		err := closes.Save(state.Close{Mapping: "delayed", SourceBotID: 1234, SourceDealID: id, Pair: "USDT_BTC", Reason: "funds", Due: due})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mappings := []config.BotMapping{{ID: "delayed", Source: config.BotConfig{ID: 1234}, Destination: config.BotConfig{ID: 5678}}}
+	d := DealsStream{
+		APIConfig: config.API{RestURL: test3CServer.URL},
+		Bots:      map[int][]config.BotMapping{1234: mappings},
+		Closes:    closes,
+	}
+	if err := d.ScheduleCloses(); err != nil {
+		t.Fatal(err)
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		pending, err := closes.Pending()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("closes still pending: %+v", pending)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"42"}; !reflect.DeepEqual(sold, want) {
+		t.Errorf("panic sold %v, want only the deal still open %v", sold, want)
+	}
+}
@@ -0,0 +1,191 @@
+// Package approval queues the new deals of mappings which require approval.  A queued deal waits until it is approved,
+// rejected, or expires; what then happens to it is up to the caller.
+package approval
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/state"
+)
+
+var (
+	// ErrNotFound is returned when deciding an approval which does not exist
+	ErrNotFound = errors.New("no such approval")
+	// ErrDecided is returned when deciding an approval which is no longer pending
+	ErrDecided = errors.New("approval has already been decided")
+	// ErrQueued is returned when adding a source deal the mapping has already queued
+	ErrQueued = errors.New("deal has already been queued for approval")
+)
+
+// Queue holds the approvals waiting for a decision.  Changes are saved to a store if one is given, otherwise they are
+// only kept in memory.
+type Queue struct {
+	mu        sync.Mutex
+	store     *state.Approvals
+	approvals map[int]state.Approval
+	nextID    int
+	now       func() time.Time
+}
+
+// New creates a queue, picking up the approvals left pending in the store by a previous run.  store may be nil.
+func New(store *state.Approvals) (*Queue, error) {
+	q := &Queue{store: store, approvals: make(map[int]state.Approval), nextID: 1, now: time.Now}
+	if store == nil {
+		return q, nil
+	}
+
+	approvals, err := store.All()
+	if err != nil {
+		return nil, fmt.Errorf("could not read approvals: %v", err)
+	}
+	for _, approval := range approvals {
+		if approval.ID >= q.nextID {
+			q.nextID = approval.ID + 1
+		}
+		q.approvals[approval.ID] = approval
+	}
+	return q, nil
+}
+
+// Add queues a new source deal for the mapping, to expire after the mapping's approval timeout.  A deal the mapping
+// has already queued is not queued again; its approval is returned with ErrQueued.
+func (q *Queue) Add(mapping config.BotMapping, source api.DealDetails) (state.Approval, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, approval := range q.approvals {
+		if approval.Mapping == mapping.ID && approval.SourceDealID == source.ID {
+			return approval, ErrQueued
+		}
+	}
+
+	created := q.now().UTC()
+	approval := state.Approval{
+		ID:           q.nextID,
+		Mapping:      mapping.ID,
+		SourceBotID:  source.BotID,
+		SourceDealID: source.ID,
+		DestBotID:    mapping.Destination.ID,
+		Pair:         source.Pair,
+		DestPair:     mapping.Overrides.Pair(source.Pair),
+		Status:       state.ApprovalPending,
+		Created:      created,
+		Expires:      created.Add(mapping.ApprovalExpiry()),
+	}
+	if err := q.save(approval); err != nil {
+		return approval, err
+	}
+	q.nextID++
+	return approval, nil
+}
+
+// Get returns an approval by id
+func (q *Queue) Get(id int) (state.Approval, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	approval, ok := q.approvals[id]
+	if !ok {
+		return approval, ErrNotFound
+	}
+	return approval, nil
+}
+
+// Decide approves or rejects a pending approval.  An approval which has passed its expiry but not yet been expired
+// may still be decided.
+func (q *Queue) Decide(id int, status state.ApprovalStatus) (state.Approval, error) {
+	if status != state.ApprovalApproved && status != state.ApprovalRejected {
+		return state.Approval{}, fmt.Errorf("cannot decide an approval as %s", status)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	approval, ok := q.approvals[id]
+	if !ok {
+		return approval, ErrNotFound
+	}
+	if approval.Status != state.ApprovalPending {
+		return approval, ErrDecided
+	}
+	decided := q.now().UTC()
+	approval.Status = status
+	approval.Decided = &decided
+	return approval, q.save(approval)
+}
+
+// Update records the outcome of a decided approval, such as the deal it started
+func (q *Queue) Update(approval state.Approval) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.approvals[approval.ID]; !ok {
+		return ErrNotFound
+	}
+	return q.save(approval)
+}
+
+// Expire marks every pending approval which has passed its expiry as expired, returning them
+func (q *Queue) Expire() ([]state.Approval, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now().UTC()
+	var expired []state.Approval
+	for _, approval := range q.sorted() {
+		if approval.Status != state.ApprovalPending || now.Before(approval.Expires) {
+			continue
+		}
+		approval.Status = state.ApprovalExpired
+		approval.Decided = &now
+		if err := q.save(approval); err != nil {
+			return expired, err
+		}
+		expired = append(expired, approval)
+	}
+	return expired, nil
+}
+
+// Pending returns the approvals waiting for a decision, ordered by id
+func (q *Queue) Pending() []state.Approval {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var pending []state.Approval
+	for _, approval := range q.sorted() {
+		if approval.Status == state.ApprovalPending {
+			pending = append(pending, approval)
+		}
+	}
+	return pending
+}
+
+// All returns every approval, ordered by id
+func (q *Queue) All() []state.Approval {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.sorted()
+}
+
+// sorted returns every approval ordered by id.  The lock must be held.
+func (q *Queue) sorted() []state.Approval {
+	approvals := make([]state.Approval, 0, len(q.approvals))
+	for id := 1; id < q.nextID; id++ {
+		if approval, ok := q.approvals[id]; ok {
+			approvals = append(approvals, approval)
+		}
+	}
+	return approvals
+}
+
+// save stores an approval, saving it first if there is a store.  The lock must be held.
+func (q *Queue) save(approval state.Approval) error {
+	if q.store != nil {
+		if err := q.store.Save(approval); err != nil {
+			return err
+		}
+	}
+	q.approvals[approval.ID] = approval
+	return nil
+}
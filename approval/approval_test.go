@@ -0,0 +1,106 @@
+package approval
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/state"
+)
+
+func TestQueue(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	store, err := state.OpenApprovals(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := New(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	q.now = func() time.Time { return now }
+
+	mapping := config.BotMapping{
+		ID:              "gated",
+		Source:          config.BotConfig{ID: 1},
+		Destination:     config.BotConfig{ID: 2},
+		Overrides:       config.BotOverrides{QuoteCurrency: "USD"},
+		RequireApproval: true,
+		ApprovalTimeout: "10m",
+	}
+	for dealID := 100; dealID < 103; dealID++ {
+		if _, err := q.Add(mapping, api.DealDetails{ID: dealID, BotID: 1, Pair: "USDT_BTC"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := state.Approval{
+		ID:           1,
+		Mapping:      "gated",
+		SourceBotID:  1,
+		SourceDealID: 100,
+		DestBotID:    2,
+		Pair:         "USDT_BTC",
+		DestPair:     "USD_BTC",
+		Status:       state.ApprovalPending,
+		Created:      now,
+		Expires:      now.Add(10 * time.Minute),
+	}
+	if got, err := q.Get(1); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %+v, %v, want %+v", got, err, want)
+	}
+	if got, err := q.Add(mapping, api.DealDetails{ID: 100, BotID: 1, Pair: "USDT_BTC"}); err != ErrQueued || got.ID != 1 {
+		t.Errorf("Add() of a queued deal = %+v, %v, want approval 1 and %v", got, err, ErrQueued)
+	}
+
+	now = now.Add(time.Minute)
+	if got, err := q.Decide(1, state.ApprovalApproved); err != nil || got.Status != state.ApprovalApproved || !got.Decided.Equal(now) {
+		t.Errorf("Decide() = %+v, %v, want approved at %v", got, err, now)
+	}
+	if _, err := q.Decide(1, state.ApprovalRejected); err != ErrDecided {
+		t.Errorf("Decide() of a decided approval error = %v, want %v", err, ErrDecided)
+	}
+	if _, err := q.Decide(9, state.ApprovalRejected); err != ErrNotFound {
+		t.Errorf("Decide() of a missing approval error = %v, want %v", err, ErrNotFound)
+	}
+	if _, err := q.Decide(2, state.ApprovalExpired); err == nil {
+		t.Error("Decide() as expired should fail")
+	}
+	if _, err := q.Decide(2, state.ApprovalRejected); err != nil {
+		t.Fatal(err)
+	}
+
+	if expired, err := q.Expire(); err != nil || len(expired) != 0 {
+		t.Errorf("Expire() before the timeout = %v, %v, want none", expired, err)
+	}
+	now = now.Add(10 * time.Minute)
+	expired, err := q.Expire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expired) != 1 || expired[0].ID != 3 || expired[0].Status != state.ApprovalExpired {
+		t.Errorf("Expire() = %+v, want approval 3 expired", expired)
+	}
+	if pending := q.Pending(); len(pending) != 0 {
+		t.Errorf("Pending() = %+v, want none", pending)
+	}
+
+	// A new queue picks up where the last left off
+	q, err = New(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []state.ApprovalStatus
+	for _, approval := range q.All() {
+		statuses = append(statuses, approval.Status)
+	}
+	if want := []state.ApprovalStatus{state.ApprovalApproved, state.ApprovalRejected, state.ApprovalExpired}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("All() statuses = %v, want %v", statuses, want)
+	}
+	if added, err := q.Add(mapping, api.DealDetails{ID: 103, BotID: 1, Pair: "USDT_BTC"}); err != nil || added.ID != 4 {
+		t.Errorf("Add() = %+v, %v, want id 4", added, err)
+	}
+}
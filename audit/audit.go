@@ -0,0 +1,327 @@
+// Package audit writes an append-only log of every decision made about a deal, one JSON object per line, for working
+// out afterwards why a deal was cloned, skipped or closed.
+//
+// The lines form a hash chain: each carries a sequence number and the SHA-256 of the line before it, so editing,
+// removing or reordering lines breaks the chain from that point on.  Every so often a checkpoint line is written whose
+// signature, made with a local ed25519 key, covers the hash of the line before it and so everything up to it.
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/api/rest"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/log"
+	"github.com/jslowik/commacloner/monitor"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Check is a condition checked before deciding what to do with a deal, and whether it held
+type Check struct {
+	Name   string `json:"name"`
+	Result bool   `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Names of the checks made
+const (
+	CheckPaused          = "paused"
+	CheckSimulated       = "simulated"
+	CheckDryRun          = "dry_run"
+	CheckRequireApproval = "require_approval"
+)
+
+// Record is a decision about a source deal and everything which led to it
+type Record struct {
+	Time time.Time `json:"time"`
+	// Seq is the position of the line in the chain, counting from 1, and Prev the hash of the line before it.  Both
+	// are set when the record is written.
+	Seq  int64  `json:"seq"`
+	Prev string `json:"prev"`
+	// Source is the source deal as it was when the decision was made.  Decisions about approvals only know its id,
+	// bot and pair.
+	Source api.DealDetails `json:"source"`
+	// Mapping is the mapping the decision was made for, as configured
+	Mapping config.BotMapping `json:"mapping"`
+	Checks  []Check           `json:"checks"`
+	// Pair is the pair of the source deal, DestPair the pair after the mapping's overrides
+	Pair     string `json:"pair"`
+	DestPair string `json:"dest_pair"`
+	// Calls are the calls made to the 3Commas API, in order
+	Calls      []rest.Call              `json:"calls,omitempty"`
+	Outcome    monitor.Outcome          `json:"outcome"`
+	Reason     string                   `json:"reason,omitempty"`
+	Action     config.UnavailableAction `json:"action,omitempty"`
+	Error      string                   `json:"error,omitempty"`
+	DestDealID int                      `json:"dest_deal_id,omitempty"`
+}
+
+// Checkpoint is a line of the audit log signing the chain up to it
+type Checkpoint struct {
+	Time       time.Time `json:"time"`
+	Seq        int64     `json:"seq"`
+	Prev       string    `json:"prev"`
+	Checkpoint Signature `json:"checkpoint"`
+}
+
+// Signature is the signature of a checkpoint, over its sequence number and the hash of the line before it
+type Signature struct {
+	// KeyID identifies the key which signed, see KeyID
+	KeyID     string `json:"key_id"`
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
+// Truncation is the line written when the audit log is opened after its last line was cut short, ie by a crash while
+// it was written.  The cut line is left where it is, ended with a newline, and the truncation carries the chain on
+// from the last whole line before it, so its Prev is that line's hash.  It records the hash of the cut line, so the
+// cut line cannot be replaced afterwards.
+type Truncation struct {
+	Time      time.Time `json:"time"`
+	Seq       int64     `json:"seq"`
+	Prev      string    `json:"prev"`
+	Truncated Cut       `json:"truncated"`
+}
+
+// Cut is the line a truncation follows, which is not part of the chain
+type Cut struct {
+	Bytes int    `json:"bytes"`
+	Hash  string `json:"hash"`
+}
+
+// signedMessage is what the signature of a checkpoint signs
+func signedMessage(seq int64, prev string) []byte {
+	return []byte(fmt.Sprintf("commacloner audit checkpoint\n%d\n%s", seq, prev))
+}
+
+// Hash returns the hash the next line of the chain carries as Prev, for a line without its newline
+func Hash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// Log writes records to the audit log.  A nil Log writes nothing, and it is safe for concurrent use.
+type Log struct {
+	mu  sync.Mutex
+	out io.WriteCloser
+	now func() time.Time
+
+	// key signs a checkpoint every checkpointEvery records, none are written if it is nil
+	key             ed25519.PrivateKey
+	checkpointEvery int
+	// seq and prev are the sequence number and hash of the last line written, unsigned the records written since
+	// the last checkpoint
+	seq      int64
+	prev     string
+	unsigned int
+}
+
+// New writes records to out, starting a new chain.  If key is set a checkpoint signed with it is written every
+// checkpointEvery records and when the log is closed.
+func New(out io.WriteCloser, key ed25519.PrivateKey, checkpointEvery int) *Log {
+	return &Log{out: out, now: time.Now, key: key, checkpointEvery: checkpointEvery}
+}
+
+// Open writes records to the file the config gives, rotating it as configured, and signs checkpoints with the key
+// the config gives, creating it if need be.  The chain carries on from the last line of the file.  If that line was
+// cut short, a Truncation is written after it, carrying the chain on from the line before.  It returns nil if no audit
+// log is configured.
+func Open(c config.Audit) (*Log, error) {
+	if c.Path == "" {
+		return nil, nil
+	}
+	if c.KeyFile == "" {
+		return nil, errors.New("no audit key file is configured")
+	}
+	key, err := OpenKey(c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0700); err != nil {
+		return nil, fmt.Errorf("could not create audit log directory: %v", err)
+	}
+	// the audit log holds account activity, so create it private; rotated files keep the mode of the original
+	f, err := os.OpenFile(c.Path, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open audit log: %v", err)
+	}
+	previous, last, terminated, err := lastLines(f)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("could not read audit log: %v", err)
+	}
+
+	l := New(&lumberjack.Logger{
+		Filename:   c.Path,
+		MaxSize:    c.MaxSize,
+		MaxBackups: c.MaxBackups,
+		MaxAge:     c.MaxAge,
+		Compress:   c.Compress,
+	}, key, c.CheckpointEvery)
+	if len(last) == 0 {
+		return l, nil
+	}
+	if link, err := parseLink(last); err == nil && terminated {
+		l.seq, l.prev = link.Seq, Hash(last)
+		return l, nil
+	}
+	if len(previous) != 0 {
+		link, err := parseLink(previous)
+		if err != nil {
+			return nil, fmt.Errorf("audit log %s does not end with a whole record, check it with audit verify", c.Path)
+		}
+		l.seq, l.prev = link.Seq, Hash(previous)
+	}
+	log.NewLogger("audit").Warnf("the last line of audit log %s was cut short, marking it truncated", c.Path)
+	if err := l.truncate(last, terminated); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// lastLines returns the last two lines of a file without their newlines, empty if the file has fewer, and whether
+// the file ends with a newline
+func lastLines(f *os.File) (previous, last []byte, terminated bool, err error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, false, err
+	}
+	end := info.Size()
+	for size := int64(4096); ; size *= 2 {
+		if size > end {
+			size = end
+		}
+		buf := make([]byte, size)
+		if _, err := f.ReadAt(buf, end-size); err != nil {
+			return nil, nil, false, err
+		}
+		terminated = bytes.HasSuffix(buf, []byte("\n"))
+		lines := bytes.Split(bytes.TrimSuffix(buf, []byte("\n")), []byte("\n"))
+		// the first line read may be the end of a longer one, unless the whole file was read
+		if len(lines) > 2 || size == end {
+			last = lines[len(lines)-1]
+			if len(lines) > 1 {
+				previous = lines[len(lines)-2]
+			}
+			return previous, last, terminated, nil
+		}
+	}
+}
+
+// Write appends a record to the chain, stamping it with the time if it has none, then a checkpoint if one is due
+func (l *Log) Write(record Record) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if record.Time.IsZero() {
+		record.Time = l.now().UTC()
+	}
+	record.Seq, record.Prev = l.seq+1, l.prev
+	if err := l.append(record); err != nil {
+		return fmt.Errorf("could not write audit record: %v", err)
+	}
+	l.unsigned++
+	if l.key != nil && l.unsigned >= l.checkpointEvery {
+		return l.checkpoint()
+	}
+	return nil
+}
+
+// checkpoint signs the chain so far
+func (l *Log) checkpoint() error {
+	seq := l.seq + 1
+	err := l.append(Checkpoint{
+		Time: l.now().UTC(),
+		Seq:  seq,
+		Prev: l.prev,
+		Checkpoint: Signature{
+			KeyID:     KeyID(l.key.Public().(ed25519.PublicKey)),
+			PublicKey: base64.StdEncoding.EncodeToString(l.key.Public().(ed25519.PublicKey)),
+			Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(l.key, signedMessage(seq, l.prev))),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("could not write audit checkpoint: %v", err)
+	}
+	l.unsigned = 0
+	return nil
+}
+
+// truncate marks the last line of the log as cut short, ending it first if it has no newline
+func (l *Log) truncate(cut []byte, terminated bool) error {
+	var end []byte
+	if !terminated {
+		end = []byte("\n")
+	}
+	err := l.appendAfter(end, Truncation{
+		Time:      l.now().UTC(),
+		Seq:       l.seq + 1,
+		Prev:      l.prev,
+		Truncated: Cut{Bytes: len(cut), Hash: Hash(cut)},
+	})
+	if err != nil {
+		return fmt.Errorf("could not mark the audit log truncated: %v", err)
+	}
+	return nil
+}
+
+// append writes a line of the chain in a single write, so a rotation never splits it
+func (l *Log) append(v interface{}) error {
+	return l.appendAfter(nil, v)
+}
+
+// appendAfter writes a line of the chain preceded by prefix, which is not part of the line, in a single write
+func (l *Log) appendAfter(prefix []byte, v interface{}) error {
+	buf := bytes.NewBuffer(prefix)
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	if _, err := l.out.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	l.seq++
+	l.prev = Hash(bytes.TrimSuffix(buf.Bytes()[len(prefix):], []byte("\n")))
+	return nil
+}
+
+// KeyID returns the id of the key checkpoints are signed with, empty if they are not signed
+func (l *Log) KeyID() string {
+	if l == nil || l.key == nil {
+		return ""
+	}
+	return KeyID(l.key.Public().(ed25519.PublicKey))
+}
+
+// Close signs the records written since the last checkpoint and closes the audit log
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var err error
+	if l.key != nil && l.unsigned != 0 {
+		err = l.checkpoint()
+	}
+	if closeErr := l.out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
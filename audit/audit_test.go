@@ -0,0 +1,416 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/api/rest"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/monitor"
+)
+
+// buffer holds an audit log in memory
+type buffer struct {
+	bytes.Buffer
+}
+
+func (b *buffer) Close() error {
+	return nil
+}
+
+func TestOpen(t *testing.T) {
+	l, err := Open(config.Audit{})
+	if err != nil || l != nil {
+		t.Fatalf("Open() = %v, %v, want no audit log", l, err)
+	}
+	if err := l.Write(Record{Outcome: monitor.OutcomeCloned}); err != nil {
+		t.Errorf("Write() to no audit log error = %v", err)
+	}
+
+	dir := t.TempDir()
+	c := config.Audit{Path: filepath.Join(dir, "audit", "audit.jsonl"), MaxSize: 1, KeyFile: filepath.Join(dir, "keys", "audit.key"), CheckpointEvery: 2}
+	l, err = Open(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.now = func() time.Time { return time.Date(2022, 3, 4, 5, 6, 7, 0, time.FixedZone("CET", 3600)) }
+	records := []Record{
+		{
+			Source:   api.DealDetails{ID: 42, BotID: 1234, Pair: "USDT_BTC"},
+			Mapping:  config.BotMapping{ID: "live", Destination: config.BotConfig{ID: 5678}},
+			Checks:   []Check{{Name: CheckPaused}},
+			Pair:     "USDT_BTC",
+			DestPair: "USD_BTC",
+			Calls: []rest.Call{{
+				Method: "POST",
+				URL:    "https://api.3commas.io/public/api/ver1/bots/5678/start_new_deal?pair=USD_BTC",
+				Status: 201,
+				Body:   `{"id":777}`,
+			}},
+			Outcome:    monitor.OutcomeCloned,
+			DestDealID: 777,
+		},
+		{Time: time.Date(2022, 3, 4, 5, 6, 8, 0, time.UTC), Outcome: monitor.OutcomeSkipped, Reason: monitor.ReasonPaused},
+		{Outcome: monitor.OutcomeDryRun},
+	}
+	for _, record := range records {
+		if err := l.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the chain carries on when the log is opened again
+	if l, err = Open(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Write(Record{Outcome: monitor.OutcomeSimulated}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{c.Path, c.KeyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != 0600 {
+			t.Errorf("%s mode = %v, want 0600", path, mode)
+		}
+	}
+	f, err := os.Open(c.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("line %d is not a record: %v", len(got)+1, err)
+		}
+		got = append(got, record)
+	}
+	// records 1, 2, a checkpoint, 3, a checkpoint on close, then 4 and a checkpoint after opening again
+	if len(got) != 7 {
+		t.Fatalf("read %d lines, want 7", len(got))
+	}
+	if want := "2022-03-04T04:06:07Z"; got[0].Time.Format(time.RFC3339) != want {
+		t.Errorf("first record time = %v, want %v", got[0].Time, want)
+	}
+	if got[0].Seq != 1 || got[0].Prev != "" || got[0].Calls[0].Status != 201 || got[0].DestPair != "USD_BTC" || got[0].Mapping.ID != "live" {
+		t.Errorf("first record = %+v", got[0])
+	}
+	if !got[1].Time.Equal(records[1].Time) || got[1].Reason != monitor.ReasonPaused {
+		t.Errorf("second record = %+v", got[1])
+	}
+	if got[5].Outcome != monitor.OutcomeSimulated || got[5].Seq != 6 {
+		t.Errorf("record after opening again = %+v, want seq 6", got[5])
+	}
+
+	key, err := ReadPublicKey(c.KeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verification, err := VerifyFiles(key, c.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.Broken != nil || verification.Lines != 7 || verification.Checkpoints != 3 || verification.Unsigned != 0 {
+		t.Errorf("VerifyFiles() = %+v, want 7 lines, 3 checkpoints and nothing unsigned", verification)
+	}
+}
+
+func TestOpen_partial(t *testing.T) {
+	// two records, then the third cut short
+	var out buffer
+	l := New(&out, nil, 1)
+	for _, pair := range []string{"USDT_BTC", "USDT_ETH", "USDT_ADA"} {
+		if err := l.Write(Record{Pair: pair, Outcome: monitor.OutcomeCloned}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	whole := strings.SplitAfter(out.String(), "\n")
+	cut := whole[2][:40]
+
+	tests := []struct {
+		name     string
+		log      string
+		wantSeq  int64
+		wantErr  bool
+		tampered func(log string) string
+	}{
+		{name: "cut short", log: whole[0] + whole[1] + cut, wantSeq: 4},
+		{name: "cut short with a newline", log: whole[0] + whole[1] + cut + "\n", wantSeq: 4},
+		{name: "only line cut short", log: cut, wantSeq: 2},
+		{name: "two lines cut short", log: whole[0] + cut + "\n" + cut, wantErr: true},
+		{
+			name:    "cut line replaced",
+			log:     whole[0] + whole[1] + cut,
+			wantSeq: 4,
+			tampered: func(log string) string {
+				return strings.Replace(log, cut, cut[:len(cut)-1]+"X", 1)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "audit.jsonl")
+			if err := os.WriteFile(path, []byte(tt.log), 0600); err != nil {
+				t.Fatal(err)
+			}
+			c := config.Audit{Path: path, MaxSize: 1, KeyFile: filepath.Join(dir, "keys", "audit.key"), CheckpointEvery: 1}
+			l, err := Open(c)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Open() succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := l.Write(Record{Pair: "USDT_SOL", Outcome: monitor.OutcomeCloned}); err != nil {
+				t.Fatal(err)
+			}
+			if err := l.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			written, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.SplitAfter(string(written), "\n")
+			var truncation Truncation
+			if err := json.Unmarshal([]byte(lines[len(lines)-4]), &truncation); err != nil {
+				t.Fatal(err)
+			}
+			if truncation.Seq != tt.wantSeq-1 || truncation.Truncated.Hash != Hash([]byte(cut)) {
+				t.Errorf("truncation = %+v, want seq %d marking the cut line", truncation, tt.wantSeq-1)
+			}
+
+			if tt.tampered != nil {
+				if err := os.WriteFile(path, []byte(tt.tampered(string(written))), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			verification, err := VerifyFiles(nil, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.tampered != nil {
+				if verification.Broken == nil || !strings.Contains(verification.Broken.Reason, "not a record") {
+					t.Errorf("VerifyFiles() = %+v, want it broken at the replaced line", verification)
+				}
+				return
+			}
+			// the record written after opening, then its checkpoint
+			if verification.Broken != nil || verification.Truncations != 1 || verification.LastSeq != tt.wantSeq+1 {
+				t.Errorf("VerifyFiles() = %+v, want one truncation and the chain intact to seq %d", verification, tt.wantSeq+1)
+			}
+		})
+	}
+}
+
+func TestOpenKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys", "audit.key")
+	key, err := OpenKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := OpenKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !key.Equal(again) {
+		t.Error("OpenKey() generated another key instead of reading the one written")
+	}
+
+	public, err := EncodePublicKey(key.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPath := filepath.Join(filepath.Dir(path), "audit.pub")
+	if err := os.WriteFile(publicPath, public, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{path, publicPath} {
+		got, err := ReadPublicKey(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(key.Public()) {
+			t.Errorf("ReadPublicKey(%s) = %x, want %x", p, got, key.Public())
+		}
+	}
+	if _, err := OpenKey(publicPath); err == nil {
+		t.Error("OpenKey() of a public key succeeded, want an error")
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	public, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// records 1 to 3, a checkpoint, record 5 and a checkpoint on close
+	var out buffer
+	l := New(&out, key, 3)
+	for _, pair := range []string{"USDT_BTC", "USDT_ETH", "USDT_ADA", "USDT_SOL"} {
+		if err := l.Write(Record{Pair: pair, Outcome: monitor.OutcomeCloned}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(out.String(), "\n")
+	lines = lines[:len(lines)-1]
+	if len(lines) != 6 {
+		t.Fatalf("wrote %d lines, want 6", len(lines))
+	}
+
+	change := func(f func(lines []string) []string) []string {
+		return f(append([]string(nil), lines...))
+	}
+	tests := []struct {
+		name      string
+		key       ed25519.PublicKey
+		files     [][]string
+		wantLine  int
+		wantIn    string
+		continues bool
+	}{
+		{name: "intact", key: public, files: [][]string{lines}},
+		{name: "intact without a key", files: [][]string{lines}},
+		{name: "split over files", key: public, files: [][]string{lines[:2], lines[2:]}},
+		{name: "first lines rotated away", key: public, files: [][]string{lines[1:]}, continues: true},
+		{
+			name: "record edited",
+			key:  public,
+			files: [][]string{change(func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], "USDT_ETH", "USDT_DOGE", 1)
+				return lines
+			})},
+			wantLine: 3,
+			wantIn:   "was changed",
+		},
+		{
+			name: "record removed",
+			key:  public,
+			files: [][]string{change(func(lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			})},
+			wantLine: 2,
+			wantIn:   "seq is 3, want 2",
+		},
+		{
+			name: "records swapped",
+			key:  public,
+			files: [][]string{change(func(lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			})},
+			wantLine: 2,
+			wantIn:   "seq is 3, want 2",
+		},
+		{
+			name: "signature forged",
+			key:  public,
+			files: [][]string{change(func(lines []string) []string {
+				var checkpoint Checkpoint
+				if err := json.Unmarshal([]byte(lines[3]), &checkpoint); err != nil {
+					t.Fatal(err)
+				}
+				signature, _ := base64.StdEncoding.DecodeString(checkpoint.Checkpoint.Signature)
+				signature[0] ^= 0xff
+				checkpoint.Checkpoint.Signature = base64.StdEncoding.EncodeToString(signature)
+				line, _ := json.Marshal(checkpoint)
+				lines[3] = string(line) + "\n"
+				return lines[:4]
+			})},
+			wantLine: 4,
+			wantIn:   "signature does not match",
+		},
+		{name: "another key", key: other, files: [][]string{lines}, wantLine: 4, wantIn: "signed with key"},
+		{
+			name: "truncated",
+			key:  public,
+			files: [][]string{change(func(lines []string) []string {
+				lines[5] = lines[5][:20]
+				return lines
+			})},
+			wantLine: 6,
+			wantIn:   "incomplete",
+		},
+		{
+			name: "truncation without a cut line",
+			key:  public,
+			files: [][]string{change(func(lines []string) []string {
+				line, _ := json.Marshal(Truncation{Seq: 5, Prev: Hash([]byte(strings.TrimSuffix(lines[3], "\n"))), Truncated: Cut{Bytes: 1, Hash: Hash([]byte("{"))}})
+				lines[4] = string(line) + "\n"
+				return lines
+			})},
+			wantLine: 5,
+			wantIn:   "follows a whole line",
+		},
+		{
+			name: "chain restarted",
+			key:  public,
+			files: [][]string{change(func(lines []string) []string {
+				return append(lines[:4], lines...)
+			})},
+			wantLine: 5,
+			wantIn:   "seq is 1, want 5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVerifier(tt.key)
+			for i, file := range tt.files {
+				if err := v.Check(strings.Repeat("x", i+1), strings.NewReader(strings.Join(file, ""))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := v.Result()
+			switch {
+			case tt.wantLine == 0 && got.Broken != nil:
+				t.Fatalf("chain broken at %+v, want it to hold", got.Broken)
+			case tt.wantLine != 0 && got.Broken == nil:
+				t.Fatalf("chain holds, want it broken at line %d", tt.wantLine)
+			case tt.wantLine != 0:
+				if got.Broken.Line != tt.wantLine || !strings.Contains(got.Broken.Reason, tt.wantIn) {
+					t.Errorf("chain broken at %+v, want line %d: %s", got.Broken, tt.wantLine, tt.wantIn)
+				}
+				return
+			}
+			if (got.Continues != "") != tt.continues {
+				t.Errorf("Continues = %q, want continuing %v", got.Continues, tt.continues)
+			}
+			if got.LastSeq != 6 || got.Signed != 6 || got.Unsigned != 0 || len(got.Keys) != 1 {
+				t.Errorf("Result() = %+v, want everything up to seq 6 signed by one key", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// PEM block types of the keys
+const (
+	privateKeyType = "PRIVATE KEY"
+	publicKeyType  = "PUBLIC KEY"
+)
+
+// OpenKey reads the ed25519 key checkpoints are signed with from a PEM file, generating it if the file does not exist
+func OpenKey(path string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return generateKey(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read audit key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != privateKeyType {
+		return nil, fmt.Errorf("audit key %s is not a PEM encoded private key", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse audit key: %v", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("audit key %s is not an ed25519 key", path)
+	}
+	return key, nil
+}
+
+// generateKey writes a new key to path, readable only by its owner
+func generateKey(path string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("could not generate audit key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode audit key: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("could not create audit key directory: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not create audit key: %v", err)
+	}
+	if err := pem.Encode(f, &pem.Block{Type: privateKeyType, Bytes: der}); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not write audit key: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("could not write audit key: %v", err)
+	}
+	return key, nil
+}
+
+// ReadPublicKey reads the key checkpoints are checked against from a PEM file holding either the private key or the
+// public key alone
+func ReadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read key: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s is not PEM encoded", path)
+	}
+	var parsed interface{}
+	switch block.Type {
+	case privateKeyType:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case publicKeyType:
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %s holds a %s, not a key", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse key: %v", err)
+	}
+	switch key := parsed.(type) {
+	case ed25519.PrivateKey:
+		return key.Public().(ed25519.PublicKey), nil
+	case ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("key %s is not an ed25519 key", path)
+}
+
+// EncodePublicKey returns the public key as a PEM block, for handing to whoever verifies the audit log
+func EncodePublicKey(key ed25519.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode public key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: publicKeyType, Bytes: der}), nil
+}
+
+// KeyID returns a short fingerprint of a public key, the start of its SHA-256
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,217 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// link holds the parts of a line which chain it to the others, the same for records, checkpoints and truncations
+type link struct {
+	Seq        int64      `json:"seq"`
+	Prev       string     `json:"prev"`
+	Checkpoint *Signature `json:"checkpoint"`
+	Truncated  *Cut       `json:"truncated"`
+}
+
+// parseLink reads the link of a line, failing if it is not a line of the chain
+func parseLink(line []byte) (link, error) {
+	var l link
+	if err := json.Unmarshal(line, &l); err != nil {
+		return link{}, fmt.Errorf("not a record: %v", err)
+	}
+	if l.Seq < 1 {
+		return link{}, errors.New("not a record: it has no seq")
+	}
+	return l, nil
+}
+
+// Break is the first line whose link to the chain does not hold
+type Break struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Seq    int64  `json:"seq,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// Verification is what checking an audit log found
+type Verification struct {
+	Lines       int   `json:"lines"`
+	Checkpoints int   `json:"checkpoints"`
+	FirstSeq    int64 `json:"first_seq"`
+	LastSeq     int64 `json:"last_seq"`
+	// Continues is the hash of the line the first line follows, if the chain started in a file which was not checked,
+	// ie one rotated away
+	Continues string `json:"continues,omitempty"`
+	// Signed is the sequence number of the last checkpoint, Unsigned the number of lines after it
+	Signed   int64 `json:"signed"`
+	Unsigned int   `json:"unsigned"`
+	// Truncations is the number of lines which were cut short and marked so when the log was opened again.  They are
+	// not part of the chain and not counted in Lines.
+	Truncations int `json:"truncations"`
+	// Keys are the ids of the keys checkpoints were signed with
+	Keys []string `json:"keys"`
+	// Broken is where the chain first breaks, nil if it holds
+	Broken *Break `json:"broken,omitempty"`
+}
+
+// Verifier checks the chain of an audit log, which may be split over several files
+type Verifier struct {
+	key    ed25519.PublicKey
+	result Verification
+	// last is the hash of the last line followed
+	last string
+	// cut is where the chain breaks at a line which is not a record, unless the next line marks it truncated
+	cut *Break
+	// cutHash is the hash of that line
+	cutHash string
+}
+
+// NewVerifier checks checkpoints against the given key.  If it is nil the key each checkpoint carries is trusted,
+// which proves only that the lines were not edited by someone without a key of their own.
+func NewVerifier(key ed25519.PublicKey) *Verifier {
+	return &Verifier{key: key, result: Verification{Keys: []string{}}}
+}
+
+// VerifyFiles checks the chain through each file in turn, oldest first.  Files ending .gz, as rotated files are when
+// compressed, are decompressed.
+func VerifyFiles(key ed25519.PublicKey, paths ...string) (Verification, error) {
+	v := NewVerifier(key)
+	for _, path := range paths {
+		if err := v.verifyFile(path); err != nil {
+			return Verification{}, err
+		}
+	}
+	return v.Result(), nil
+}
+
+func (v *Verifier) verifyFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("could not open audit log: %v", err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("could not decompress %s: %v", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return v.Check(path, r)
+}
+
+// Check follows the chain through the lines read from r, named file in any break found.  Nothing more is checked
+// once the chain breaks.  A line which is not a record is only a break if the line after it does not mark it
+// truncated.  The error is only set if r could not be read.
+func (v *Verifier) Check(file string, r io.Reader) error {
+	br := bufio.NewReader(r)
+	for n := 1; v.result.Broken == nil; n++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("could not read %s: %v", file, err)
+		}
+		if len(line) == 0 {
+			return nil
+		}
+		if line[len(line)-1] != '\n' {
+			v.result.Broken = &Break{
+				File:   file,
+				Line:   n,
+				Seq:    v.result.LastSeq + 1,
+				Reason: "the line is incomplete, it has no newline, and is marked truncated when the log is next opened",
+			}
+			return nil
+		}
+		line = bytes.TrimSuffix(line, []byte("\n"))
+		l, err := parseLink(line)
+		switch {
+		case err != nil && v.cut == nil:
+			v.cut, v.cutHash = &Break{File: file, Line: n, Seq: v.result.LastSeq + 1, Reason: err.Error()}, Hash(line)
+		case v.cut != nil && (err != nil || l.Truncated == nil || l.Truncated.Hash != v.cutHash):
+			v.result.Broken = v.cut
+		case v.cut == nil && l.Truncated != nil:
+			v.result.Broken = &Break{File: file, Line: n, Seq: v.result.LastSeq + 1, Reason: "the line marks a truncation, but follows a whole line"}
+		default:
+			if reason := v.follow(l, line); reason != "" {
+				v.result.Broken = &Break{File: file, Line: n, Seq: v.result.LastSeq + 1, Reason: reason}
+			} else if v.cut != nil {
+				v.result.Truncations++
+				v.cut = nil
+			}
+		}
+	}
+	return nil
+}
+
+// follow adds a line to the chain, returning why it does not belong if it does not
+func (v *Verifier) follow(l link, line []byte) string {
+	switch {
+	case v.result.Lines == 0 && l.Prev == "" && l.Seq != 1:
+		return fmt.Sprintf("the chain starts at seq %d, want 1", l.Seq)
+	case v.result.Lines == 0:
+		v.result.FirstSeq, v.result.Continues = l.Seq, l.Prev
+	case l.Seq != v.result.LastSeq+1:
+		return fmt.Sprintf("seq is %d, want %d: lines were removed, added or reordered", l.Seq, v.result.LastSeq+1)
+	case l.Prev != v.last:
+		return "prev does not match the hash of the line before: that line was changed, or lines were removed"
+	}
+	if l.Checkpoint != nil {
+		if reason := v.verifySignature(l); reason != "" {
+			return reason
+		}
+		v.result.Checkpoints++
+		v.result.Signed, v.result.Unsigned = l.Seq, 0
+	} else {
+		v.result.Unsigned++
+	}
+	v.result.Lines++
+	v.result.LastSeq = l.Seq
+	v.last = Hash(line)
+	return ""
+}
+
+// verifySignature checks the signature of a checkpoint, returning why it is not good if it is not
+func (v *Verifier) verifySignature(l link) string {
+	key, err := base64.StdEncoding.DecodeString(l.Checkpoint.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return "the checkpoint's public key is malformed"
+	}
+	signature, err := base64.StdEncoding.DecodeString(l.Checkpoint.Signature)
+	if err != nil {
+		return "the checkpoint's signature is malformed"
+	}
+	if v.key != nil && !bytes.Equal(key, v.key) {
+		return fmt.Sprintf("the checkpoint is signed with key %s, not %s", KeyID(key), KeyID(v.key))
+	}
+	if !ed25519.Verify(key, signedMessage(l.Seq, l.Prev), signature) {
+		return "the checkpoint's signature does not match the chain"
+	}
+	id := KeyID(key)
+	for _, known := range v.result.Keys {
+		if known == id {
+			return ""
+		}
+	}
+	v.result.Keys = append(v.result.Keys, id)
+	return ""
+}
+
+// Result returns what has been found so far.  A line which is not a record, with nothing after it, is a break.
+func (v *Verifier) Result() Verification {
+	result := v.result
+	if result.Broken == nil && v.cut != nil {
+		result.Broken = v.cut
+	}
+	return result
+}
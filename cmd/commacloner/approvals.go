@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jslowik/commacloner/admin"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/state"
+	"github.com/spf13/cobra"
+)
+
+func commandApprovals() *cobra.Command {
+	approvalsCmd := &cobra.Command{
+		Use:   "approvals",
+		Short: "List, approve and reject the deals a running serve is waiting for approval to clone.",
+		Long: `List, approve and reject the deals of mappings with require_approval set.  These commands talk to the admin
+server of a running serve, found through the admin section of the config file.`,
+	}
+	approvalsCmd.AddCommand(commandApprovalsList())
+	approvalsCmd.AddCommand(commandApprovalsDecide("approve", "Start the destination deal of a pending approval.",
+		func(client admin.Client, id int) (state.Approval, error) { return client.Approve(id) }))
+	approvalsCmd.AddCommand(commandApprovalsDecide("reject", "Drop a pending approval, leaving the source deal as it is.",
+		func(client admin.Client, id int) (state.Approval, error) { return client.Reject(id) }))
+	return approvalsCmd
+}
+
+func commandApprovalsList() *cobra.Command {
+	var opts config.Options
+	var output string
+	cmd := &cobra.Command{
+		Use:     "list [ config file ]",
+		Short:   "List the deals waiting for approval.",
+		Example: "commacloner approvals list config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := listApprovals(args, opts, output); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "output format, \"table\" or \"json\"")
+	return cmd
+}
+
+func commandApprovalsDecide(decision, short string, decide func(admin.Client, int) (state.Approval, error)) *cobra.Command {
+	var opts config.Options
+	cmd := &cobra.Command{
+		Use:     decision + " [ approval id ] [ config file ]",
+		Short:   short,
+		Example: "commacloner approvals " + decision + " 12 config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := decideApproval(args, opts, decide); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	return cmd
+}
+
+// adminClient loads the admin section of a config file and connects to the admin server it describes
+func adminClient(args []string, opts config.Options) (admin.Client, error) {
+	c, err := loadConfigSection(args, opts, "admin")
+	if err != nil {
+		return admin.Client{}, err
+	}
+	return admin.NewClient(c.Admin)
+}
+
+func listApprovals(args []string, opts config.Options, output string) error {
+	if output != outputTable && output != outputJSON {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+	client, err := adminClient(args, opts)
+	if err != nil {
+		return err
+	}
+	pending, err := client.Approvals()
+	if err != nil {
+		return err
+	}
+
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(pending)
+	}
+	return printApprovals(os.Stdout, pending)
+}
+
+func decideApproval(args []string, opts config.Options, decide func(admin.Client, int) (state.Approval, error)) error {
+	if len(args) == 0 {
+		return errors.New("no arguments provided")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid approval id %q", args[0])
+	}
+	client, err := adminClient(args[1:], opts)
+	if err != nil {
+		return err
+	}
+
+	decided, err := decide(client, id)
+	if err != nil {
+		return err
+	}
+	switch {
+	case decided.Error != "":
+		return fmt.Errorf("approval %d %s, but the deal could not be started: %s", id, decided.Status, decided.Error)
+	case decided.DestDealID != 0:
+		fmt.Printf("approval %d %s, started deal %d on bot %d\n", id, decided.Status, decided.DestDealID, decided.DestBotID)
+	default:
+		fmt.Printf("approval %d %s\n", id, decided.Status)
+	}
+	return nil
+}
+
+func printApprovals(out io.Writer, approvals []state.Approval) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tMAPPING\tSOURCE DEAL\tDEST BOT\tPAIR\tCREATED\tEXPIRES")
+	for _, approval := range approvals {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t%s\t%s\n",
+			approval.ID, approval.Mapping, approval.SourceDealID, approval.DestBotID, approval.DestPair,
+			approval.Created.Local().Format(time.RFC3339), approval.Expires.Local().Format(time.RFC3339))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jslowik/commacloner/audit"
+	"github.com/jslowik/commacloner/config"
+	"github.com/spf13/cobra"
+)
+
+func commandAudit() *cobra.Command {
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Check the audit log has not been tampered with.",
+	}
+	auditCmd.AddCommand(commandAuditVerify())
+	auditCmd.AddCommand(commandAuditKey())
+	return auditCmd
+}
+
+func commandAuditVerify() *cobra.Command {
+	var keyFile, output string
+	cmd := &cobra.Command{
+		Use:   "verify FILE...",
+		Short: "Follow the hash chain of an audit log, reporting the first broken link.",
+		Long: `Follow the hash chain of an audit log, checking each line carries the hash of the line before it and that
+every checkpoint is signed.  Give rotated files too, oldest first, to follow the chain across them; compressed files
+are read as they are.
+
+The key checkpoints are checked against is given by --key, a file holding either the audit key or the public key
+printed by audit key.  Without it each checkpoint is checked against the key it carries, which only shows the lines
+were not changed by someone without a key of their own.
+
+Exits 1 if the chain is broken.`,
+		Example: "commacloner audit verify --key audit.pub state/audit-2022-03-04T05-06-07.000.jsonl.gz state/audit.jsonl",
+		Run: func(cmd *cobra.Command, args []string) {
+			ok, err := verifyAudit(args, keyFile, output)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			if !ok {
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&keyFile, "key", "", "check checkpoints against this key")
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "output format, \"table\" or \"json\"")
+	return cmd
+}
+
+func commandAuditKey() *cobra.Command {
+	var opts config.Options
+	cmd := &cobra.Command{
+		Use:   "key [ config file ]",
+		Short: "Print the public key audit log checkpoints are signed with.",
+		Long: `Print the public half of the key audit log checkpoints are signed with, generating the key if serve has not
+yet.  Keep it somewhere the audit log's host cannot write to, and give it to audit verify --key.`,
+		Example: "commacloner audit key config.yaml > audit.pub",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := printAuditKey(args, opts); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	return cmd
+}
+
+func printAuditKey(args []string, opts config.Options) error {
+	c, err := loadConfigSection(args, opts, "audit")
+	if err != nil {
+		return err
+	}
+	if c.Audit.KeyFile == "" {
+		return errors.New("no audit key file is configured")
+	}
+	key, err := audit.OpenKey(c.Audit.KeyFile)
+	if err != nil {
+		return err
+	}
+	public, err := audit.EncodePublicKey(key.Public().(ed25519.PublicKey))
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(public)
+	return err
+}
+
+// verifyAudit follows the chain through the files, returning whether it holds
+func verifyAudit(paths []string, keyFile, output string) (bool, error) {
+	if output != outputTable && output != outputJSON {
+		return false, fmt.Errorf("unknown output format %q", output)
+	}
+	if len(paths) == 0 {
+		return false, errors.New("no arguments provided")
+	}
+	var key ed25519.PublicKey
+	if keyFile != "" {
+		public, err := audit.ReadPublicKey(keyFile)
+		if err != nil {
+			return false, err
+		}
+		key = public
+	}
+
+	verification, err := audit.VerifyFiles(key, paths...)
+	if err != nil {
+		return false, err
+	}
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return verification.Broken == nil, enc.Encode(verification)
+	}
+	return verification.Broken == nil, printVerification(os.Stdout, verification, keyFile != "")
+}
+
+func printVerification(out io.Writer, v audit.Verification, pinned bool) error {
+	var lines []string
+	if v.Lines == 0 {
+		lines = append(lines, "no records checked")
+	} else {
+		lines = append(lines, fmt.Sprintf("%d lines checked, seq %d to %d", v.Lines, v.FirstSeq, v.LastSeq))
+	}
+	if v.Continues != "" {
+		lines = append(lines, fmt.Sprintf("the chain carries on from an earlier file, from the line with hash %s", v.Continues))
+	}
+	if v.Checkpoints != 0 {
+		lines = append(lines, fmt.Sprintf("%d checkpoints signed by key %s, the last at seq %d", v.Checkpoints, strings.Join(v.Keys, ", "), v.Signed))
+		if !pinned {
+			lines = append(lines, "checkpoints were checked against the keys they carry, give --key to check them against yours")
+		}
+	}
+	if v.Unsigned != 0 {
+		lines = append(lines, fmt.Sprintf("%d lines after the last checkpoint are not signed", v.Unsigned))
+	}
+	if v.Truncations != 0 {
+		lines = append(lines, fmt.Sprintf("%d lines were cut short and marked truncated when the log was next opened", v.Truncations))
+	}
+	if v.Broken != nil {
+		lines = append(lines, fmt.Sprintf("BROKEN at %s line %d (seq %d): %s", v.Broken.File, v.Broken.Line, v.Broken.Seq, v.Broken.Reason))
+	} else {
+		lines = append(lines, "the chain is intact")
+	}
+	_, err := fmt.Fprintln(out, strings.Join(lines, "\n"))
+	return err
+}
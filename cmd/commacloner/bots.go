@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/api/rest"
+	"github.com/jslowik/commacloner/config"
+	"github.com/spf13/cobra"
+)
+
+// Output formats of the inspection commands
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+func commandBots() *cobra.Command {
+	botsCmd := &cobra.Command{
+		Use:   "bots",
+		Short: "Inspect the bots on the 3Commas account.",
+	}
+	botsCmd.AddCommand(commandBotsList())
+	return botsCmd
+}
+
+func commandBotsList() *cobra.Command {
+	var opts config.Options
+	var output string
+	cmd := &cobra.Command{
+		Use:   "list [ config file ]",
+		Short: "List every bot on the account, marking those used by the config's mappings.",
+		Long: `List every bot on the account the configured API key belongs to.  Bots used by a mapping in the config file
+are marked as a source or destination, and bots whose start condition is not "Manually/API" are flagged as they will
+also open deals of their own.`,
+		Example: "commacloner bots list --output json config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := listBots(args, opts, output); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "output format, \"table\" or \"json\"")
+	return cmd
+}
+
+// loadAPIConfig loads a config file for commands which only talk to the 3Commas API.  Only problems with the api
+// section are fatal, so the commands can be used while the mappings are still being written.
+func loadAPIConfig(args []string, opts config.Options) (config.Config, error) {
+	return loadConfigSection(args, opts, "api")
+}
+
+// loadConfigSection loads a config file for commands which only use one section of it, such as api.  Only problems
+// within that section are fatal; the rest are printed.
+func loadConfigSection(args []string, opts config.Options, section string) (config.Config, error) {
+	switch len(args) {
+	default:
+		return config.Config{}, errors.New("surplus arguments")
+	case 0:
+		return config.Config{}, errors.New("no arguments provided")
+	case 1:
+	}
+
+	c, issues, err := config.Load(args[0], opts)
+	if err != nil {
+		return c, err
+	}
+	var sectionIssues config.Issues
+	for _, issue := range issues {
+		if issue.Path == section || strings.HasPrefix(issue.Path, section+".") {
+			sectionIssues = append(sectionIssues, issue)
+			continue
+		}
+		fmt.Fprintln(os.Stderr, issue)
+	}
+	if err := sectionIssues.Err(); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+// botRole is the part a bot plays in a mapping
+type botRole struct {
+	Mapping string `json:"mapping"`
+	Role    string `json:"role"`
+}
+
+func (r botRole) String() string {
+	return fmt.Sprintf("%s of %s", r.Role, r.Mapping)
+}
+
+// listedBot is a bot as printed by bots list
+type listedBot struct {
+	api.Bot
+	ManualStart bool      `json:"manual_start"`
+	Mappings    []botRole `json:"mappings,omitempty"`
+}
+
+// botRoles indexes the roles each bot plays in the config's mappings by bot id
+func botRoles(c config.Config) map[int][]botRole {
+	roles := make(map[int][]botRole)
+	for _, mapping := range c.Bots {
+		roles[mapping.Source.ID] = append(roles[mapping.Source.ID], botRole{Mapping: mapping.ID, Role: "source"})
+		if !mapping.Destination.Simulated() {
+			roles[mapping.Destination.ID] = append(roles[mapping.Destination.ID], botRole{Mapping: mapping.ID, Role: "dest"})
+		}
+	}
+	return roles
+}
+
+func listBots(args []string, opts config.Options, output string) error {
+	if output != outputTable && output != outputJSON {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+	c, err := loadAPIConfig(args, opts)
+	if err != nil {
+		return err
+	}
+
+	bots, err := rest.ListBots(c.API)
+	if err != nil {
+		return err
+	}
+	sort.Slice(bots, func(i, j int) bool { return bots[i].ID < bots[j].ID })
+
+	roles := botRoles(c)
+	listed := make([]listedBot, 0, len(bots))
+	for _, bot := range bots {
+		listed = append(listed, listedBot{Bot: bot, ManualStart: bot.ManualStart(), Mappings: roles[bot.ID]})
+	}
+
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(listed)
+	}
+	return printBots(os.Stdout, listed)
+}
+
+func printBots(out io.Writer, bots []listedBot) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tACCOUNT\tPAIRS\tSTRATEGY\tENABLED\tACTIVE DEALS\tMANUAL/API\tMAPPINGS")
+	for _, bot := range bots {
+		mappings := make([]string, 0, len(bot.Mappings))
+		for _, role := range bot.Mappings {
+			mappings = append(mappings, role.String())
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			bot.ID, bot.Name, bot.AccountName, strings.Join(bot.Pairs, ","), bot.Strategy,
+			yesNo(bot.IsEnabled), bot.ActiveDealsCount, yesNo(bot.ManualStart), strings.Join(mappings, ", "))
+	}
+	return w.Flush()
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/preflight"
+	"github.com/spf13/cobra"
+)
+
+func commandCheck() *cobra.Command {
+	var opts config.Options
+	cmd := &cobra.Command{
+		Use:   "check [ config file ]",
+		Short: "Check a config file against the 3Commas account, printing every problem found.",
+		Long: `Check a config file against the 3Commas account its API key belongs to.  The key must be accepted and have
+the bots read and write permissions, and every bot used by a mapping must exist.  Destination bots which do not start
+deals "Manually/API", are disabled, or do not trade some of their source bot's pairs (after overrides) are reported as
+warnings.  The exit status is 1 if a problem would stop deals being cloned.`,
+		Example: "commacloner check config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			ok, err := checkConfig(args, opts)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			if !ok {
+				os.Exit(1)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	return cmd
+}
+
+func checkConfig(args []string, opts config.Options) (bool, error) {
+	switch len(args) {
+	default:
+		return false, errors.New("surplus arguments")
+	case 0:
+		return false, errors.New("no arguments provided")
+	case 1:
+	}
+
+	c, issues, err := config.Load(args[0], opts)
+	if err != nil {
+		return false, err
+	}
+	if err := issues.Err(); err != nil {
+		return false, err
+	}
+	issues = append(issues, preflight.Run(c)...)
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	if len(issues.Errors()) != 0 {
+		return false, nil
+	}
+	fmt.Printf("%s: ok\n", args[0])
+	return true, nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jslowik/commacloner/config"
+	"github.com/spf13/cobra"
+)
+
+func commandConfig() *cobra.Command {
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect and validate configuration files.",
+	}
+	configCmd.AddCommand(commandConfigValidate())
+	configCmd.AddCommand(commandConfigSchema())
+	configCmd.AddCommand(commandConfigPrint())
+	configCmd.AddCommand(commandConfigMigrate())
+	return configCmd
+}
+
+func commandConfigValidate() *cobra.Command {
+	var opts config.Options
+	var resolveSecrets bool
+	cmd := &cobra.Command{
+		Use:   "validate [ config file ]",
+		Short: "Validate a config file, printing every problem found.",
+		Long: `Validate a config file, printing every problem found.  Secret references are only checked to be well formed:
+no secret file is read and no exec: helper is run, so an untrusted file can be validated safely, unless
+--resolve-secrets is given.`,
+		Example: "commacloner config validate config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.CheckSecretsOnly = !resolveSecrets
+			ok, err := validateConfig(args, opts)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			if !ok {
+				os.Exit(1)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	addResolveSecretsFlag(cmd, &resolveSecrets)
+	return cmd
+}
+
+// addResolveSecretsFlag registers the flag which makes a command resolve secret references rather than only check them
+func addResolveSecretsFlag(cmd *cobra.Command, resolveSecrets *bool) {
+	cmd.Flags().BoolVar(resolveSecrets, "resolve-secrets", false, "resolve secret references, reading secret files and running exec: helpers")
+}
+
+// addLoadFlags registers the flags controlling how config files are loaded.  Overrides are read from the
+// environment and --set flags, with flags taking precedence.
+func addLoadFlags(cmd *cobra.Command, opts *config.Options) {
+	cmd.Flags().BoolVar(&opts.Lenient, "lenient", false, "report unknown config keys as warnings instead of errors")
+	cmd.Flags().StringArrayVar(&opts.Set, "set", nil, "override a config value, ie --set logging.level=debug (repeatable)")
+	opts.Passphrase = promptPassphrase
+	opts.Environ = os.Environ()
+}
+
+func validateConfig(args []string, opts config.Options) (bool, error) {
+	switch len(args) {
+	default:
+		return false, errors.New("surplus arguments")
+	case 0:
+		return false, errors.New("no arguments provided")
+	case 1:
+	}
+
+	_, issues, err := config.Load(args[0], opts)
+	if err != nil {
+		return false, err
+	}
+	for _, issue := range issues {
+		fmt.Println(issue)
+	}
+	if len(issues.Errors()) != 0 {
+		return false, nil
+	}
+	fmt.Printf("%s: ok\n", args[0])
+	return true, nil
+}
+
+func commandConfigSchema() *cobra.Command {
+	return &cobra.Command{
+		Use:     "schema",
+		Short:   "Print a JSON Schema describing the config file.",
+		Example: "commacloner config schema > commacloner.schema.json",
+		Run: func(cmd *cobra.Command, args []string) {
+			schema, err := config.Schema()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			fmt.Println(string(schema))
+		},
+	}
+}
+
+func commandConfigPrint() *cobra.Command {
+	var opts config.Options
+	var effective, resolveSecrets bool
+	cmd := &cobra.Command{
+		Use:   "print [ config file ]",
+		Short: "Print a config file with secrets redacted.",
+		Long: `Print a config file, including any included mapping files, with secrets redacted.  With --effective,
+environment and --set overrides and built-in defaults are applied, and each value which did not come from the file is
+annotated with its source.  Secret references are only checked, as by validate, unless --resolve-secrets is given.`,
+		Example: "commacloner config print --effective --set logging.level=info config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			opts.CheckSecretsOnly = !resolveSecrets
+			if !effective {
+				opts.Environ, opts.Set, opts.NoDefaults = nil, nil, true
+			}
+			if err := printConfig(args, opts); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	cmd.Flags().BoolVar(&effective, "effective", false, "apply environment and --set overrides and defaults")
+	addResolveSecretsFlag(cmd, &resolveSecrets)
+	return cmd
+}
+
+func printConfig(args []string, opts config.Options) error {
+	switch len(args) {
+	default:
+		return errors.New("surplus arguments")
+	case 0:
+		return errors.New("no arguments provided")
+	case 1:
+	}
+
+	c, issues, err := config.Load(args[0], opts)
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+	}
+	out, err := c.Print()
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(out))
+	return nil
+}
+
+func commandConfigMigrate() *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "migrate [ config file ]",
+		Short: "Upgrade a config file and its included mapping files to the current schema version.",
+		Long: `Upgrade a config file and every mapping file it includes to the current schema version.  The original
+contents of each file changed are kept alongside it as FILE.vN.bak, where N is the version it was upgraded from.`,
+		Example: "commacloner config migrate --dry-run config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := migrateConfig(args, dryRun); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "report the changes without writing any files")
+	return cmd
+}
+
+func migrateConfig(args []string, dryRun bool) error {
+	switch len(args) {
+	default:
+		return errors.New("surplus arguments")
+	case 0:
+		return errors.New("no arguments provided")
+	case 1:
+	}
+
+	migrated, err := config.Migrate(args[0], dryRun)
+	for _, m := range migrated {
+		fmt.Printf("%s: version %d -> %d\n", m.File, m.From, config.CurrentVersion)
+		for _, applied := range m.Applied {
+			fmt.Printf("  %s\n", applied)
+		}
+		if m.Backup != "" {
+			fmt.Printf("  original saved to %s\n", m.Backup)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(migrated) == 0 {
+		fmt.Printf("%s: already at version %d\n", args[0], config.CurrentVersion)
+	}
+	return nil
+}
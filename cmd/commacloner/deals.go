@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/api/rest"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/state"
+	"github.com/spf13/cobra"
+)
+
+func commandDeals() *cobra.Command {
+	dealsCmd := &cobra.Command{
+		Use:   "deals",
+		Short: "Inspect the deals on the 3Commas account.",
+	}
+	dealsCmd.AddCommand(commandDealsList())
+	dealsCmd.AddCommand(commandDealsShow())
+	return dealsCmd
+}
+
+// dealsListOptions are the filters and output format of deals list
+type dealsListOptions struct {
+	bots     []int
+	mappings []string
+	status   string
+	since    string
+	until    string
+	limit    int
+	output   string
+}
+
+func commandDealsList() *cobra.Command {
+	var opts config.Options
+	var list dealsListOptions
+	cmd := &cobra.Command{
+		Use:   "list [ config file ]",
+		Short: "List deals, most recent first.",
+		Long: `List deals, most recent first.  Deals can be filtered by bot, by the bots used in a mapping, by status and
+by when they were created.  Times are given as RFC 3339 timestamps, dates (2006-01-02) or durations before now (24h).
+Deals linked to a source or destination deal by serve are shown with the deal they are linked to.`,
+		Example: "commacloner deals list --mapping my_first_mapping --status active --since 24h config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := listDeals(args, opts, list); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	cmd.Flags().IntSliceVar(&list.bots, "bot", nil, "only list deals of these bot ids (repeatable)")
+	cmd.Flags().StringSliceVar(&list.mappings, "mapping", nil, "only list deals of the source and destination bots of these mappings (repeatable)")
+	cmd.Flags().StringVar(&list.status, "status", "", "only list deals with this status, one of "+strings.Join(rest.DealScopes, ", "))
+	cmd.Flags().StringVar(&list.since, "since", "", "only list deals created at or after this time")
+	cmd.Flags().StringVar(&list.until, "until", "", "only list deals created before this time")
+	cmd.Flags().IntVar(&list.limit, "limit", 50, "the most deals to list, 0 for no limit")
+	cmd.Flags().StringVarP(&list.output, "output", "o", outputTable, "output format, \"table\" or \"json\"")
+	return cmd
+}
+
+// parseTime parses a time given on the command line as an RFC 3339 timestamp, a date, or a duration before now
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected a timestamp, date or duration", value)
+}
+
+// filters builds the filters to list deals with, one per bot
+func (o dealsListOptions) filters(c config.Config, now time.Time) ([]rest.DealFilter, error) {
+	var base rest.DealFilter
+	var err error
+	if o.status != "" {
+		valid := false
+		for _, scope := range rest.DealScopes {
+			valid = valid || scope == o.status
+		}
+		if !valid {
+			return nil, fmt.Errorf("unknown status %q, expected one of %s", o.status, strings.Join(rest.DealScopes, ", "))
+		}
+		base.Scope = o.status
+	}
+	if base.From, err = parseTime(o.since, now); err != nil {
+		return nil, err
+	}
+	if base.To, err = parseTime(o.until, now); err != nil {
+		return nil, err
+	}
+	base.Limit = o.limit
+
+	bots := append([]int(nil), o.bots...)
+	for _, id := range o.mappings {
+		found := false
+		for _, mapping := range c.Bots {
+			if mapping.ID == id {
+				bots = append(bots, mapping.Source.ID)
+				if !mapping.Destination.Simulated() {
+					bots = append(bots, mapping.Destination.ID)
+				}
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no mapping with id %q", id)
+		}
+	}
+	if len(bots) == 0 {
+		return []rest.DealFilter{base}, nil
+	}
+
+	var filters []rest.DealFilter
+	seen := make(map[int]bool)
+	for _, bot := range bots {
+		if seen[bot] {
+			continue
+		}
+		seen[bot] = true
+		filter := base
+		filter.BotID = bot
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// listedDeal is a deal as printed by deals list
+type listedDeal struct {
+	api.Deal
+	Links []state.Link `json:"links,omitempty"`
+}
+
+func listDeals(args []string, opts config.Options, list dealsListOptions) error {
+	if list.output != outputTable && list.output != outputJSON {
+		return fmt.Errorf("unknown output format %q", list.output)
+	}
+	c, err := loadAPIConfig(args, opts)
+	if err != nil {
+		return err
+	}
+	filters, err := list.filters(c, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var deals []api.Deal
+	for _, filter := range filters {
+		found, err := rest.ListDeals(c.API, filter)
+		if err != nil {
+			return err
+		}
+		deals = append(deals, found...)
+	}
+	sort.SliceStable(deals, func(i, j int) bool { return deals[i].CreatedAt.After(deals[j].CreatedAt) })
+	if list.limit != 0 && len(deals) > list.limit {
+		deals = deals[:list.limit]
+	}
+
+	links, err := dealLinks(c)
+	if err != nil {
+		return err
+	}
+	listed := make([]listedDeal, 0, len(deals))
+	for _, deal := range deals {
+		listed = append(listed, listedDeal{Deal: deal, Links: links[deal.ID]})
+	}
+
+	if list.output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(listed)
+	}
+	return printDeals(os.Stdout, listed)
+}
+
+// dealLinks indexes the links recorded by serve by both their source and destination deal ids.  It is empty when
+// there is no link store.
+func dealLinks(c config.Config) (map[int][]state.Link, error) {
+	index := make(map[int][]state.Link)
+	store, err := state.ReadLinks(c.State.Dir)
+	if err != nil || store == nil {
+		return index, err
+	}
+	links, err := store.All()
+	if err != nil {
+		return index, err
+	}
+	for _, link := range links {
+		index[link.SourceDealID] = append(index[link.SourceDealID], link)
+		index[link.DestDealID] = append(index[link.DestDealID], link)
+	}
+	return index, nil
+}
+
+// linkedDeal returns the deal at the other end of a link from dealID and the role it plays
+func linkedDeal(link state.Link, dealID int) (int, string) {
+	if link.SourceDealID == dealID {
+		return link.DestDealID, "dest"
+	}
+	return link.SourceDealID, "source"
+}
+
+func printDeals(out io.Writer, deals []listedDeal) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tBOT\tPAIR\tSTATUS\tCREATED\tCLOSED\tPROFIT\tLINKED")
+	for _, deal := range deals {
+		closed := ""
+		if deal.ClosedAt != nil {
+			closed = deal.ClosedAt.Local().Format(time.RFC3339)
+		}
+		linked := make([]string, 0, len(deal.Links))
+		for _, link := range deal.Links {
+			id, role := linkedDeal(link, deal.ID)
+			linked = append(linked, fmt.Sprintf("%s %d (%s)", role, id, link.Mapping))
+		}
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			deal.ID, deal.BotID, deal.Pair, deal.Status, deal.CreatedAt.Local().Format(time.RFC3339), closed,
+			deal.FinalProfit, strings.Join(linked, ", "))
+	}
+	return w.Flush()
+}
+
+func commandDealsShow() *cobra.Command {
+	var opts config.Options
+	cmd := &cobra.Command{
+		Use:   "show [ deal id ] [ config file ]",
+		Short: "Print a deal in full, along with the deals linked to it.",
+		Long: `Print a deal in full as returned by 3Commas.  If serve recorded the deal as the source or destination of a
+clone, the deals linked to it are printed alongside.`,
+		Example: "commacloner deals show 123456 config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := showDeal(args, opts); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	return cmd
+}
+
+// shownLink is a deal linked to the deal printed by deals show
+type shownLink struct {
+	Mapping string          `json:"mapping"`
+	Role    string          `json:"role"`
+	ID      int             `json:"id"`
+	Deal    json.RawMessage `json:"deal,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+func showDeal(args []string, opts config.Options) error {
+	if len(args) == 0 {
+		return errors.New("no arguments provided")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid deal id %q", args[0])
+	}
+	c, err := loadAPIConfig(args[1:], opts)
+	if err != nil {
+		return err
+	}
+
+	_, raw, err := rest.GetDeal(c.API, id)
+	if err != nil {
+		return err
+	}
+	links, err := dealLinks(c)
+	if err != nil {
+		return err
+	}
+
+	shown := struct {
+		Deal  json.RawMessage `json:"deal"`
+		Links []shownLink     `json:"links,omitempty"`
+	}{Deal: raw}
+	for _, link := range links[id] {
+		linkedID, role := linkedDeal(link, id)
+		s := shownLink{Mapping: link.Mapping, Role: role, ID: linkedID}
+		if _, s.Deal, err = rest.GetDeal(c.API, linkedID); err != nil {
+			s.Error = err.Error()
+		}
+		shown.Links = append(shown.Links, s)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(shown)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jslowik/commacloner/admin"
+	"github.com/jslowik/commacloner/api/rest"
+	"github.com/jslowik/commacloner/audit"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/flatten"
+	"github.com/jslowik/commacloner/monitor"
+	"github.com/jslowik/commacloner/pause"
+	"github.com/jslowik/commacloner/state"
+	"github.com/spf13/cobra"
+)
+
+// flattenOptions control what flatten closes and how it reports it
+type flattenOptions struct {
+	flatten.Options
+	yes    bool
+	report string
+}
+
+// flattenReport is the report flatten writes, along with how serve was paused first: through the sentinel file in the
+// state directory, and through the admin server of the running serve if one is configured.  AuditError is the first
+// error keeping the flatten audit log, which never stops the flatten.
+type flattenReport struct {
+	flatten.Report
+	Sentinel      string `json:"sentinel,omitempty"`
+	SentinelError string `json:"sentinel_error,omitempty"`
+	Paused        bool   `json:"paused"`
+	PauseError    string `json:"pause_error,omitempty"`
+	AuditError    string `json:"audit_error,omitempty"`
+}
+
+func commandFlatten() *cobra.Command {
+	var opts config.Options
+	var flattenOpts flattenOptions
+	cmd := &cobra.Command{
+		Use:   "flatten [ config file ]",
+		Short: "Panic sell every open destination deal commacloner started and disable the destination bots.",
+		Long: `For emergencies: disable the destination bots of every mapping, or of those given with --mapping, so they open
+no new deals, then panic sell the deals open on them which serve started, as recorded in the state directory.  With
+--cancel the deals are cancelled instead, leaving the positions they hold.  With --all-deals every open deal on the
+destination bots is closed, whether or not serve recorded starting it, for when the state directory has been lost.
+
+The bots and deals are listed and confirmation asked for before anything is done, unless --yes is given.  The mappings
+are then paused so serve starts nothing more, by writing a PAUSE file to the state directory and, if an admin server
+is configured, through the running serve.  The PAUSE file stays until it is removed.  Once the bots are disabled their
+open deals are listed again and closed.  A JSON report of what was done is printed, or written to --report.  If an
+audit log is configured, each bot and deal is recorded in a flatten audit log of its own beside it, with its own
+chain, so a running serve can keep appending to its log; a flatten audit log which cannot be written is reported but
+never stops the flatten.`,
+		Example: "commacloner flatten --mapping my_first_mapping config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := flattenDeals(args, opts, flattenOpts); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	cmd.Flags().StringSliceVar(&flattenOpts.Mappings, "mapping", nil, "only flatten these mappings (repeatable)")
+	cmd.Flags().BoolVar(&flattenOpts.Cancel, "cancel", false, "cancel the deals instead of panic selling them")
+	cmd.Flags().BoolVar(&flattenOpts.AllDeals, "all-deals", false, "close every open deal on the destination bots, not only those serve started")
+	cmd.Flags().BoolVarP(&flattenOpts.yes, "yes", "y", false, "do not ask for confirmation")
+	cmd.Flags().StringVar(&flattenOpts.report, "report", "", "write the JSON report to this file instead of printing it")
+	return cmd
+}
+
+func flattenDeals(args []string, opts config.Options, flattenOpts flattenOptions) error {
+	switch len(args) {
+	default:
+		return errors.New("surplus arguments")
+	case 0:
+		return errors.New("no arguments provided")
+	case 1:
+	}
+	c, issues, err := config.Load(args[0], opts)
+	if err != nil {
+		return err
+	}
+	if err := issues.Err(); err != nil {
+		return err
+	}
+	for _, warning := range issues.Warnings() {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+
+	var links []state.Link
+	store, err := state.ReadLinks(c.State.Dir)
+	if err != nil {
+		return err
+	}
+	if store != nil {
+		if links, err = store.All(); err != nil {
+			return err
+		}
+	}
+	if len(links) == 0 && !flattenOpts.AllDeals {
+		fmt.Fprintf(os.Stderr, "no deals started by serve are recorded in %s, pass --all-deals to close every open deal on the destination bots\n", c.State.Dir)
+	}
+
+	plan, err := flatten.NewPlan(c, links, flattenOpts.Options)
+	if err != nil {
+		return err
+	}
+	if len(plan.Bots) == 0 {
+		fmt.Fprintln(os.Stderr, "no destination bots to flatten")
+		return nil
+	}
+	if err := printFlattenPlan(os.Stderr, plan); err != nil {
+		return err
+	}
+
+	report := flattenReport{}
+	auditLog, err := audit.Open(flattenAudit(c.Audit))
+	if err != nil {
+		report.AuditError = err.Error()
+		fmt.Fprintf(os.Stderr, "could not open the flatten audit log, flattening without it: %v\n", err)
+	}
+
+	question := fmt.Sprintf("Disable %d bots and %s %d deals?", len(plan.Bots), strings.Replace(string(plan.Action), "_", " ", -1), len(plan.Deals))
+	if !flattenOpts.yes && !newPrompter(os.Stdin, os.Stderr).confirm(question, false) {
+		auditLog.Close()
+		return errors.New("nothing was flattened")
+	}
+
+	if report.Sentinel, err = pause.WriteSentinel(c.State.Dir, flattenOpts.Mappings); err != nil {
+		report.Sentinel, report.SentinelError = "", err.Error()
+		fmt.Fprintf(os.Stderr, "could not pause serve: %v\n", err)
+	} else {
+		fmt.Fprintf(os.Stderr, "paused serve with %s, remove it to resume\n", report.Sentinel)
+	}
+	if c.Admin.Listen != "" {
+		report.Paused, report.PauseError = pauseForFlatten(c.Admin, flattenOpts.Mappings)
+		if report.PauseError != "" {
+			fmt.Fprintf(os.Stderr, "could not pause the running serve: %s\n", report.PauseError)
+		}
+	}
+	report.Report = plan.Execute(c, links, flattenOpts.Options)
+	if err := auditFlatten(auditLog, c, report.Report); err != nil && report.AuditError == "" {
+		report.AuditError = err.Error()
+	}
+
+	if err := writeFlattenReport(report, flattenOpts.report); err != nil {
+		return err
+	}
+	if failures := report.Failures(); failures != 0 {
+		return fmt.Errorf("%d bots or deals could not be flattened, see the report", failures)
+	}
+	return nil
+}
+
+// flattenAudit configures the flatten audit log: the audit log with "flatten-" before its file name, ie
+// "state/flatten-audit.jsonl", signed with the same key.  flatten keeps a chain of its own because a running serve may
+// be appending to the audit log at the same time.
+func flattenAudit(c config.Audit) config.Audit {
+	if c.Path != "" {
+		c.Path = filepath.Join(filepath.Dir(c.Path), "flatten-"+filepath.Base(c.Path))
+	}
+	return c
+}
+
+// auditFlatten writes an audit record for every bot flatten disabled and deal it closed, or tried to, and closes the
+// audit log.  Records which cannot be written are reported and skipped, returning the first error.
+func auditFlatten(auditLog *audit.Log, c config.Config, report flatten.Report) error {
+	var firstErr error
+	failed := func(err error) {
+		fmt.Fprintf(os.Stderr, "could not write to the flatten audit log: %v\n", err)
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	mappings := make(map[string]config.BotMapping)
+	for _, mapping := range c.Bots {
+		mappings[mapping.ID] = mapping
+	}
+	for _, bot := range report.Bots {
+		err := auditLog.Write(audit.Record{
+			Mapping: mappings[bot.Mappings[0]],
+			Calls:   []rest.Call{bot.Call},
+			Outcome: monitor.OutcomeFlattened,
+			Reason:  fmt.Sprintf("disable bot %d", bot.BotID),
+			Error:   bot.Error,
+		})
+		if err != nil {
+			failed(err)
+		}
+	}
+	for _, deal := range report.Deals {
+		reason := fmt.Sprintf("close deal %d", deal.DealID)
+		if !deal.Linked {
+			reason += ", not started by serve"
+		}
+		err := auditLog.Write(audit.Record{
+			Mapping:    mappings[deal.Mapping],
+			DestPair:   deal.Pair,
+			Calls:      []rest.Call{deal.Call},
+			Outcome:    monitor.OutcomeFlattened,
+			Reason:     reason,
+			Action:     report.Action,
+			Error:      deal.Error,
+			DestDealID: deal.DealID,
+		})
+		if err != nil {
+			failed(err)
+		}
+	}
+	if err := auditLog.Close(); err != nil {
+		failed(err)
+	}
+	return firstErr
+}
+
+// pauseForFlatten pauses the mappings, or every mapping, in the running serve, returning the error as a string for
+// the report
+func pauseForFlatten(c config.Admin, mappings []string) (bool, string) {
+	client, err := admin.NewClient(c)
+	if err != nil {
+		return false, err.Error()
+	}
+	if len(mappings) == 0 {
+		mappings = []string{""}
+	}
+	for _, mapping := range mappings {
+		if _, err := client.Pause(mapping); err != nil {
+			return false, err.Error()
+		}
+	}
+	return true, ""
+}
+
+func printFlattenPlan(out io.Writer, plan flatten.Plan) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "BOT\tMAPPINGS\tACTION")
+	for _, bot := range plan.Bots {
+		fmt.Fprintf(w, "%d\t%s\tdisable\n", bot.BotID, strings.Join(bot.Mappings, ", "))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "DEAL\tBOT\tMAPPING\tPAIR\tSTARTED BY SERVE\tACTION")
+	for _, deal := range plan.Deals {
+		fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%s\n", deal.DealID, deal.BotID, deal.Mapping, deal.Pair, yesNo(deal.Linked), plan.Action)
+	}
+	return w.Flush()
+}
+
+// writeFlattenReport prints the report, or writes it to path if one is given
+func writeFlattenReport(report flattenReport, path string) error {
+	out := io.Writer(os.Stdout)
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return fmt.Errorf("could not write report: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return fmt.Errorf("could not write report: %v", err)
+	}
+	if path != "" {
+		fmt.Fprintf(os.Stderr, "report written to %s\n", path)
+	}
+	return nil
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/api/rest"
+	"github.com/jslowik/commacloner/config"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// defaultConfigFile is the file init writes when none is given
+const defaultConfigFile = "config.yaml"
+
+// initOptions are the flags of init
+type initOptions struct {
+	nonInteractive bool
+	key            string
+	secret         string
+	mappings       []string
+	encrypt        bool
+	noVerify       bool
+	force          bool
+	restURL        string
+}
+
+func commandInit() *cobra.Command {
+	var opts initOptions
+	cmd := &cobra.Command{
+		Use:   "init [ config file ]",
+		Short: "Write a new config file, interactively or from flags.",
+		Long: `Write a new config file.  The API credentials are checked by listing the bots on the account, which are
+then offered as the source and destination of each mapping.
+
+With --non-interactive every setting comes from flags, and each mapping is given as a --map of comma separated
+key=value settings: source and dest (bot ids, required), id, quote, base and on_unavailable.`,
+		Example: `commacloner init
+commacloner init --non-interactive --key KEY --secret SECRET --map source=1234,dest=5678,quote=USD config.yaml`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := initConfig(args, opts); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&opts.nonInteractive, "non-interactive", false, "take every setting from flags instead of prompting")
+	cmd.Flags().StringVar(&opts.key, "key", "", "the 3Commas API key")
+	cmd.Flags().StringVar(&opts.secret, "secret", "", "the 3Commas API secret")
+	cmd.Flags().StringArrayVar(&opts.mappings, "map", nil, "a bot mapping, ie source=1234,dest=5678,quote=USD (repeatable)")
+	cmd.Flags().BoolVar(&opts.encrypt, "encrypt", false, "encrypt the key and secret with a passphrase")
+	cmd.Flags().BoolVar(&opts.noVerify, "no-verify", false, "do not check the credentials or bot ids against 3Commas")
+	cmd.Flags().BoolVar(&opts.force, "force", false, "overwrite an existing config file")
+	cmd.Flags().StringVar(&opts.restURL, "rest-url", config.DefaultRestURL, "the 3Commas REST API endpoint")
+	return cmd
+}
+
+func initConfig(args []string, opts initOptions) error {
+	path := defaultConfigFile
+	switch len(args) {
+	default:
+		return errors.New("surplus arguments")
+	case 1:
+		path = args[0]
+	case 0:
+	}
+	if _, err := os.Stat(path); err == nil && !opts.force {
+		return fmt.Errorf("%s already exists, pass --force to overwrite it", path)
+	}
+
+	p := newPrompter(os.Stdin, os.Stderr)
+	c := config.Config{
+		API:     config.API{WebsocketURL: config.DefaultWebsocketURL, RestURL: opts.restURL},
+		Logging: config.Logger{Level: "info", Format: "console", Destination: "console"},
+	}
+
+	var err error
+	if c.API.Key, c.API.Secret, err = opts.credentials(p); err != nil {
+		return err
+	}
+
+	var bots []api.Bot
+	if !opts.noVerify {
+		if bots, err = rest.ListBots(c.API); err != nil {
+			return fmt.Errorf("could not verify the API credentials: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "credentials ok, found %d bots\n", len(bots))
+	}
+
+	if opts.nonInteractive {
+		c.Bots, err = parseMappingSpecs(opts.mappings, bots, opts.noVerify)
+	} else {
+		c.Bots, err = promptMappings(p, bots, opts.noVerify)
+	}
+	if err != nil {
+		return err
+	}
+
+	var passphrase string
+	if opts.encrypt || !opts.nonInteractive && p.confirm("Encrypt the API key and secret with a passphrase?", false) {
+		if passphrase, err = readPassphrase(true); err != nil {
+			return err
+		}
+		if c.API.Key, err = config.EncryptSecret(c.API.Key, passphrase); err != nil {
+			return err
+		}
+		if c.API.Secret, err = config.EncryptSecret(c.API.Secret, passphrase); err != nil {
+			return err
+		}
+	}
+
+	data, err := config.Generate(c)
+	if err != nil {
+		return err
+	}
+	_, issues, err := config.Parse(path, data, config.Options{Passphrase: func() (string, error) { return passphrase, nil }})
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+	}
+	if err := issues.Err(); err != nil {
+		return fmt.Errorf("the generated config is not valid: %v", err)
+	}
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %s, start cloning with: commacloner serve %s\n", path, path)
+	return nil
+}
+
+// credentials returns the API key and secret from the flags, prompting for any which are missing
+func (o initOptions) credentials(p *prompter) (string, string, error) {
+	key, secret := o.key, o.secret
+	if o.nonInteractive {
+		if key == "" || secret == "" {
+			return "", "", errors.New("--key and --secret are required with --non-interactive")
+		}
+		return key, secret, nil
+	}
+
+	var err error
+	for key == "" {
+		if key, err = p.ask("3Commas API key", ""); err != nil {
+			return "", "", err
+		}
+	}
+	for secret == "" {
+		if secret, err = p.askSecret("3Commas API secret"); err != nil {
+			return "", "", err
+		}
+	}
+	return key, secret, nil
+}
+
+// parseMappingSpecs builds the mappings given with --map.  Bot ids are checked against the bots on the account
+// unless verification was skipped.
+func parseMappingSpecs(specs []string, bots []api.Bot, noVerify bool) ([]config.BotMapping, error) {
+	if len(specs) == 0 {
+		return nil, errors.New("at least one --map is required with --non-interactive")
+	}
+	var mappings []config.BotMapping
+	for _, spec := range specs {
+		mapping, err := parseMappingSpec(spec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --map %q: %v", spec, err)
+		}
+		if !noVerify {
+			for _, id := range []int{mapping.Source.ID, mapping.Destination.ID} {
+				if findBot(bots, id) == nil {
+					return nil, fmt.Errorf("invalid --map %q: no bot with id %d on the account", spec, id)
+				}
+			}
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+// parseMappingSpec parses a mapping given as comma separated key=value settings
+func parseMappingSpec(spec string) (config.BotMapping, error) {
+	var mapping config.BotMapping
+	for _, setting := range strings.Split(spec, ",") {
+		kv := strings.SplitN(setting, "=", 2)
+		if len(kv) != 2 {
+			return mapping, fmt.Errorf("expected key=value, got %q", setting)
+		}
+		key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+		var err error
+		switch key {
+		case "id":
+			mapping.ID = value
+		case "source":
+			mapping.Source.ID, err = strconv.Atoi(value)
+		case "dest":
+			mapping.Destination.ID, err = strconv.Atoi(value)
+		case "quote":
+			mapping.Overrides.QuoteCurrency = value
+		case "base":
+			mapping.Overrides.BaseCurrency = value
+		case "on_unavailable":
+			mapping.Overrides.OnUnavailable.Default = config.UnavailableAction(value)
+		default:
+			return mapping, fmt.Errorf("unknown setting %q", key)
+		}
+		if err != nil {
+			return mapping, fmt.Errorf("invalid %s bot id %q", key, value)
+		}
+	}
+	if mapping.Source.ID == 0 || mapping.Destination.ID == 0 {
+		return mapping, errors.New("source and dest are required")
+	}
+	if mapping.ID == "" {
+		mapping.ID = fmt.Sprintf("%d_to_%d", mapping.Source.ID, mapping.Destination.ID)
+	}
+	return mapping, nil
+}
+
+// promptMappings asks for each mapping in turn, offering the bots on the account
+func promptMappings(p *prompter, bots []api.Bot, noVerify bool) ([]config.BotMapping, error) {
+	if len(bots) != 0 {
+		sort.Slice(bots, func(i, j int) bool { return bots[i].ID < bots[j].ID })
+		listed := make([]listedBot, 0, len(bots))
+		for _, bot := range bots {
+			listed = append(listed, listedBot{Bot: bot, ManualStart: bot.ManualStart()})
+		}
+		if err := printBots(p.out, listed); err != nil {
+			return nil, err
+		}
+	}
+
+	var mappings []config.BotMapping
+	for {
+		question := "Source bot id (empty when done)"
+		if len(mappings) == 0 {
+			question = "Source bot id"
+		}
+		source, err := p.askBot(question, bots, noVerify, len(mappings) != 0)
+		if err != nil {
+			return nil, err
+		}
+		if source == 0 {
+			return mappings, nil
+		}
+		dest, err := p.askBot("Destination bot id", bots, noVerify, false)
+		if err != nil {
+			return nil, err
+		}
+		if bot := findBot(bots, dest); bot != nil && !bot.ManualStart() {
+			fmt.Fprintf(p.out, "warning: bot %d does not start deals \"Manually/API\" and will also open deals of its own\n", dest)
+		}
+
+		mapping := config.BotMapping{Source: config.BotConfig{ID: source}, Destination: config.BotConfig{ID: dest}}
+		if mapping.ID, err = p.ask("Mapping id", fmt.Sprintf("%d_to_%d", source, dest)); err != nil {
+			return nil, err
+		}
+		if mapping.Overrides.QuoteCurrency, err = p.ask("Override the quote currency (ie USD, empty to keep it)", ""); err != nil {
+			return nil, err
+		}
+		if mapping.Overrides.BaseCurrency, err = p.ask("Override the base currency (empty to keep it)", ""); err != nil {
+			return nil, err
+		}
+		action := config.UnavailableAction("")
+		for !action.Valid() {
+			answer, err := p.ask("When a deal cannot be cloned: ignore, cancel, panic_sell, close_at_market_after_delay, "+
+				"disable_source_bot or notify_only", string(config.ActionIgnore))
+			if err != nil {
+				return nil, err
+			}
+			if action = config.UnavailableAction(answer); !action.Valid() {
+				fmt.Fprintf(p.out, "unknown action %q\n", answer)
+			}
+		}
+		if action != config.ActionIgnore {
+			mapping.Overrides.OnUnavailable.Default = action
+		}
+		mappings = append(mappings, mapping)
+	}
+}
+
+func findBot(bots []api.Bot, id int) *api.Bot {
+	for i := range bots {
+		if bots[i].ID == id {
+			return &bots[i]
+		}
+	}
+	return nil
+}
+
+// prompter asks questions on the terminal
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	// fd is the file descriptor of the input, used to read secrets without echoing them
+	fd int
+}
+
+func newPrompter(in *os.File, out io.Writer) *prompter {
+	return &prompter{in: bufio.NewReader(in), out: out, fd: int(in.Fd())}
+}
+
+// ask prompts for a line of input, returning def if it is empty
+func (p *prompter) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, err := p.in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("could not read answer: %v", err)
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+// askSecret prompts for a value without echoing it when reading from a terminal
+func (p *prompter) askSecret(question string) (string, error) {
+	if !term.IsTerminal(p.fd) {
+		return p.ask(question, "")
+	}
+	fmt.Fprintf(p.out, "%s: ", question)
+	value, err := term.ReadPassword(p.fd)
+	fmt.Fprintln(p.out)
+	return strings.TrimSpace(string(value)), err
+}
+
+// confirm asks a yes or no question
+func (p *prompter) confirm(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer, err := p.ask(fmt.Sprintf("%s (%s)", question, hint), "")
+	if err != nil || answer == "" {
+		return def
+	}
+	return strings.HasPrefix(strings.ToLower(answer), "y")
+}
+
+// askBot prompts for a bot id until one on the account is given.  Zero is returned for an empty answer when
+// optional is set.
+func (p *prompter) askBot(question string, bots []api.Bot, noVerify, optional bool) (int, error) {
+	for {
+		answer, err := p.ask(question, "")
+		if err != nil {
+			return 0, err
+		}
+		if answer == "" {
+			if optional {
+				return 0, nil
+			}
+			continue
+		}
+		id, err := strconv.Atoi(answer)
+		if err != nil {
+			fmt.Fprintf(p.out, "%q is not a bot id\n", answer)
+			continue
+		}
+		if !noVerify && findBot(bots, id) == nil {
+			fmt.Fprintf(p.out, "no bot with id %d on the account\n", id)
+			continue
+		}
+		return id, nil
+	}
+}
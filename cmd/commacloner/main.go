@@ -19,7 +19,22 @@ func commandRoot() *cobra.Command {
 			os.Exit(0)
 		},
 	}
+	rootCmd.AddCommand(commandInit())
 	rootCmd.AddCommand(commandServe())
+	rootCmd.AddCommand(commandCheck())
+	rootCmd.AddCommand(commandRecord())
+	rootCmd.AddCommand(commandReplay())
+	rootCmd.AddCommand(commandConfig())
+	rootCmd.AddCommand(commandSecrets())
+	rootCmd.AddCommand(commandBots())
+	rootCmd.AddCommand(commandDeals())
+	rootCmd.AddCommand(commandSim())
+	rootCmd.AddCommand(commandApprovals())
+	rootCmd.AddCommand(commandPause())
+	rootCmd.AddCommand(commandResume())
+	rootCmd.AddCommand(commandFlatten())
+	rootCmd.AddCommand(commandStatus())
+	rootCmd.AddCommand(commandAudit())
 	rootCmd.AddCommand(commandVersion())
 	return rootCmd
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jslowik/commacloner/admin"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/pause"
+	"github.com/spf13/cobra"
+)
+
+func commandPause() *cobra.Command {
+	var opts config.Options
+	var mappings []string
+	var show bool
+	var output string
+	cmd := &cobra.Command{
+		Use:   "pause [ config file ]",
+		Short: "Stop a running serve starting new deals.",
+		Long: `Pause the given mappings of a running serve, or every mapping if none are given, through its admin server.
+Deals which arrive while a mapping is paused are logged as skipped, and deals awaiting approval cannot be approved.
+Pauses are kept in the state directory so they survive restarts, until they are lifted by resume.
+
+Without an admin server, creating a file named PAUSE in the state directory pauses every mapping, or only those listed
+in it, one id per line, until it is removed.`,
+		Example: "commacloner pause --mapping my_first_mapping config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			change := func(client admin.Client, mapping string) (pause.Status, error) { return client.Pause(mapping) }
+			if show {
+				change = nil
+			}
+			if err := changePause(args, opts, mappings, change, output); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	cmd.Flags().StringSliceVar(&mappings, "mapping", nil, "only pause these mappings (repeatable)")
+	cmd.Flags().BoolVar(&show, "status", false, "print what is paused without pausing anything")
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "output format, \"table\" or \"json\"")
+	return cmd
+}
+
+func commandResume() *cobra.Command {
+	var opts config.Options
+	var mappings []string
+	var output string
+	cmd := &cobra.Command{
+		Use:   "resume [ config file ]",
+		Short: "Let a running serve start new deals again.",
+		Long: `Resume the given mappings of a running serve, or lift the pause of every mapping if none are given, through
+its admin server.  Mappings paused by a PAUSE file in the state directory stay paused until it is removed.`,
+		Example: "commacloner resume --mapping my_first_mapping config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			change := func(client admin.Client, mapping string) (pause.Status, error) { return client.Resume(mapping) }
+			if err := changePause(args, opts, mappings, change, output); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	cmd.Flags().StringSliceVar(&mappings, "mapping", nil, "only resume these mappings (repeatable)")
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "output format, \"table\" or \"json\"")
+	return cmd
+}
+
+// changePause pauses or resumes each mapping, or every mapping if none are given, printing what is then paused.  Nothing
+// is changed if change is nil.
+func changePause(args []string, opts config.Options, mappings []string, change func(admin.Client, string) (pause.Status, error), output string) error {
+	if output != outputTable && output != outputJSON {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+	client, err := adminClient(args, opts)
+	if err != nil {
+		return err
+	}
+
+	var status pause.Status
+	switch {
+	case change == nil:
+		status, err = client.PauseStatus()
+	case len(mappings) == 0:
+		status, err = change(client, "")
+	default:
+		for _, mapping := range mappings {
+			if status, err = change(client, mapping); err != nil {
+				return fmt.Errorf("mapping %s: %v", mapping, err)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	}
+	return printPauseStatus(os.Stdout, status)
+}
+
+func printPauseStatus(out io.Writer, status pause.Status) error {
+	var lines []string
+	if status.All {
+		lines = append(lines, "all mappings are paused")
+	}
+	if len(status.Mappings) != 0 {
+		lines = append(lines, "paused mappings: "+strings.Join(status.Mappings, ", "))
+	}
+	switch {
+	case status.SentinelAll:
+		lines = append(lines, "all mappings are paused by the "+pause.SentinelFile+" file")
+	case status.Sentinel:
+		lines = append(lines, "mappings paused by the "+pause.SentinelFile+" file: "+strings.Join(status.SentinelMappings, ", "))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "nothing is paused")
+	}
+	_, err := fmt.Fprintln(out, strings.Join(lines, "\n"))
+	return err
+}
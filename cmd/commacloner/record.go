@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/api/websockets"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/log"
+	"github.com/jslowik/commacloner/record"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// recordOptions say where and how websocket traffic is recorded
+type recordOptions struct {
+	path     string
+	rotation record.Rotation
+}
+
+// addRotationFlags registers the flags limiting the size of a recording, each name starting with prefix
+func addRotationFlags(cmd *cobra.Command, prefix string, opts *recordOptions) {
+	opts.rotation = record.DefaultRotation
+	cmd.Flags().IntVar(&opts.rotation.MaxSize, prefix+"max-size", opts.rotation.MaxSize, "size in megabytes at which the recording is rotated")
+	cmd.Flags().IntVar(&opts.rotation.MaxBackups, prefix+"max-backups", opts.rotation.MaxBackups, "the most rotated recordings to keep, 0 keeps them all")
+	cmd.Flags().IntVar(&opts.rotation.MaxAge, prefix+"max-age", opts.rotation.MaxAge, "days to keep rotated recordings, 0 keeps them regardless of age")
+	cmd.Flags().BoolVar(&opts.rotation.Compress, prefix+"compress", opts.rotation.Compress, "gzip rotated recordings")
+}
+
+// open starts the recording, returning nil when no file was given
+func (o recordOptions) open() (*record.Recorder, error) {
+	if o.path == "" {
+		return nil, nil
+	}
+	rec, err := record.Open(o.path, o.rotation)
+	if err != nil {
+		return nil, fmt.Errorf("could not open recording: %v", err)
+	}
+	return rec, nil
+}
+
+// readMessage reads the next message from the websocket, recording it along with any close frame received
+func readMessage(conn *websocket.Conn, rec *record.Recorder, logger *zap.SugaredLogger) (int, []byte, error) {
+	msgType, message, err := conn.ReadMessage()
+	if err == nil {
+		if recErr := rec.Record(record.Inbound, msgType, message); recErr != nil {
+			logger.Warnf("%v", recErr)
+		}
+	} else if closeErr, ok := err.(*websocket.CloseError); ok {
+		if recErr := rec.Record(record.Inbound, websocket.CloseMessage, websocket.FormatCloseMessage(closeErr.Code, closeErr.Text)); recErr != nil {
+			logger.Warnf("%v", recErr)
+		}
+	}
+	return msgType, message, err
+}
+
+// writeMessage sends a message over the websocket and records it
+func writeMessage(conn *websocket.Conn, rec *record.Recorder, logger *zap.SugaredLogger, msgType int, message []byte) error {
+	if err := conn.WriteMessage(msgType, message); err != nil {
+		return err
+	}
+	if err := rec.Record(record.Outbound, msgType, message); err != nil {
+		logger.Warnf("%v", err)
+	}
+	return nil
+}
+
+// writeJSON sends a value over the websocket as JSON and records it
+func writeJSON(conn *websocket.Conn, rec *record.Recorder, logger *zap.SugaredLogger, v interface{}) error {
+	message, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeMessage(conn, rec, logger, websocket.TextMessage, message)
+}
+
+func commandRecord() *cobra.Command {
+	var opts config.Options
+	var recording recordOptions
+	var duration time.Duration
+	cmd := &cobra.Command{
+		Use:   "record [ config file ]",
+		Short: "Record the deals stream from 3Commas without acting on it.",
+		Long: `Connect to 3Commas with the configured API key and subscribe to the deals stream as serve does, writing every
+frame sent and received to a file without starting or cancelling any deals.  Each line of the file is a JSON object
+holding the time, direction and content of a frame, with API keys and signatures redacted.  Recording stops on
+interrupt or once --duration has passed.`,
+		Example: "commacloner record --output session.ndjson --duration 1h config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := recordSession(args, opts, recording, duration); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	cmd.Flags().StringVarP(&recording.path, "output", "o", "", "file to record to (required)")
+	cmd.Flags().DurationVar(&duration, "duration", 0, "stop recording after this long, 0 records until interrupted")
+	addRotationFlags(cmd, "", &recording)
+	return cmd
+}
+
+func recordSession(args []string, opts config.Options, recording recordOptions, duration time.Duration) error {
+	if recording.path == "" {
+		return errors.New("no recording file given, use --output")
+	}
+	c, err := loadAPIConfig(args, opts)
+	if err != nil {
+		return err
+	}
+	if err := log.InitWithConfiguration(c.Logging); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	logger := log.NewLogger("record")
+
+	rec, err := recording.open()
+	if err != nil {
+		return err
+	}
+	defer rec.Close()
+
+	stream := websockets.DealsStream{APIConfig: c.API}
+	subscriptionMessage, err := stream.Build()
+	if err != nil {
+		return fmt.Errorf("could not build deal subscription: %v", err)
+	}
+
+	conn, err := generateConnection(nil, c.API.WebsocketURL, logger)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	var stop <-chan time.Time
+	if duration > 0 {
+		stop = time.After(duration)
+	}
+
+	messageOut := make(chan interface{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			_, message, readErr := readMessage(conn, rec, logger)
+			if readErr != nil {
+				if websocket.IsCloseError(readErr, websocket.CloseNormalClosure) {
+					return
+				}
+				logger.Warnf("abnormal close error, reconnecting: %v", readErr)
+				if conn, err = generateConnection(conn, c.API.WebsocketURL, logger); err != nil {
+					return
+				}
+				continue
+			}
+
+			// answer the stream as serve would, so the recording matches a real session
+			ctrlMessage := api.Message{}
+			if json.Unmarshal(message, &ctrlMessage) == nil {
+				if ctrlMessage.Type == "welcome" {
+					messageOut <- subscriptionMessage
+				}
+			} else if json.Unmarshal(message, &api.PingMessage{}) == nil {
+				messageOut <- websockets.Message{Type: "pong"}
+			}
+		}
+	}()
+
+	logger.Infof("recording to %s", recording.path)
+	for {
+		select {
+		case <-done:
+			return nil
+		case m := <-messageOut:
+			if err := writeJSON(conn, rec, logger, m); err != nil {
+				return fmt.Errorf("write message out failure: %v", err)
+			}
+		case <-interrupt:
+			return closeConnection(conn, rec, logger, done)
+		case <-stop:
+			logger.Infof("recorded for %s, stopping", duration)
+			return closeConnection(conn, rec, logger, done)
+		}
+	}
+}
+
+// closeConnection cleanly closes the websocket by sending a close message and then waiting (with timeout) for the
+// server to close the connection
+func closeConnection(conn *websocket.Conn, rec *record.Recorder, logger *zap.SugaredLogger, done <-chan struct{}) error {
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := writeMessage(conn, rec, logger, websocket.CloseMessage, closeMessage); err != nil {
+		logger.Errorf("write close failure: %v", err)
+		return err
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+	}
+	return nil
+}
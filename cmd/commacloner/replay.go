@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"os"
+
+	"github.com/jslowik/commacloner/api/websockets"
+	"github.com/jslowik/commacloner/approval"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/log"
+	"github.com/jslowik/commacloner/record"
+	"github.com/jslowik/commacloner/replay"
+	"github.com/jslowik/commacloner/simulator"
+	"github.com/spf13/cobra"
+)
+
+// replayOptions control how a recording is played back
+type replayOptions struct {
+	speed   float64
+	restURL string
+}
+
+func commandReplay() *cobra.Command {
+	var opts config.Options
+	var replayOpts replayOptions
+	cmd := &cobra.Command{
+		Use:   "replay [ recording ] [ config file ]",
+		Short: "Play a recording of the deals stream back through deal handling.",
+		Long: `Play the frames received in a recording made by record or serve --record back through the same deal handling
+serve uses, with the mappings of the given config file.  A dump of the raw messages 3Commas sent, one JSON object per
+line or a JSON array, can be replayed too.
+
+Nothing is sent to 3Commas.  Destination calls go to a built in stand in for the 3Commas API, which accepts them all
+and lists them once the replay ends, or to the API given by --rest-url, such as a local fake.  Frames are played at the
+recorded speed unless --speed says otherwise; 0 plays them as fast as possible.  Deals closed after a delay by
+on_unavailable are only closed if the replay is still running once the delay has passed.  Deals of mappings which
+require approval are listed once the replay ends rather than started, and paper deals opened by simulated destinations
+are totalled, without touching those kept by serve.`,
+		Example: "commacloner replay --speed 0 session.ndjson config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := replaySession(args, opts, replayOpts); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	cmd.Flags().Float64Var(&replayOpts.speed, "speed", 1, "playback speed, 1 for the recorded speed, 10 for ten times faster, 0 for as fast as possible")
+	cmd.Flags().StringVar(&replayOpts.restURL, "rest-url", "", "send destination calls to this API instead of the built in stand in")
+	return cmd
+}
+
+func replaySession(args []string, opts config.Options, replayOpts replayOptions) error {
+	switch len(args) {
+	default:
+		return errors.New("surplus arguments")
+	case 0, 1:
+		return errors.New("a recording and a config file are required")
+	case 2:
+	}
+	if replayOpts.speed < 0 {
+		return fmt.Errorf("invalid speed %v, must not be negative", replayOpts.speed)
+	}
+
+	c, issues, err := config.Load(args[1], opts)
+	if err != nil {
+		return err
+	}
+	if err := issues.Err(); err != nil {
+		return err
+	}
+	if err := log.InitWithConfiguration(c.Logging); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	logger := log.NewLogger("replay")
+	for _, warning := range issues.Warnings() {
+		logger.Warnf("config: %s", warning)
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("could not open recording: %v", err)
+	}
+	defer f.Close()
+	frames, err := record.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	var sink *replay.Sink
+	if replayOpts.restURL != "" {
+		c.API.RestURL = replayOpts.restURL
+	} else {
+		sink = replay.NewSink()
+		server := httptest.NewServer(sink)
+		defer server.Close()
+		c.API.RestURL = server.URL
+	}
+	logger.Infof("sending destination calls to %s", c.API.RestURL)
+
+	// deals started by a replay are not recorded in the state directory, as they do not exist; paper deals and deals
+	// awaiting approval are only kept until the replay ends
+	sim, err := simulator.New(nil)
+	if err != nil {
+		return err
+	}
+	queue, err := approval.New(nil)
+	if err != nil {
+		return err
+	}
+	_, botMap := mappingsBySource(c, logger)
+	stream := websockets.DealsStream{
+		APIConfig: c.API,
+		Bots:      botMap,
+		Simulator: sim,
+		Approvals: queue,
+	}
+	subscriptionMessage, err := stream.Build()
+	if err != nil {
+		return fmt.Errorf("could not build deal subscription: %v", err)
+	}
+
+	player := replay.Player{Speed: replayOpts.speed}
+	played, err := player.Play(frames, func(payload []byte) {
+		if reply := handleMessage(stream, subscriptionMessage, payload, logger); reply != nil {
+			logger.Debugf("not sending reply: %v", reply)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("could not read recording: %v", err)
+	}
+
+	fmt.Printf("replayed %d frames\n", played)
+	if sink != nil {
+		calls := sink.Calls()
+		fmt.Printf("%d destination calls\n", len(calls))
+		for _, call := range calls {
+			if call.Query != "" {
+				fmt.Printf("%s %s?%s\n", call.Method, call.Path, call.Query)
+				continue
+			}
+			fmt.Printf("%s %s\n", call.Method, call.Path)
+		}
+	}
+	if pending := queue.Pending(); len(pending) != 0 {
+		fmt.Printf("%d deals awaiting approval\n", len(pending))
+		if err := printApprovals(os.Stdout, pending); err != nil {
+			return err
+		}
+	}
+	if deals := sim.Deals(); len(deals) != 0 {
+		fmt.Printf("%d simulated deals\n", len(deals))
+		return printLedger(os.Stdout, simulator.Ledger(deals))
+	}
+	return nil
+}
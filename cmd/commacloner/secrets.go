@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/jslowik/commacloner/config"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func commandSecrets() *cobra.Command {
+	secretsCmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Encrypt and decrypt the API key and secret.",
+		Long: `Secrets are encrypted with a key derived from a passphrase, read from the ` + config.PassphraseEnv + `
+environment variable or prompted for.  serve decrypts them transparently when loading the config.`,
+	}
+	secretsCmd.AddCommand(commandSecretsEncrypt())
+	secretsCmd.AddCommand(commandSecretsDecrypt())
+	return secretsCmd
+}
+
+func commandSecretsEncrypt() *cobra.Command {
+	return &cobra.Command{
+		Use:   "encrypt [ config file ]",
+		Short: "Encrypt the inline API key and secret of a config file, or a single value read from stdin.",
+		Example: `commacloner secrets encrypt config.yaml
+echo -n "my api secret" | commacloner secrets encrypt`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := secrets(args, true); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+}
+
+func commandSecretsDecrypt() *cobra.Command {
+	return &cobra.Command{
+		Use:   "decrypt [ config file ]",
+		Short: "Decrypt the API key and secret of a config file, or a single value read from stdin.",
+		Example: `commacloner secrets decrypt config.yaml
+echo -n "enc:v1:..." | commacloner secrets decrypt`,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := secrets(args, false); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+}
+
+func secrets(args []string, encrypt bool) error {
+	switch len(args) {
+	default:
+		return errors.New("surplus arguments")
+	case 0:
+		return secretValue(encrypt)
+	case 1:
+		return secretsFile(args[0], encrypt)
+	}
+}
+
+// secretsFile encrypts or decrypts the secrets of a config file in place
+func secretsFile(path string, encrypt bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+
+	passphrase, err := readPassphrase(encrypt)
+	if err != nil {
+		return err
+	}
+
+	rewrite, verb := config.DecryptSecrets, "decrypted"
+	if encrypt {
+		rewrite, verb = config.EncryptSecrets, "encrypted"
+	}
+	out, count, err := rewrite(data, passphrase)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		fmt.Printf("%s: nothing to do\n", path)
+		return nil
+	}
+	if err := ioutil.WriteFile(path, out, info.Mode().Perm()); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %s %d value(s)\n", path, verb, count)
+	return nil
+}
+
+// secretValue encrypts or decrypts a single value read from stdin, printing the result
+func secretValue(encrypt bool) error {
+	value, err := readValue("Value: ")
+	if err != nil {
+		return err
+	}
+	passphrase, err := readPassphrase(encrypt)
+	if err != nil {
+		return err
+	}
+
+	var out string
+	if encrypt {
+		out, err = config.EncryptSecret(value, passphrase)
+	} else {
+		out, err = config.DecryptSecret(value, passphrase)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(out)
+	return nil
+}
+
+// readValue reads a value from stdin, prompting without echo when stdin is a terminal
+func readValue(prompt string) (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprint(os.Stderr, prompt)
+		value, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		return string(value), err
+	}
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && value == "" {
+		return "", fmt.Errorf("could not read value from stdin: %v", err)
+	}
+	return strings.TrimRight(value, "\r\n"), nil
+}
+
+// readPassphrase reads the passphrase for encrypted secrets from the environment, falling back to prompting for it
+// on the terminal.  When confirm is set the passphrase must be entered twice.
+func readPassphrase(confirm bool) (string, error) {
+	if passphrase, err := config.EnvPassphrase(); err == nil {
+		return passphrase, nil
+	}
+	tty, err := os.Open("/dev/tty")
+	if err != nil || !term.IsTerminal(int(tty.Fd())) {
+		return "", fmt.Errorf("%s is not set and no terminal is available to prompt for a passphrase", config.PassphraseEnv)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(os.Stderr, "Passphrase: ")
+	passphrase, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+		again, err := term.ReadPassword(int(tty.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if string(again) != string(passphrase) {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	if len(passphrase) == 0 {
+		return "", errors.New("no passphrase given")
+	}
+	return string(passphrase), nil
+}
+
+// promptPassphrase supplies the passphrase when loading a config containing encrypted secrets
+func promptPassphrase() (string, error) {
+	return readPassphrase(false)
+}
@@ -5,37 +5,56 @@ import (
 	"errors"
 	"fmt"
 	"github.com/jslowik/commacloner/api"
-	"io/ioutil"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/jslowik/commacloner/api/websockets"
 	"go.uber.org/zap"
 
-	"github.com/ghodss/yaml"
+	"github.com/jslowik/commacloner/admin"
+	"github.com/jslowik/commacloner/api/rest"
+	"github.com/jslowik/commacloner/approval"
+	"github.com/jslowik/commacloner/audit"
 	"github.com/jslowik/commacloner/config"
 	"github.com/jslowik/commacloner/log"
+	"github.com/jslowik/commacloner/metrics"
+	"github.com/jslowik/commacloner/monitor"
+	"github.com/jslowik/commacloner/pause"
+	"github.com/jslowik/commacloner/preflight"
+	"github.com/jslowik/commacloner/simulator"
+	"github.com/jslowik/commacloner/state"
 	"github.com/spf13/cobra"
 )
 
 func commandServe() *cobra.Command {
-	return &cobra.Command{
+	var opts config.Options
+	var check, dryRun bool
+	var recording recordOptions
+	cmd := &cobra.Command{
 		Use:     "serve [ config file ]",
 		Short:   "Connect to 3commas and begin managing deals.",
 		Long:    ``,
 		Example: "commacloner serve config.yaml",
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := serve(args); err != nil {
+			if err := serve(args, opts, check, dryRun, recording); err != nil {
 				fmt.Fprintln(os.Stderr, err)
 				os.Exit(2)
 			}
 		},
 	}
+	addLoadFlags(cmd, &opts)
+	cmd.Flags().BoolVar(&check, "check", false, "check the config against the 3Commas account before connecting, as the check command does")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "log and record the calls every mapping would make instead of sending them, as dry_run: true does")
+	cmd.Flags().StringVar(&recording.path, "record", "", "record every websocket frame sent and received to this file, see the record command")
+	addRotationFlags(cmd, "record-", &recording)
+	return cmd
 }
 
-func serve(args []string) error {
+func serve(args []string, opts config.Options, check, dryRun bool, recording recordOptions) error {
 	switch len(args) {
 	default:
 		return errors.New("surplus arguments")
@@ -44,21 +63,14 @@ func serve(args []string) error {
 	case 1:
 	}
 
-	configFile := args[0]
-	configData, err := ioutil.ReadFile(configFile)
+	c, issues, err := config.Load(args[0], opts)
 	if err != nil {
-		return fmt.Errorf("failed to read config file %s: %v", configFile, err)
-	}
-
-	var c config.Config
-
-	data := []byte(os.ExpandEnv(string(configData)))
-	if err := yaml.Unmarshal(data, &c); err != nil {
-		return fmt.Errorf("error parse config file %s: %v", configFile, err)
+		return err
 	}
-	if err := c.Validate(); err != nil {
+	if err := issues.Err(); err != nil {
 		return err
 	}
+	c.DryRun = c.DryRun || dryRun
 
 	//init logging
 	//l, err := log.InitWithConfiguration(c.Logging.Level, c.Logging.Format)
@@ -68,18 +80,91 @@ func serve(args []string) error {
 	}
 	logger := log.NewLogger("serve")
 	logger.Info("logging configured")
+	for _, warning := range issues.Warnings() {
+		logger.Warnf("config: %s", warning)
+	}
 
-	//log mappings
-	logger.Info("loading bot mappings")
-	botMap := make(map[int][]config.BotMapping)
-	for _, mapping := range c.Bots {
-		botMap[mapping.Source.ID] = append(botMap[mapping.Source.ID], mapping)
+	if check {
+		logger.Info("checking config against the account")
+		preflightIssues := preflight.Run(c)
+		for _, warning := range preflightIssues.Warnings() {
+			logger.Warnf("check: %s", warning)
+		}
+		if err := preflightIssues.Err(); err != nil {
+			return err
+		}
+	}
+
+	mappings, botMap := mappingsBySource(c, logger)
+
+	links, err := state.OpenLinks(c.State.Dir)
+	if err != nil {
+		return err
+	}
+	shadow, err := state.OpenShadow(c.State.Dir)
+	if err != nil {
+		return err
+	}
+	closes, err := state.OpenCloses(c.State.Dir)
+	if err != nil {
+		return err
+	}
+	simulated, err := state.OpenSimulated(c.State.Dir)
+	if err != nil {
+		return err
+	}
+	sim, err := simulator.New(simulated)
+	if err != nil {
+		return err
+	}
+	approvals, err := state.OpenApprovals(c.State.Dir)
+	if err != nil {
+		return err
+	}
+	queue, err := approval.New(approvals)
+	if err != nil {
+		return err
+	}
+	pauses, err := openPauses(c, logger)
+	if err != nil {
+		return err
+	}
+
+	rec, err := recording.open()
+	if err != nil {
+		return err
+	}
+	defer rec.Close()
+	if recording.path != "" {
+		logger.Infof("recording websocket traffic to %s", recording.path)
+	}
+
+	auditLog, err := audit.Open(c.Audit)
+	if err != nil {
+		return err
 	}
+	defer auditLog.Close()
+	if c.Audit.Path != "" {
+		logger.Infof("writing audit log to %s, checkpoints signed with key %s from %s", c.Audit.Path, auditLog.KeyID(), c.Audit.KeyFile)
+	}
+
+	mon := monitor.New(mappings, monitor.DefaultDecisions)
+	stats := metrics.New(mappings, mon)
+	rest.SetObserver(stats.ObserveRequest)
 
 	//Make the subscription message
 	stream := websockets.DealsStream{
 		APIConfig: c.API,
 		Bots:      botMap,
+		Links:     links,
+		Shadow:    shadow,
+		Simulator: sim,
+		Approvals: queue,
+		Pauses:    pauses,
+		Monitor:   mon,
+		Metrics:   stats,
+		Audit:     auditLog,
+		Closes:    closes,
 	}
 	subscriptionMessage, err := stream.Build()
 	if err != nil {
@@ -87,6 +172,27 @@ func serve(args []string) error {
 		return err
 	}
 
+	if c.Admin.Listen != "" {
+		level := log.Level()
+		adminServer, err := admin.Server{
+			Token:     c.Admin.Token,
+			Approvals: stream,
+			Pauses:    pauses,
+			Monitor:   stream.Monitor,
+			LogLevel:  &level,
+			Metrics:   stats.Handler(),
+		}.Start(c.Admin.Address())
+		if err != nil {
+			return fmt.Errorf("could not start admin server: %v", err)
+		}
+		defer adminServer.Close()
+		logger.Infof("admin server listening on %s", c.Admin.Address())
+	}
+	go expireApprovals(stream, logger)
+	if err := stream.ScheduleCloses(); err != nil {
+		logger.Errorf("%v", err)
+	}
+
 	messageOut := make(chan *websockets.Message)
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
@@ -96,56 +202,34 @@ func serve(args []string) error {
 		logger.Fatalf("could not make connection to websocket: %v", err)
 		return err
 	}
+	stream.Monitor.SetState(monitor.StateConnected)
 
 	//When the program closes close the connection
 	defer conn.Close()
 	done := make(chan struct{})
 	go func() {
 		defer close(done)
-		pong := websockets.Message{Type: "pong"}
-
 		for {
-			msgType, message, readErr := conn.ReadMessage()
+			msgType, message, readErr := readMessage(conn, rec, logger)
 			if readErr != nil {
 				if !websocket.IsCloseError(readErr, websocket.CloseNormalClosure) {
 					logger.Warnf("abonormal close error. trying resubscribe: %v", readErr)
+					stream.Monitor.SetState(monitor.StateDisconnected)
+					stream.Monitor.SetState(monitor.StateConnecting)
 					conn, err = generateConnection(conn, c.API.WebsocketURL, logger)
 					if err != nil {
 						logger.Fatalf("could not regenerate connection: %v", err)
 						return
 					}
+					stream.Monitor.SetState(monitor.StateConnected)
 					logger.Infof("connection restablished")
 					continue
 				}
 			}
 			logger.Debugf("recv: type - %d message - %s", msgType, message)
 
-			ctrlMessage := api.Message{}
-			pingMessage := api.PingMessage{}
-			if unmarshalError := json.Unmarshal(message, &ctrlMessage); unmarshalError == nil {
-				switch ctrlMessage.Type {
-				case "welcome":
-					logger.Infof("received welcome, sending subscription: %s", subscriptionMessage)
-					messageOut <- subscriptionMessage
-				case "confirm_subscription":
-					logger.Infof("subscription confirmed : %s", message)
-				case "Deal", "Deal::ShortDeal":
-					logger.Debugf("received deal %v", ctrlMessage.Message)
-					dealMessage := api.DealsMessage{}
-					var dealErr error
-					if dealErr = json.Unmarshal(message, &dealMessage); dealErr == nil {
-						dealErr = stream.HandleDeal(dealMessage)
-					}
-					if dealErr != nil {
-						logger.Errorf("could not handle message from deals stream: %v", dealErr)
-					}
-				default:
-					logger.Warnf("unsupported message type %s : %v", ctrlMessage.Type, string(message))
-				}
-
-			} else if e := json.Unmarshal(message, &pingMessage); e == nil {
-				logger.Debugf("received ping, sending pong: %s", message)
-				messageOut <- &pong
+			if reply := handleMessage(stream, subscriptionMessage, message, logger); reply != nil {
+				messageOut <- reply
 			}
 		}
 	}()
@@ -156,27 +240,118 @@ func serve(args []string) error {
 			return nil
 		case m := <-messageOut:
 			logger.Debugf("Send Message %s", m)
-			err := conn.WriteJSON(m)
+			err := writeJSON(conn, rec, logger, m)
 			if err != nil {
 				logger.Errorf("write message out failure: %v", err)
 				return err
 			}
 		case <-interrupt:
 			logger.Infof("interrupt")
-			// Cleanly close the connection by sending a close message and then
-			// waiting (with timeout) for the server to close the connection.
-			err := conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
-			if err != nil {
-				logger.Errorf("write close failure: %v", err)
-				return err
+			return closeConnection(conn, rec, logger, done)
+		}
+	}
+}
+
+// openPauses picks up the mappings left paused by a previous run, logging them
+func openPauses(c config.Config, logger *zap.SugaredLogger) (*pause.Switch, error) {
+	store, err := state.OpenPauses(c.State.Dir)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(c.Bots))
+	for _, mapping := range c.Bots {
+		ids = append(ids, mapping.ID)
+	}
+	pauses, err := pause.New(store, c.State.Dir, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	status := pauses.Status()
+	if status.All {
+		logger.Warn("all mappings are paused, resume them to start deals")
+	}
+	if len(status.Mappings) != 0 {
+		logger.Warnf("paused mappings: %s", strings.Join(status.Mappings, ", "))
+	}
+	if status.Sentinel {
+		logger.Warnf("%s exists, pausing mappings until it is removed", filepath.Join(c.State.Dir, pause.SentinelFile))
+	}
+	return pauses, nil
+}
+
+// approvalSweep is how often deals awaiting approval are checked for expiry
+const approvalSweep = 10 * time.Second
+
+// expireApprovals applies the on_unavailable policy to deals which were not approved in time, starting with any which
+// expired while commacloner was not running
+func expireApprovals(stream websockets.DealsStream, logger *zap.SugaredLogger) {
+	ticker := time.NewTicker(approvalSweep)
+	defer ticker.Stop()
+	for {
+		if err := stream.ExpireApprovals(); err != nil {
+			logger.Errorf("%v", err)
+		}
+		<-ticker.C
+	}
+}
+
+// mappingsBySource returns the config's mappings as serve runs them, in order and indexed by source bot id, logging
+// each.  Every mapping is made a dry run if the config is.
+func mappingsBySource(c config.Config, logger *zap.SugaredLogger) ([]config.BotMapping, map[int][]config.BotMapping) {
+	logger.Info("loading bot mappings")
+	mappings := make([]config.BotMapping, 0, len(c.Bots))
+	botMap := make(map[int][]config.BotMapping)
+	for _, mapping := range c.Bots {
+		mapping.DryRun = mapping.DryRun || c.DryRun
+		if mapping.Destination.Simulated() {
+			logger.With("mode", "simulated").Infof("mapping %s: bot %d -> simulated (%s)", mapping.ID, mapping.Source.ID, mapping.Origin())
+		} else if mapping.DryRun {
+			logger.With("mode", "dry_run").Infof("mapping %s: bot %d -> bot %d (%s), dry run", mapping.ID, mapping.Source.ID, mapping.Destination.ID, mapping.Origin())
+		} else if mapping.RequireApproval {
+			logger.Infof("mapping %s: bot %d -> bot %d (%s), requires approval", mapping.ID, mapping.Source.ID, mapping.Destination.ID, mapping.Origin())
+		} else {
+			logger.Infof("mapping %s: bot %d -> bot %d (%s)", mapping.ID, mapping.Source.ID, mapping.Destination.ID, mapping.Origin())
+		}
+		mappings = append(mappings, mapping)
+		botMap[mapping.Source.ID] = append(botMap[mapping.Source.ID], mapping)
+	}
+	return mappings, botMap
+}
+
+// handleMessage decodes a message from the deals stream and acts on it, returning the message to send in reply, if any
+func handleMessage(stream websockets.DealsStream, subscriptionMessage *websockets.Message, message []byte, logger *zap.SugaredLogger) *websockets.Message {
+	ctrlMessage := api.Message{}
+	pingMessage := api.PingMessage{}
+	stream.Monitor.Message(false)
+	if unmarshalError := json.Unmarshal(message, &ctrlMessage); unmarshalError == nil {
+		switch ctrlMessage.Type {
+		case "welcome":
+			logger.Infof("received welcome, sending subscription: %s", subscriptionMessage)
+			return subscriptionMessage
+		case "confirm_subscription":
+			logger.Infof("subscription confirmed : %s", message)
+			stream.Monitor.SetState(monitor.StateSubscribed)
+		case "Deal", "Deal::ShortDeal":
+			logger.Debugf("received deal %v", ctrlMessage.Message)
+			dealMessage := api.DealsMessage{}
+			var dealErr error
+			if dealErr = json.Unmarshal(message, &dealMessage); dealErr == nil {
+				dealErr = stream.HandleDeal(dealMessage)
 			}
-			select {
-			case <-done:
-			case <-time.After(time.Second):
+			if dealErr != nil {
+				logger.Errorf("could not handle message from deals stream: %v", dealErr)
 			}
-			return nil
+		default:
+			logger.Warnf("unsupported message type %s : %v", ctrlMessage.Type, string(message))
 		}
+
+	} else if e := json.Unmarshal(message, &pingMessage); e == nil {
+		logger.Debugf("received ping, sending pong: %s", message)
+		stream.Monitor.Message(true)
+		return &websockets.Message{Type: "pong"}
 	}
+	return nil
 }
 
 func generateConnection(existingConnection *websocket.Conn, url string, logger *zap.SugaredLogger) (*websocket.Conn, error) {
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/simulator"
+	"github.com/jslowik/commacloner/state"
+	"github.com/spf13/cobra"
+)
+
+// Statuses sim deals may be filtered by
+const (
+	simStatusOpen   = "open"
+	simStatusClosed = "closed"
+)
+
+func commandSim() *cobra.Command {
+	simCmd := &cobra.Command{
+		Use:   "sim",
+		Short: "Inspect the paper deals of simulated destinations.",
+	}
+	simCmd.AddCommand(commandSimDeals())
+	simCmd.AddCommand(commandSimLedger())
+	return simCmd
+}
+
+func commandSimDeals() *cobra.Command {
+	var opts config.Options
+	var mappings []string
+	var status, output string
+	cmd := &cobra.Command{
+		Use:   "deals [ config file ]",
+		Short: "List the paper deals opened by simulated destinations.",
+		Long: `List the paper deals opened by mappings with simulated destinations, as recorded by serve in the state
+directory.  Amounts are in the quote currency of each deal's pair.`,
+		Example: "commacloner sim deals --mapping paper_mapping --status closed config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := listSimDeals(args, opts, mappings, status, output); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	cmd.Flags().StringSliceVar(&mappings, "mapping", nil, "only list deals of these mappings (repeatable)")
+	cmd.Flags().StringVar(&status, "status", "", "only list deals with this status, \"open\" or \"closed\"")
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "output format, \"table\" or \"json\"")
+	return cmd
+}
+
+func commandSimLedger() *cobra.Command {
+	var opts config.Options
+	var output string
+	cmd := &cobra.Command{
+		Use:   "ledger [ config file ]",
+		Short: "Total the profit and loss of simulated destinations.",
+		Long: `Total the paper deals of each mapping with a simulated destination by quote currency: the deals still open
+and the volume they hold, and the deals closed, how many won and lost, and the profit or loss they made.`,
+		Example: "commacloner sim ledger config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := showLedger(args, opts, output); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "output format, \"table\" or \"json\"")
+	return cmd
+}
+
+// simDeals reads the paper deals recorded in the config's state directory
+func simDeals(args []string, opts config.Options) ([]state.SimulatedDeal, error) {
+	c, err := loadConfigSection(args, opts, "state")
+	if err != nil {
+		return nil, err
+	}
+	store, err := state.ReadSimulated(c.State.Dir)
+	if err != nil || store == nil {
+		return nil, err
+	}
+	return store.All()
+}
+
+func listSimDeals(args []string, opts config.Options, mappings []string, status, output string) error {
+	if output != outputTable && output != outputJSON {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+	if status != "" && status != simStatusOpen && status != simStatusClosed {
+		return fmt.Errorf("unknown status %q, expected %s or %s", status, simStatusOpen, simStatusClosed)
+	}
+	deals, err := simDeals(args, opts)
+	if err != nil {
+		return err
+	}
+
+	listed := make([]state.SimulatedDeal, 0, len(deals))
+	for _, deal := range deals {
+		if len(mappings) != 0 && !contains(mappings, deal.Mapping) {
+			continue
+		}
+		open := deal.Status == simulator.StatusActive
+		if status == simStatusOpen && !open || status == simStatusClosed && open {
+			continue
+		}
+		listed = append(listed, deal)
+	}
+
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(listed)
+	}
+	return printSimDeals(os.Stdout, listed)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func printSimDeals(out io.Writer, deals []state.SimulatedDeal) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tMAPPING\tSOURCE DEAL\tPAIR\tSTATUS\tBOUGHT\tPROFIT\tPROFIT %\tOPENED\tCLOSED")
+	for _, deal := range deals {
+		closed := ""
+		if deal.Closed != nil {
+			closed = deal.Closed.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%g\t%g\t%g\t%s\t%s\n",
+			deal.ID, deal.Mapping, deal.SourceDealID, deal.Pair, deal.Status, deal.BoughtVolume, deal.Profit,
+			deal.ProfitPercentage, deal.Opened.Local().Format(time.RFC3339), closed)
+	}
+	return w.Flush()
+}
+
+func showLedger(args []string, opts config.Options, output string) error {
+	if output != outputTable && output != outputJSON {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+	deals, err := simDeals(args, opts)
+	if err != nil {
+		return err
+	}
+
+	ledger := simulator.Ledger(deals)
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(ledger)
+	}
+	return printLedger(os.Stdout, ledger)
+}
+
+func printLedger(out io.Writer, ledger []simulator.Entry) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MAPPING\tCURRENCY\tOPEN\tOPEN VOLUME\tCLOSED\tWON\tLOST\tPROFIT")
+	for _, entry := range ledger {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%g\t%d\t%d\t%d\t%g\n",
+			entry.Mapping, entry.Currency, entry.Open, entry.OpenVolume, entry.Closed, entry.Won, entry.Lost, entry.Profit)
+	}
+	return w.Flush()
+}
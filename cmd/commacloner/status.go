@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jslowik/commacloner/admin"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/monitor"
+	"github.com/spf13/cobra"
+)
+
+// serveStatus is everything status prints
+type serveStatus struct {
+	Health    admin.HealthResponse  `json:"health"`
+	Mappings  []admin.MappingStatus `json:"mappings"`
+	Decisions []monitor.Decision    `json:"decisions,omitempty"`
+}
+
+func commandStatus() *cobra.Command {
+	var opts config.Options
+	var mapping, output string
+	var decisions int
+	cmd := &cobra.Command{
+		Use:   "status [ config file ]",
+		Short: "Print how a running serve is doing.",
+		Long: `Print the state of a running serve's connection to the deals stream, and each mapping with how many deals it
+has received and what was done with them, through its admin server.  With --decisions, the most recent decisions are
+listed too.  Counters start from zero each time serve starts.`,
+		Example: "commacloner status --decisions 20 config.yaml",
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := showStatus(args, opts, mapping, decisions, output); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+		},
+	}
+	addLoadFlags(cmd, &opts)
+	cmd.Flags().IntVar(&decisions, "decisions", 0, "also list this many of the most recent decisions")
+	cmd.Flags().StringVar(&mapping, "mapping", "", "only list the decisions of this mapping")
+	cmd.Flags().StringVarP(&output, "output", "o", outputTable, "output format, \"table\" or \"json\"")
+	return cmd
+}
+
+func showStatus(args []string, opts config.Options, mapping string, decisions int, output string) error {
+	if output != outputTable && output != outputJSON {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+	if decisions < 0 {
+		return fmt.Errorf("invalid number of decisions %d", decisions)
+	}
+	client, err := adminClient(args, opts)
+	if err != nil {
+		return err
+	}
+
+	var status serveStatus
+	if status.Health, err = client.Health(); err != nil {
+		return err
+	}
+	if status.Mappings, err = client.Mappings(); err != nil {
+		return err
+	}
+	if decisions != 0 {
+		if status.Decisions, err = client.Decisions(mapping, decisions); err != nil {
+			return err
+		}
+	}
+
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(status)
+	}
+	if err := printHealth(os.Stdout, status.Health.Health); err != nil {
+		return err
+	}
+	if err := printMappingStatus(os.Stdout, status.Mappings); err != nil {
+		return err
+	}
+	if decisions == 0 {
+		return nil
+	}
+	fmt.Println()
+	return printDecisions(os.Stdout, status.Decisions)
+}
+
+func printHealth(out io.Writer, health monitor.Health) error {
+	lastMessage := "no messages received"
+	if health.LastMessageAge != nil {
+		lastMessage = fmt.Sprintf("last message %s ago", (time.Duration(*health.LastMessageAge) * time.Second).Round(time.Second))
+	}
+	_, err := fmt.Fprintf(out, "deals stream %s since %s, %s, %d reconnects\n\n",
+		health.State, health.Since.Local().Format(time.RFC3339), lastMessage, health.Reconnects)
+	return err
+}
+
+func printMappingStatus(out io.Writer, mappings []admin.MappingStatus) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "MAPPING\tPAUSED\tRECEIVED\tCLONED\tSKIPPED\tFAILED\tQUEUED\tDRY RUN\tSIMULATED\tCANCELLED\tPANIC SOLD")
+	for _, mapping := range mappings {
+		counters := mapping.Counters
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+			mapping.ID, yesNo(mapping.Paused), counters.Received, counters.Cloned, counters.Skipped, counters.Failed,
+			counters.Queued, counters.DryRun, counters.Simulated, counters.Cancelled, counters.PanicSold)
+	}
+	return w.Flush()
+}
+
+func printDecisions(out io.Writer, decisions []monitor.Decision) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tMAPPING\tSOURCE DEAL\tPAIR\tOUTCOME\tDEST DEAL\tREASON\tACTION")
+	for _, decision := range decisions {
+		destDeal := ""
+		if decision.DestDealID != 0 {
+			destDeal = fmt.Sprint(decision.DestDealID)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			decision.Time.Local().Format(time.RFC3339), decision.Mapping, decision.SourceDealID, decision.Pair,
+			decision.Outcome, destDeal, decision.Reason, decision.Action)
+	}
+	return w.Flush()
+}
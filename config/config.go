@@ -2,36 +2,92 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"go.uber.org/zap"
 )
 
 // Config is the top level of the configuration yaml
 type Config struct {
+	// Version is the schema version of the file, see CurrentVersion
+	Version int          `json:"version"`
 	API     API          `json:"api"`
 	Bots    []BotMapping `json:"bots"`
+	Include []string     `json:"include"`
 	Logging Logger       `json:"logging"`
+	State   State        `json:"state"`
+	Admin   Admin        `json:"admin"`
+	Audit   Audit        `json:"audit"`
+	// DryRun makes every mapping a dry run, see BotMapping.DryRun
+	DryRun bool `json:"dry_run"`
+
+	// sources records the values which did not come from the config file, keyed by YAML path
+	sources map[string]string
 }
 
 // Logger holds configuration required to customize logging
 type Logger struct {
 	// Level sets logging level severity.
-	Level string `json:"level"`
+	Level string `json:"level" enum:"debug,info,warn,error,dpanic,panic,fatal"`
 
 	// Format specifies the format to be used for logging.
-	Format string `json:"format"`
+	Format string `json:"format" enum:"json,console"`
 
 	//Destination
-	Destination string `json:"destination"`
+	Destination string `json:"destination" enum:"file,console"`
+}
+
+// State holds configuration for the files commacloner keeps between runs
+type State struct {
+	// Dir is the directory state files are kept in, ie the links between source and destination deals
+	Dir string `json:"dir" expand:"env"`
+}
+
+// Admin configures the local HTTP server used to control a running serve, ie to approve deals
+type Admin struct {
+	// Listen is the address the admin server listens on, ie "127.0.0.1:8421".  Without a host, as in ":8421", it only
+	// listens on localhost; "0.0.0.0:8421" listens on every interface.  No server is started if it is empty.
+	Listen string `json:"listen"`
+	// Token is the bearer token every request must carry.  It may be a secret reference, like the api key, and is
+	// required unless the server only listens on localhost.
+	Token string `json:"token" expand:"env" secret:"true"`
+}
+
+// Audit configures the audit log, a JSONL record of every decision made about a deal
+type Audit struct {
+	// Path is the file the audit log is written to, ie "audit/audit.jsonl".  No audit log is kept if it is empty.
+	Path string `json:"path" expand:"env"`
+	// MaxSize is the size in megabytes at which the file is rotated, renaming it with a timestamp and starting another
+	MaxSize int `json:"max_size"`
+	// MaxBackups is the most rotated files kept, 0 keeps them all
+	MaxBackups int `json:"max_backups"`
+	// MaxAge is how many days rotated files are kept, 0 keeps them regardless of age
+	MaxAge int `json:"max_age"`
+	// Compress gzips rotated files
+	Compress bool `json:"compress"`
+	// KeyFile is the ed25519 key checkpoints of the audit log are signed with, created if it does not exist.  It must
+	// be set along with Path, and kept where the account hosting the audit log cannot read or write it, or the
+	// checkpoints prove nothing.
+	KeyFile string `json:"key_file" expand:"env"`
+	// CheckpointEvery is the number of records between signed checkpoints
+	CheckpointEvery int `json:"checkpoint_every"`
 }
 
-// API contains the configuration elementsd for the 3commas API
+// API contains the configuration elementsd for the 3commas API.  The key and secret may be given inline, read from a
+// file (key_file/secret_file), or resolved from a secret reference (see resolveSecret).
 type API struct {
-	Key          string `json:"key"`
-	Secret       string `json:"secret"`
+	Key          string `json:"key" expand:"env" secret:"true"`
+	KeyFile      string `json:"key_file" expand:"env"`
+	Secret       string `json:"secret" expand:"env" secret:"true"`
+	SecretFile   string `json:"secret_file" expand:"env"`
 	WebsocketURL string `json:"websocket_url"`
 	RestURL      string `json:"rest_url"`
+
+	// inlineSecrets is set when the key or secret were written directly into the config file
+	inlineSecrets bool
 }
 
 // BotMapping contains both a source bot id to look for deals from the websockets api, and a destination bot to generate
@@ -42,141 +98,293 @@ type BotMapping struct {
 	Source      BotConfig    `json:"source"`
 	Destination BotConfig    `json:"dest"`
 	Overrides   BotOverrides `json:"overrides"`
+	// DryRun logs and records the REST calls the mapping would make instead of sending them
+	DryRun bool `json:"dry_run"`
+	// RequireApproval queues new deals until they are approved through the admin server rather than starting them
+	RequireApproval bool `json:"require_approval"`
+	// ApprovalTimeout is how long a queued deal waits for approval, ie "15m".  Deals which are not approved in time
+	// are handled by the on_unavailable policy.
+	ApprovalTimeout string `json:"approval_timeout"`
+
+	// origin records the file the mapping was loaded from
+	origin origin
 }
 
+// DefaultApprovalTimeout is how long a deal waits for approval when no approval_timeout is given
+const DefaultApprovalTimeout = 15 * time.Minute
+
+// ApprovalExpiry returns how long a deal queued by the mapping waits for approval
+func (m BotMapping) ApprovalExpiry() time.Duration {
+	timeout, err := time.ParseDuration(m.ApprovalTimeout)
+	if err != nil || timeout <= 0 {
+		return DefaultApprovalTimeout
+	}
+	return timeout
+}
+
+// BotType is where the deals of a bot are started
+type BotType string
+
+// Types of bot
+const (
+	// BotType3Commas bots are 3Commas bots, the default
+	BotType3Commas BotType = "3commas"
+	// BotTypeSimulated destinations open paper deals locally instead of on 3Commas, see the simulator package
+	BotTypeSimulated BotType = "simulated"
+)
+
 // BotConfig contains configuration elements for the 3commas bots.
 type BotConfig struct {
 	ID int `json:"bot_id"`
+	// Type is the kind of bot.  Only destinations may be simulated, in which case they have no bot id.
+	Type BotType `json:"type" enum:"3commas,simulated"`
+}
+
+// Simulated reports whether the bot is simulated rather than a 3Commas bot
+func (m BotConfig) Simulated() bool {
+	return m.Type == BotTypeSimulated
 }
 
 // BotOverrides contains bot-specific overrides when translating a deal from the source bot to the destination bot
-// This includes both overriding a base/quote currency, or cancelling a deal on the source bot if it's not available
-// on the destination bot's exchange.
+// This includes both overriding a base/quote currency, and deciding what happens to a deal on the source bot if it
+// cannot be started on the destination bot.
 type BotOverrides struct {
-	QuoteCurrency             string `json:"quote_currency"`
-	BaseCurrency              string `json:"base_currency"`
-	CancelUnavailableDeals    bool   `json:"cancelUnavailableDeals"`
-	PanicSellUnavailableDeals bool   `json:"panicSellUnavailableDeals"`
+	QuoteCurrency string            `json:"quote_currency"`
+	BaseCurrency  string            `json:"base_currency"`
+	OnUnavailable UnavailablePolicy `json:"on_unavailable"`
 }
 
 // Validate the configuration
 func (c Config) Validate() error {
+	return c.Check().Err()
+}
+
+// Check validates the configuration, returning every problem found along with its YAML path
+func (c Config) Check() Issues {
 	// Fast checks. Perform these first for a more responsive CLI.
 	checks := []struct {
 		bad    bool
+		path   string
 		errMsg string
 	}{
-		{len(c.Bots) == 0, "no bot mappings defined"},
+		{len(c.Bots) == 0, "bots", "no bot mappings defined"},
 	}
 
-	var checkErrors []string
+	var checkErrors Issues
 
 	for _, check := range checks {
 		if check.bad {
-			checkErrors = append(checkErrors, check.errMsg)
+			checkErrors = append(checkErrors, Issue{Path: check.path, Message: check.errMsg})
 		}
 	}
 
 	// Validate the logging configs
-	checkErrors = append(checkErrors, c.Logging.validate()...)
+	checkErrors = append(checkErrors, c.Logging.validate("logging")...)
 
 	// Validate the API configs
-	checkErrors = append(checkErrors, c.API.validate()...)
+	checkErrors = append(checkErrors, c.API.validate("api")...)
+	checkErrors = append(checkErrors, c.Admin.validate("admin")...)
+	checkErrors = append(checkErrors, c.Audit.validate("audit")...)
 
 	// Validate the bot mappings
-	for _, mapping := range c.Bots {
-		checkErrors = append(checkErrors, mapping.validate()...)
+	for i, mapping := range c.Bots {
+		checkErrors = append(checkErrors, mapping.validate(indexPath("bots", i))...)
 	}
+	checkErrors = append(checkErrors, c.checkMappings()...)
 
-	if len(checkErrors) != 0 {
-		return fmt.Errorf("invalid Config:\n\t-\t%s", strings.Join(checkErrors, "\n\t-\t"))
-	}
-	return nil
+	return checkErrors
 }
 
-func (c Logger) validate() []string {
+func (c Logger) validate(path string) Issues {
 	// Fast checks. Perform these first for a more responsive CLI.
 	checks := []struct {
 		bad    bool
+		path   string
 		errMsg string
 	}{
-		{c.Format == "" || c.Format != "json" && c.Format != "console", "log format must be \"json\" or \"console\""},
+		{c.Format == "" || c.Format != "json" && c.Format != "console", "format", "log format must be \"json\" or \"console\""},
 
-		{c.Destination == "" || c.Destination != "file" && c.Destination != "console", "log destination must be \"file\" or \"console\""},
+		{c.Destination == "" || c.Destination != "file" && c.Destination != "console", "destination", "log destination must be \"file\" or \"console\""},
 	}
 
-	var checkErrors []string
+	var checkErrors Issues
 	for _, check := range checks {
 		if check.bad {
-			checkErrors = append(checkErrors, check.errMsg)
+			checkErrors = append(checkErrors, Issue{Path: joinPath(path, check.path), Message: check.errMsg})
 		}
 	}
 	var lvl zap.AtomicLevel
 	err := lvl.UnmarshalText([]byte(c.Level))
 	if err != nil {
-		checkErrors = append(checkErrors, "invalid log level: "+c.Level)
+		checkErrors = append(checkErrors, Issue{Path: joinPath(path, "level"), Message: "invalid log level: " + c.Level})
 	}
 
 	return checkErrors
 }
 
-func (c API) validate() []string {
+func (c API) validate(path string) Issues {
 	// Fast checks. Perform these first for a more responsive CLI.
 	checks := []struct {
 		bad    bool
+		path   string
 		errMsg string
 	}{
-		{c.Key == "", "no api key specified in config file"},
-		{c.Secret == "", "no api secret in config file"},
-		{c.WebsocketURL == "", "no websocket url defined"},
-		{c.RestURL == "", "no rest url defined"},
+		{c.Key == "", "key", "no api key specified in config file"},
+		{c.Secret == "", "secret", "no api secret in config file"},
+		{c.WebsocketURL == "", "websocket_url", "no websocket url defined"},
+		{c.RestURL == "", "rest_url", "no rest url defined"},
 	}
 
-	var checkErrors []string
+	var checkErrors Issues
 
 	for _, check := range checks {
 		if check.bad {
-			checkErrors = append(checkErrors, check.errMsg)
+			checkErrors = append(checkErrors, Issue{Path: joinPath(path, check.path), Message: check.errMsg})
 		}
 	}
 	return checkErrors
 }
 
-func (m BotMapping) validate() []string {
-	var checkErrors []string
+func (m BotMapping) validate(path string) Issues {
+	var checkErrors Issues
 
 	checks := []struct {
 		bad    bool
+		path   string
 		errMsg string
 	}{
-		{m.ID == "", "no bot mapping id defined"},
+		{m.ID == "", "id", "no bot mapping id defined"},
 	}
 	for _, check := range checks {
 		if check.bad {
-			checkErrors = append(checkErrors, check.errMsg)
+			checkErrors = append(checkErrors, Issue{Path: joinPath(path, check.path), Message: check.errMsg})
 		}
 	}
 
 	// Validate BotConfigs
-	checkErrors = append(checkErrors, m.Source.validate()...)
-	checkErrors = append(checkErrors, m.Destination.validate()...)
+	checkErrors = append(checkErrors, m.Source.validate(joinPath(path, "source"))...)
+	if m.Source.Simulated() {
+		checkErrors = append(checkErrors, Issue{Path: joinPath(path, "source.type"), Message: "source bots cannot be simulated"})
+	}
+	checkErrors = append(checkErrors, m.Destination.validate(joinPath(path, "dest"))...)
+	checkErrors = append(checkErrors, m.Overrides.validate(joinPath(path, "overrides"))...)
+
+	if m.ApprovalTimeout != "" {
+		if timeout, err := time.ParseDuration(m.ApprovalTimeout); err != nil || timeout <= 0 {
+			checkErrors = append(checkErrors, Issue{
+				Path:    joinPath(path, "approval_timeout"),
+				Message: fmt.Sprintf("invalid approval timeout %q, must be a positive duration such as 15m", m.ApprovalTimeout),
+			})
+		} else if !m.RequireApproval {
+			checkErrors = append(checkErrors, Issue{
+				Severity: SeverityWarning,
+				Path:     joinPath(path, "approval_timeout"),
+				Message:  "approval_timeout has no effect unless require_approval is set",
+			})
+		}
+	}
+	if m.RequireApproval && m.Destination.Simulated() {
+		checkErrors = append(checkErrors, Issue{
+			Severity: SeverityWarning,
+			Path:     joinPath(path, "require_approval"),
+			Message:  "simulated destinations open their deals without approval",
+		})
+	}
 	return checkErrors
 }
 
-func (m BotConfig) validate() []string {
-	var checkErrors []string
+func (a Admin) validate(path string) Issues {
+	if a.Listen == "" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(a.Listen)
+	if err != nil {
+		return Issues{{Path: joinPath(path, "listen"), Message: fmt.Sprintf("invalid listen address %q: %v", a.Listen, err)}}
+	}
+	if a.Token == "" && host != "" && !IsLoopback(host) {
+		return Issues{{
+			Path:    joinPath(path, "token"),
+			Message: fmt.Sprintf("a token is required as the admin server listens beyond localhost (%s)", a.Listen),
+		}}
+	}
+	return nil
+}
 
+func (a Audit) validate(path string) Issues {
+	var issues Issues
 	checks := []struct {
 		bad    bool
+		path   string
 		errMsg string
 	}{
-		{m.ID == 0, "no bot mapping id defined"},
+		{a.MaxSize < 1, "max_size", fmt.Sprintf("invalid size %d, must be at least 1MB", a.MaxSize)},
+		{a.MaxBackups < 0, "max_backups", fmt.Sprintf("invalid number of backups %d, must not be negative", a.MaxBackups)},
+		{a.MaxAge < 0, "max_age", fmt.Sprintf("invalid age %d, must not be negative", a.MaxAge)},
+		{a.CheckpointEvery < 1, "checkpoint_every", fmt.Sprintf("invalid checkpoint interval %d, must be at least 1 record", a.CheckpointEvery)},
+		{a.KeyFile == "", "key_file", "no signing key file defined, keep it outside the audit log's directory"},
+	}
+	for _, check := range checks {
+		if check.bad && a.Path != "" {
+			issues = append(issues, Issue{Path: joinPath(path, check.path), Message: check.errMsg})
+		}
+	}
+	if a.Path != "" && a.KeyFile != "" && within(filepath.Dir(a.Path), a.KeyFile) {
+		issues = append(issues, Issue{
+			Severity: SeverityWarning,
+			Path:     joinPath(path, "key_file"),
+			Message:  "the signing key is kept in the audit log's directory, where whoever can edit the log can sign it",
+		})
+	}
+	return issues
+}
+
+// within reports whether path is inside dir
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Address returns the address the admin server listens on, with localhost as the host if none is given
+func (a Admin) Address() string {
+	host, port, err := net.SplitHostPort(a.Listen)
+	if err != nil || host != "" {
+		return a.Listen
+	}
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// IsLoopback reports whether a listen host only accepts connections from the local machine
+func IsLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (m BotConfig) validate(path string) Issues {
+	var checkErrors Issues
+
+	checks := []struct {
+		bad    bool
+		path   string
+		errMsg string
+	}{
+		{m.ID == 0 && !m.Simulated(), "bot_id", "no bot mapping id defined"},
+		{m.Type != "" && m.Type != BotType3Commas && !m.Simulated(), "type", fmt.Sprintf("invalid bot type %q, must be %q or %q", m.Type, BotType3Commas, BotTypeSimulated)},
 	}
 
 	for _, check := range checks {
 		if check.bad {
-			checkErrors = append(checkErrors, check.errMsg)
+			checkErrors = append(checkErrors, Issue{Path: joinPath(path, check.path), Message: check.errMsg})
 		}
 	}
+	if m.ID != 0 && m.Simulated() {
+		checkErrors = append(checkErrors, Issue{
+			Severity: SeverityWarning,
+			Path:     joinPath(path, "bot_id"),
+			Message:  "simulated bots have no bot id, it is ignored",
+		})
+	}
 	return checkErrors
 }
@@ -29,9 +29,7 @@ func TestConfig_Validate(t *testing.T) {
 					ID: 5678,
 				},
 				Overrides: BotOverrides{
-					QuoteCurrency:             "USD",
-					CancelUnavailableDeals:    false,
-					PanicSellUnavailableDeals: false,
+					QuoteCurrency: "USD",
 				},
 			},
 		},
@@ -208,3 +206,77 @@ func TestConfig_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestAdmin_Address(t *testing.T) {
+	tests := []struct {
+		listen string
+		want   string
+	}{
+		{listen: ":8421", want: "127.0.0.1:8421"},
+		{listen: "0.0.0.0:8421", want: "0.0.0.0:8421"},
+		{listen: "localhost:8421", want: "localhost:8421"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.listen, func(t *testing.T) {
+			if got := (Admin{Listen: tt.listen}).Address(); got != tt.want {
+				t.Errorf("Address() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdmin_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		admin   Admin
+		wantErr bool
+	}{
+		{name: "disabled"},
+		{name: "localhost without a token", admin: Admin{Listen: "127.0.0.1:8421"}},
+		{name: "localhost by name", admin: Admin{Listen: "localhost:8421"}},
+		{name: "ipv6 loopback", admin: Admin{Listen: "[::1]:8421"}},
+		{name: "no host binds to localhost", admin: Admin{Listen: ":8421"}},
+		{name: "every interface with a token", admin: Admin{Listen: "0.0.0.0:8421", Token: "t0k3n"}},
+		{name: "every interface without a token", admin: Admin{Listen: "0.0.0.0:8421"}, wantErr: true},
+		{name: "remote without a token", admin: Admin{Listen: "10.0.0.5:8421"}, wantErr: true},
+		{name: "no port", admin: Admin{Listen: "127.0.0.1"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.admin.validate("admin").Err(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAudit_validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		audit       Audit
+		wantErr     bool
+		wantWarning bool
+	}{
+		{name: "disabled"},
+		{name: "disabled ignores rotation", audit: Audit{MaxSize: -1}},
+		{name: "enabled", audit: Audit{Path: "audit.jsonl", MaxSize: 100, MaxBackups: 5, MaxAge: 30, KeyFile: "/etc/commacloner/audit.key", CheckpointEvery: 100}},
+		{name: "no size", audit: Audit{Path: "audit.jsonl", KeyFile: "/etc/commacloner/audit.key"}, wantErr: true},
+		{name: "negative backups", audit: Audit{Path: "audit.jsonl", MaxSize: 100, MaxBackups: -1, KeyFile: "/etc/commacloner/audit.key", CheckpointEvery: 100}, wantErr: true},
+		{name: "no checkpoints", audit: Audit{Path: "audit.jsonl", MaxSize: 100, KeyFile: "/etc/commacloner/audit.key"}, wantErr: true},
+		{name: "negative age", audit: Audit{Path: "audit.jsonl", MaxSize: 100, MaxAge: -1, KeyFile: "/etc/commacloner/audit.key", CheckpointEvery: 100}, wantErr: true},
+		{name: "no key file", audit: Audit{Path: "audit.jsonl", MaxSize: 100, CheckpointEvery: 100}, wantErr: true},
+		{name: "key file beside the log", audit: Audit{Path: "state/audit.jsonl", MaxSize: 100, KeyFile: "state/keys/audit.key", CheckpointEvery: 100}, wantWarning: true},
+		{name: "key file beside a sibling", audit: Audit{Path: "state/audit.jsonl", MaxSize: 100, KeyFile: "state-keys/audit.key", CheckpointEvery: 100}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issues := tt.audit.validate("audit")
+			if err := issues.Err(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if warnings := issues.Warnings(); (len(warnings) != 0) != tt.wantWarning {
+				t.Errorf("validate() warnings = %v, wantWarning %v", warnings, tt.wantWarning)
+			}
+		})
+	}
+}
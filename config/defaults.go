@@ -0,0 +1,71 @@
+package config
+
+import (
+	"reflect"
+	"strconv"
+)
+
+// Official 3Commas API endpoints
+const (
+	DefaultWebsocketURL = "wss://ws.3commas.io/websocket"
+	DefaultRestURL      = "https://api.3commas.io/public/api"
+)
+
+// defaultSource marks values filled in by applyDefaults
+const defaultSource = "default"
+
+// defaults are the values used for settings left empty, keyed by YAML path
+var defaults = []struct {
+	path  string
+	value string
+}{
+	{"api.websocket_url", DefaultWebsocketURL},
+	{"api.rest_url", DefaultRestURL},
+	{"logging.level", "info"},
+	{"logging.format", "console"},
+	{"logging.destination", "console"},
+	{"state.dir", "state"},
+	{"audit.max_size", "100"},
+	{"audit.checkpoint_every", "100"},
+}
+
+// applyDefaults fills in every empty setting which has a default, recording the default as its source
+func (c *Config) applyDefaults() {
+	for _, d := range defaults {
+		segments := splitPath(d.path)
+		if !isZeroPath(reflect.ValueOf(c).Elem(), segments) {
+			continue
+		}
+		if err := setPath(reflect.ValueOf(c).Elem(), segments, d.value); err == nil {
+			c.setSource(d.path, defaultSource)
+		}
+	}
+}
+
+// isZeroPath reports whether the value at the given path segments is unset
+func isZeroPath(v reflect.Value, segments []string) bool {
+	for _, segment := range segments {
+		switch v.Kind() {
+		case reflect.Struct:
+			found := false
+			for i := 0; i < v.NumField(); i++ {
+				if jsonName(v.Type().Field(i)) == segment {
+					v, found = v.Field(i), true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		case reflect.Slice:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= v.Len() {
+				return true
+			}
+			v = v.Index(i)
+		default:
+			return false
+		}
+	}
+	return v.IsZero()
+}
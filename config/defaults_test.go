@@ -0,0 +1,80 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestParse_defaults(t *testing.T) {
+	minimal := `api:
+  key: "qwertyu"
+  secret: "asdfghjkl"
+logging:
+  level: "debug"
+bots:
+  - id: my_first_mapping
+    source:
+      bot_id: 1234
+    dest:
+      bot_id: 5678
+`
+	tests := []struct {
+		name       string
+		opts       Options
+		path       string
+		get        func(c Config) string
+		want       string
+		wantSource string
+	}{
+		{
+			name:       "rest url",
+			path:       "api.rest_url",
+			get:        func(c Config) string { return c.API.RestURL },
+			want:       DefaultRestURL,
+			wantSource: defaultSource,
+		},
+		{
+			name:       "websocket url",
+			path:       "api.websocket_url",
+			get:        func(c Config) string { return c.API.WebsocketURL },
+			want:       DefaultWebsocketURL,
+			wantSource: defaultSource,
+		},
+		{
+			name: "file takes precedence",
+			path: "logging.level",
+			get:  func(c Config) string { return c.Logging.Level },
+			want: "debug",
+		},
+		{
+			name:       "override takes precedence",
+			opts:       Options{Set: []string{"logging.format=json"}},
+			path:       "logging.format",
+			get:        func(c Config) string { return c.Logging.Format },
+			want:       "json",
+			wantSource: "--set",
+		},
+		{
+			name: "defaults disabled",
+			opts: Options{NoDefaults: true},
+			path: "api.rest_url",
+			get:  func(c Config) string { return c.API.RestURL },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, issues, err := Parse("config.yaml", []byte(minimal), tt.opts)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !tt.opts.NoDefaults && len(issues) != 0 {
+				t.Errorf("Parse() issues = %v, want none", issues)
+			}
+			if got := tt.get(c); got != tt.want {
+				t.Errorf("Parse() %s = %v, want %v", tt.path, got, tt.want)
+			}
+			if got := c.Source(tt.path); got != tt.wantSource {
+				t.Errorf("Source(%s) = %v, want %v", tt.path, got, tt.wantSource)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EditScalars rewrites the scalar values at the given YAML paths.  edit receives the path and current value of each
+// scalar and returns its replacement, or false to leave it alone.  Only the values themselves are replaced, so
+// comments and formatting elsewhere in the file are preserved.  Paths which do not exist are skipped.
+func EditScalars(data []byte, edit func(path, value string) (string, bool, error), paths ...string) ([]byte, error) {
+	doc, err := parseDocument("", data)
+	if err != nil {
+		return nil, err
+	}
+
+	type replacement struct {
+		node  *yaml.Node
+		value string
+	}
+	var replacements []replacement
+	for _, path := range paths {
+		node := doc.lookup(path)
+		if node == nil {
+			continue
+		}
+		if node.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("%s is not a single value", path)
+		}
+		value, ok, err := edit(path, node.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		if ok {
+			replacements = append(replacements, replacement{node: node, value: value})
+		}
+	}
+
+	// Apply the replacements from the end of the file backwards so earlier positions remain valid
+	sort.Slice(replacements, func(i, j int) bool {
+		a, b := replacements[i].node, replacements[j].node
+		return a.Line > b.Line || a.Line == b.Line && a.Column > b.Column
+	})
+	lines := strings.SplitAfter(string(data), "\n")
+	for _, r := range replacements {
+		line := []rune(lines[r.node.Line-1])
+		start := r.node.Column - 1
+		end, err := scalarEnd(line, start, r.node.Style)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", r.node.Line, err)
+		}
+		lines[r.node.Line-1] = string(line[:start]) + strconv.Quote(r.value) + string(line[end:])
+	}
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// scalarEnd finds the end of a single line scalar which begins at start
+func scalarEnd(line []rune, start int, style yaml.Style) (int, error) {
+	switch {
+	case style&yaml.DoubleQuotedStyle != 0:
+		for i := start + 1; i < len(line); i++ {
+			switch line[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1, nil
+			}
+		}
+	case style&yaml.SingleQuotedStyle != 0:
+		for i := start + 1; i < len(line); i++ {
+			if line[i] == '\'' {
+				if i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1, nil
+			}
+		}
+	case style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+	default:
+		end := len(line)
+		for i := start; i < len(line); i++ {
+			if line[i] == '#' && i > start && (line[i-1] == ' ' || line[i-1] == '\t') {
+				end = i
+				break
+			}
+		}
+		for end > start && strings.ContainsRune(" \t\r\n", line[end-1]) {
+			end--
+		}
+		return end, nil
+	}
+	return 0, fmt.Errorf("cannot edit a value spanning multiple lines")
+}
+
+// lookup returns the node at the given YAML path, or nil if there is none
+func (d Document) lookup(path string) *yaml.Node {
+	node := d.body()
+	for _, segment := range splitPath(path) {
+		if node == nil {
+			return nil
+		}
+		node = child(node, segment)
+	}
+	return node
+}
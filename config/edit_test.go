@@ -0,0 +1,60 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestEditScalars(t *testing.T) {
+	replace := func(path, value string) (string, bool, error) {
+		return "new", true, nil
+	}
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "plain scalar with comment",
+			data: "api:\n  key: old # comment\n",
+			want: "api:\n  key: \"new\" # comment\n",
+		},
+		{
+			name: "double quoted scalar",
+			data: "api:\n  key: \"o\\\"ld\"\n  secret: x\n",
+			want: "api:\n  key: \"new\"\n  secret: x\n",
+		},
+		{
+			name: "single quoted scalar",
+			data: "api: {key: 'it''s', secret: x}\n",
+			want: "api: {key: \"new\", secret: x}\n",
+		},
+		{
+			name: "missing path",
+			data: "api:\n  secret: x\n",
+			want: "api:\n  secret: x\n",
+		},
+		{
+			name:    "block scalar",
+			data:    "api:\n  key: |\n    old\n",
+			wantErr: true,
+		},
+		{
+			name:    "not a scalar",
+			data:    "api:\n  key:\n    - old\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EditScalars([]byte(tt.data), replace, "api.key")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("EditScalars() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("EditScalars() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryptedSecretPrefix marks a key or secret encrypted with EncryptSecret.  The remainder of the value is the base64
+// encoding of the scrypt salt, the AES-GCM nonce and the sealed secret.
+const encryptedSecretPrefix = "enc:v1:"
+
+// PassphraseEnv is the environment variable the passphrase for encrypted secrets is read from
+const PassphraseEnv = "COMMACLONER_PASSPHRASE"
+
+// scrypt parameters used to derive the AES-256 key from the passphrase
+const (
+	scryptN       = 1 << 15
+	scryptR       = 8
+	scryptP       = 1
+	scryptKeyLen  = 32
+	scryptSaltLen = 16
+)
+
+// Sizes of the standard AES-GCM nonce and of the tag it appends to the sealed secret
+const (
+	gcmNonceLen = 12
+	gcmTagLen   = 16
+)
+
+// IsEncryptedSecret reports whether a value was produced by EncryptSecret
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, encryptedSecretPrefix)
+}
+
+// EncryptSecret encrypts a secret with a key derived from the passphrase, returning a value which can be placed in
+// the config file in place of the secret
+func EncryptSecret(secret, passphrase string) (string, error) {
+	if passphrase == "" {
+		return "", errors.New("no passphrase given")
+	}
+	salt := make([]byte, scryptSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	gcm, err := secretCipher(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := append(salt, nonce...)
+	sealed = gcm.Seal(sealed, nonce, []byte(secret), nil)
+	return encryptedSecretPrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret reverses EncryptSecret
+func DecryptSecret(value, passphrase string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return "", errors.New("value is not an encrypted secret")
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, encryptedSecretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted secret: %v", err)
+	}
+	if len(sealed) < scryptSaltLen {
+		return "", errors.New("malformed encrypted secret: too short")
+	}
+	salt, sealed := sealed[:scryptSaltLen], sealed[scryptSaltLen:]
+
+	gcm, err := secretCipher(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("malformed encrypted secret: too short")
+	}
+	nonce, sealed := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+
+	secret, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return "", errors.New("could not decrypt secret, wrong passphrase?")
+	}
+	return string(secret), nil
+}
+
+// checkEncryptedSecret checks a value is laid out as EncryptSecret writes it, without decrypting it
+func checkEncryptedSecret(value string) error {
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, encryptedSecretPrefix))
+	if err != nil {
+		return fmt.Errorf("malformed encrypted secret: %v", err)
+	}
+	if len(sealed) < scryptSaltLen+gcmNonceLen+gcmTagLen {
+		return errors.New("malformed encrypted secret: too short")
+	}
+	return nil
+}
+
+func secretCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// secretPaths are the config values EncryptSecrets and DecryptSecrets operate on
+var secretPaths = []string{"api.key", "api.secret"}
+
+// EncryptSecrets encrypts the inline api key and secret within a config file, returning the rewritten file and the
+// number of values encrypted.  Values which are empty, already encrypted, references or environment variables are
+// left as is.
+func EncryptSecrets(data []byte, passphrase string) ([]byte, int, error) {
+	count := 0
+	out, err := EditScalars(data, func(path, value string) (string, bool, error) {
+		if value == "" || IsEncryptedSecret(value) || isSecretReference(value) || os.ExpandEnv(value) != value {
+			return "", false, nil
+		}
+		encrypted, err := EncryptSecret(value, passphrase)
+		if err != nil {
+			return "", false, err
+		}
+		count++
+		return encrypted, true, nil
+	}, secretPaths...)
+	return out, count, err
+}
+
+// DecryptSecrets reverses EncryptSecrets, returning the rewritten file and the number of values decrypted
+func DecryptSecrets(data []byte, passphrase string) ([]byte, int, error) {
+	count := 0
+	out, err := EditScalars(data, func(path, value string) (string, bool, error) {
+		if !IsEncryptedSecret(value) {
+			return "", false, nil
+		}
+		decrypted, err := DecryptSecret(value, passphrase)
+		if err != nil {
+			return "", false, err
+		}
+		count++
+		return decrypted, true, nil
+	}, secretPaths...)
+	return out, count, err
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncryptSecret(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     string
+		passphrase string
+		decryptAs  string
+		wantErr    bool
+	}{
+		{name: "round trip", secret: "s0m3s3cr3t!!", passphrase: "hunter2", decryptAs: "hunter2"},
+		{name: "empty secret", secret: "", passphrase: "hunter2", decryptAs: "hunter2"},
+		{name: "wrong passphrase", secret: "s0m3s3cr3t!!", passphrase: "hunter2", decryptAs: "hunter3", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encrypted, err := EncryptSecret(tt.secret, tt.passphrase)
+			if err != nil {
+				t.Fatalf("EncryptSecret() error = %v", err)
+			}
+			if !IsEncryptedSecret(encrypted) || strings.Contains(encrypted, tt.secret) && tt.secret != "" {
+				t.Fatalf("EncryptSecret() = %v, not an encrypted secret", encrypted)
+			}
+			got, err := DecryptSecret(encrypted, tt.decryptAs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DecryptSecret() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got != tt.secret {
+				t.Errorf("DecryptSecret() = %v, want %v", got, tt.secret)
+			}
+		})
+	}
+}
+
+func TestDecryptSecret_malformed(t *testing.T) {
+	for _, value := range []string{"plaintext", "enc:v1:!!!", "enc:v1:AAAA"} {
+		if _, err := DecryptSecret(value, "hunter2"); err == nil {
+			t.Errorf("DecryptSecret(%q) expected error", value)
+		}
+	}
+}
+
+func Test_checkEncryptedSecret(t *testing.T) {
+	encrypted, err := EncryptSecret("s0m3s3cr3t!!", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkEncryptedSecret(encrypted); err != nil {
+		t.Errorf("checkEncryptedSecret() error = %v", err)
+	}
+	for _, value := range []string{"enc:v1:!!!", "enc:v1:AAAA", encrypted[:len(encryptedSecretPrefix)+40]} {
+		if err := checkEncryptedSecret(value); err == nil {
+			t.Errorf("checkEncryptedSecret(%q) expected error", value)
+		}
+	}
+}
+
+func TestEncryptSecrets(t *testing.T) {
+	data := []byte(`# credentials
+api:
+  key: qwertyu # inline key
+  secret: "env:COMMACLONER_SECRET"
+  rest_url: "https://api.3commas.io/public/api"
+`)
+	encrypted, count, err := EncryptSecrets(data, "hunter2")
+	if err != nil {
+		t.Fatalf("EncryptSecrets() error = %v", err)
+	}
+	if count != 1 {
+		t.Errorf("EncryptSecrets() encrypted %d values, want 1", count)
+	}
+	if strings.Contains(string(encrypted), "qwertyu") || !strings.Contains(string(encrypted), "# inline key") {
+		t.Errorf("EncryptSecrets() = %s", encrypted)
+	}
+
+	c, issues, err := Parse("config.yaml", encrypted, Options{Passphrase: func() (string, error) { return "hunter2", nil }})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if c.API.Key != "qwertyu" {
+		t.Errorf("Parse() key = %v, want qwertyu (issues %v)", c.API.Key, issues)
+	}
+
+	decrypted, count, err := DecryptSecrets(encrypted, "hunter2")
+	if err != nil {
+		t.Fatalf("DecryptSecrets() error = %v", err)
+	}
+	if count != 1 {
+		t.Errorf("DecryptSecrets() decrypted %d values, want 1", count)
+	}
+	if want := strings.Replace(string(data), "qwertyu", `"qwertyu"`, 1); string(decrypted) != want {
+		t.Errorf("DecryptSecrets() = %s, want %s", decrypted, want)
+	}
+}
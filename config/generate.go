@@ -0,0 +1,80 @@
+package config
+
+import (
+	"bytes"
+	"strconv"
+	"text/template"
+)
+
+// generateTemplate lays out a new config file.  Settings left at their defaults are omitted so the file only holds
+// what was chosen.
+var generateTemplate = template.Must(template.New("config").Funcs(template.FuncMap{"quote": strconv.Quote}).Parse(
+	`# The config schema version, see "Upgrading a Configuration" in the README
+version: {{ .Version }}
+# Options for controlling the logger.
+logging:
+  # logging level: debug, info, warn or error
+  level: {{ quote .Logging.Level }}
+  # "console" or "json" are the valid formats
+  format: {{ quote .Logging.Format }}
+  # log destination.  "console" just prints to stderr, "file" will print to "./logs/commacloner.log"
+  destination: {{ quote .Logging.Destination }}
+# The 3Commas API key and secret.  They may also be read from files (key_file/secret_file), resolved with "env:NAME",
+# "file:PATH" or "exec:COMMAND" references, or encrypted with "commacloner secrets encrypt".
+api:
+  key: {{ quote .API.Key }}
+  secret: {{ quote .API.Secret }}
+{{- if ne .API.WebsocketURL .DefaultWebsocketURL }}
+  websocket_url: {{ quote .API.WebsocketURL }}
+{{- end }}
+{{- if ne .API.RestURL .DefaultRestURL }}
+  rest_url: {{ quote .API.RestURL }}
+{{- end }}
+# Each mapping clones the deals started by the source bot onto the destination bot
+bots:
+{{- range .Bots }}
+  - id: {{ quote .ID }}
+    source:
+      bot_id: {{ .Source.ID }}
+    dest:
+      bot_id: {{ .Destination.ID }}
+{{- with .Overrides }}{{ if or .QuoteCurrency .BaseCurrency .OnUnavailable.Default }}
+    overrides:
+{{- if .QuoteCurrency }}
+      quote_currency: {{ quote .QuoteCurrency }}
+{{- end }}
+{{- if .BaseCurrency }}
+      base_currency: {{ quote .BaseCurrency }}
+{{- end }}
+{{- if .OnUnavailable.Default }}
+      # what to do with the source deal if it cannot be started on the destination bot
+      on_unavailable:
+        default: {{ .OnUnavailable.Default }}
+{{- end }}
+{{- end }}{{ end }}
+{{- end }}
+`))
+
+// Generate renders a new, commented config file.  Only the logging and API settings, the mappings, and the currency
+// overrides and default on_unavailable action of each mapping are written; the file declares CurrentVersion.  API
+// endpoints are only written if they differ from the defaults.
+func Generate(c Config) ([]byte, error) {
+	c.Version = CurrentVersion
+	if c.API.WebsocketURL == "" {
+		c.API.WebsocketURL = DefaultWebsocketURL
+	}
+	if c.API.RestURL == "" {
+		c.API.RestURL = DefaultRestURL
+	}
+	data := struct {
+		Config
+		DefaultWebsocketURL string
+		DefaultRestURL      string
+	}{c, DefaultWebsocketURL, DefaultRestURL}
+
+	var buf bytes.Buffer
+	if err := generateTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	want := Config{
+		Version: CurrentVersion,
+		API:     API{Key: "abc\"123", Secret: "s3cr3t\\", RestURL: "http://localhost:8080/api"},
+		Logging: Logger{Level: "info", Format: "console", Destination: "console"},
+		Bots: []BotMapping{
+			{ID: "plain", Source: BotConfig{ID: 1}, Destination: BotConfig{ID: 2}},
+			{
+				ID:          "overridden",
+				Source:      BotConfig{ID: 3},
+				Destination: BotConfig{ID: 4},
+				Overrides: BotOverrides{
+					QuoteCurrency: "USD",
+					OnUnavailable: UnavailablePolicy{Default: ActionPanicSell},
+				},
+			},
+		},
+	}
+	data, err := Generate(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, issues, err := Parse("config.yaml", data, Options{})
+	if err != nil {
+		t.Fatalf("Generate() wrote an unreadable config: %v\n%s", err, data)
+	}
+	if len(issues) != 0 {
+		t.Errorf("Generate() wrote a config with problems: %v\n%s", issues, data)
+	}
+	for i := range got.Bots {
+		got.Bots[i].origin = origin{}
+	}
+	if got.API.Key != want.API.Key || got.API.Secret != want.API.Secret ||
+		got.API.RestURL != want.API.RestURL || got.API.WebsocketURL != DefaultWebsocketURL || got.Logging != want.Logging ||
+		!reflect.DeepEqual(got.Bots, want.Bots) {
+		t.Errorf("Generate() round trip = %+v, want %+v\n%s", got, want, data)
+	}
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// mappingFile is the layout of a file pulled in by the top level include globs
+type mappingFile struct {
+	Version int          `json:"version"`
+	Bots    []BotMapping `json:"bots"`
+}
+
+// origin records where a bot mapping was defined
+type origin struct {
+	doc   Document
+	index int
+}
+
+// botPathPattern matches YAML paths within a bot mapping, capturing the mapping index and the remainder of the path
+var botPathPattern = regexp.MustCompile(`^bots\[(\d+)\](.*)$`)
+
+// Origin returns the file and line the mapping was defined on, or an empty string if it was not loaded from a file
+func (m BotMapping) Origin() string {
+	if m.origin.doc.File == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", m.origin.doc.File, m.origin.doc.Line(indexPath("bots", m.origin.index)))
+}
+
+// setOrigins records doc as the origin of every mapping which does not have one yet
+func (c *Config) setOrigins(doc Document) {
+	for i := range c.Bots {
+		if c.Bots[i].origin.doc.File == "" {
+			c.Bots[i].origin = origin{doc: doc, index: i}
+		}
+	}
+}
+
+// include appends the mappings of every file matched by the include globs
+func (c *Config) include(main Document, opts Options) Issues {
+	files, issues := includedFiles(main, c.Include)
+	for _, file := range files {
+		issues = append(issues, c.includeFile(main, file.name, file.path, opts)...)
+	}
+	return issues
+}
+
+// includedFile is a file matched by one of the include globs
+type includedFile struct {
+	name string
+	// path is the YAML path of the glob which matched the file
+	path string
+}
+
+// includedFiles expands the include globs.  Globs are expanded in the order they are listed, and the files matched by
+// each glob in lexical order.  Relative globs are resolved against the directory of the main config file, and no
+// file is included twice.
+func includedFiles(main Document, patterns []string) ([]includedFile, Issues) {
+	var files []includedFile
+	var issues Issues
+
+	seen := map[string]bool{filepath.Clean(main.File): true}
+	for i, pattern := range patterns {
+		path := indexPath("include", i)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(main.File), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			issues = append(issues, main.Locate(Issues{{Path: path, Message: fmt.Sprintf("invalid include pattern: %v", err)}})...)
+			continue
+		}
+		if len(matches) == 0 {
+			issues = append(issues, main.Locate(Issues{{Severity: SeverityWarning, Path: path, Message: "include pattern matched no files"}})...)
+			continue
+		}
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			if seen[filepath.Clean(match)] {
+				continue
+			}
+			seen[filepath.Clean(match)] = true
+			files = append(files, includedFile{name: match, path: path})
+		}
+	}
+	return files, issues
+}
+
+// includeFile appends the mappings defined in a single included file.  Problems reading the file are reported
+// against the include pattern in the main document, problems within it against the file itself.
+func (c *Config) includeFile(main Document, file, path string, opts Options) Issues {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return main.Locate(Issues{{Path: path, Message: fmt.Sprintf("failed to read included file %s: %v", file, err)}})
+	}
+	doc, err := parseDocument(file, data)
+	if err != nil {
+		return main.Locate(Issues{{Path: path, Message: err.Error()}})
+	}
+
+	var mappings mappingFile
+	issues := doc.upgrade(true, opts.Lenient)
+	issues = append(issues, doc.Locate(checkKeys(doc.body(), reflect.TypeOf(mappings), "", opts.Lenient))...)
+	if err := doc.decode(&mappings); err != nil {
+		if len(issues.Errors()) == 0 {
+			issues = append(issues, main.Locate(Issues{{Path: path, Message: err.Error()}})...)
+		}
+		return issues
+	}
+	for i := range mappings.Bots {
+		mappings.Bots[i].origin = origin{doc: doc, index: i}
+	}
+	c.Bots = append(c.Bots, mappings.Bots...)
+	return issues
+}
+
+// locate fills in the file and line of each issue.  Issues within a bot mapping are reported against the file the
+// mapping was defined in, using its index within that file, while issues with an overridden value are reported
+// against the override.
+func (c Config) locate(main Document, issues Issues) Issues {
+	for i, issue := range issues {
+		if source := c.Source(issue.Path); source != "" {
+			issues[i].File = source
+			continue
+		}
+		if match := botPathPattern.FindStringSubmatch(issue.Path); match != nil {
+			index, _ := strconv.Atoi(match[1])
+			if index < len(c.Bots) && c.Bots[index].origin.doc.File != "" {
+				o := c.Bots[index].origin
+				issue.Path = indexPath("bots", o.index) + match[2]
+				issues[i] = o.doc.Locate(Issues{issue})[0]
+				continue
+			}
+		}
+		issues[i] = main.Locate(Issues{issue})[0]
+	}
+	return issues
+}
+
+// mappingRef describes the mapping at index i for use in messages, naming its file when mappings are split across
+// several files
+func (c Config) mappingRef(i int) string {
+	o := c.Bots[i].origin
+	if len(c.Include) != 0 && o.doc.File != "" {
+		return fmt.Sprintf("bots[%d] in %s", o.index, o.doc.File)
+	}
+	return indexPath("bots", i)
+}
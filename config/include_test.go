@@ -0,0 +1,81 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoad_include(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string
+		wantIDs    []string
+		wantIssues Issues
+	}{
+		{
+			name: "mappings merged in order",
+			files: map[string]string{
+				"config.yaml":          baselineYAML + "include:\n  - mappings.d/*.yaml\n  - extra.yaml\n",
+				"mappings.d/20-b.yaml": "bots:\n  - id: b\n    source:\n      bot_id: 3\n    dest:\n      bot_id: 4\n",
+				"mappings.d/10-a.yaml": "bots:\n  - id: a\n    source:\n      bot_id: 1\n    dest:\n      bot_id: 2\n",
+				"extra.yaml":           "bots:\n  - id: c\n    source:\n      bot_id: 5\n    dest:\n      bot_id: 6\n",
+			},
+			wantIDs: []string{"my_first_mapping", "a", "b", "c"},
+		},
+		{
+			name: "problems reported against the included file",
+			files: map[string]string{
+				"config.yaml":          baselineYAML + "include:\n  - mappings.d/*.yaml\n  - missing.d/*.yaml\n",
+				"mappings.d/10-a.yaml": "bots:\n  - id: my_first_mapping\n    source:\n      bot_id: 1\n    dest:\n      bot_id: 2\n      bot: 3\n",
+			},
+			wantIDs: []string{"my_first_mapping", "my_first_mapping"},
+			wantIssues: Issues{
+				{Severity: SeverityWarning, Path: "include[1]", Message: "include pattern matched no files", File: "config.yaml", Line: 19},
+				{Path: "bots[0].dest.bot", Message: "unknown key \"bot\", did you mean \"bot_id\"?", File: "mappings.d/10-a.yaml", Line: 7},
+				{Path: "bots[0].id", Message: "duplicate bot mapping id \"my_first_mapping\", first used by bots[0] in config.yaml", File: "mappings.d/10-a.yaml", Line: 2},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			c, issues, err := Load(filepath.Join(dir, "config.yaml"), Options{})
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			var ids []string
+			for _, mapping := range c.Bots {
+				ids = append(ids, mapping.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIDs) {
+				t.Errorf("Load() mappings = %v, want %v", ids, tt.wantIDs)
+			}
+			for i := range issues {
+				issues[i].File, _ = filepath.Rel(dir, issues[i].File)
+				issues[i].Message = strings.Replace(issues[i].Message, dir+string(filepath.Separator), "", -1)
+			}
+			if !reflect.DeepEqual(issues, tt.wantIssues) {
+				t.Errorf("Load() issues = %v, want %v", issues, tt.wantIssues)
+			}
+		})
+	}
+}
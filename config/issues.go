@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity indicates whether an Issue prevents the configuration from being used
+type Severity int
+
+const (
+	// SeverityError issues block startup
+	SeverityError Severity = iota
+	// SeverityWarning issues are reported but otherwise allowed
+	SeverityWarning
+)
+
+// String returns the lowercase name of the severity
+func (s Severity) String() string {
+	if s == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+// Issue describes a single problem found in a configuration.  Path is the YAML path of the offending element
+// (ie bots[0].source.bot_id), while File and Line are filled in when the configuration was loaded from disk.
+type Issue struct {
+	Severity Severity
+	Path     string
+	Message  string
+	File     string
+	Line     int
+}
+
+// String formats the issue as file:line: path: message, omitting whichever location details are unknown
+func (i Issue) String() string {
+	var b strings.Builder
+	if i.File != "" {
+		b.WriteString(i.File)
+		if i.Line > 0 {
+			b.WriteString(fmt.Sprintf(":%d", i.Line))
+		}
+		b.WriteString(": ")
+	}
+	if i.Severity == SeverityWarning {
+		b.WriteString("warning: ")
+	}
+	if i.Path != "" {
+		b.WriteString(i.Path)
+		b.WriteString(": ")
+	}
+	b.WriteString(i.Message)
+	return b.String()
+}
+
+// Issues is a list of configuration problems
+type Issues []Issue
+
+// Errors returns the issues which block startup
+func (i Issues) Errors() Issues {
+	return i.filter(SeverityError)
+}
+
+// Warnings returns the issues which are reported but allowed
+func (i Issues) Warnings() Issues {
+	return i.filter(SeverityWarning)
+}
+
+func (i Issues) filter(severity Severity) Issues {
+	var filtered Issues
+	for _, issue := range i {
+		if issue.Severity == severity {
+			filtered = append(filtered, issue)
+		}
+	}
+	return filtered
+}
+
+// Err collapses the error issues into a single error, or nil if there are none.  Warnings are ignored.
+func (i Issues) Err() error {
+	errs := i.Errors()
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, 0, len(errs))
+	for _, issue := range errs {
+		msgs = append(msgs, issue.String())
+	}
+	return fmt.Errorf("invalid Config:\n\t-\t%s", strings.Join(msgs, "\n\t-\t"))
+}
+
+// joinPath appends a key to a YAML path
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// indexPath appends a sequence index to a YAML path
+func indexPath(path string, index int) string {
+	return fmt.Sprintf("%s[%d]", path, index)
+}
@@ -0,0 +1,245 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a configuration file parsed from disk.  The YAML node tree is retained so problems can be reported
+// against the line they were found on.
+type Document struct {
+	File string
+	root *yaml.Node
+}
+
+// Options controls how configuration files are decoded
+type Options struct {
+	// Lenient downgrades unknown keys from errors to warnings, allowing files written for newer releases to load
+	Lenient bool
+
+	// Passphrase supplies the passphrase for encrypted secrets.  It is only called if the file contains encrypted
+	// secrets, and defaults to reading the COMMACLONER_PASSPHRASE environment variable.
+	Passphrase func() (string, error)
+
+	// Environ is the environment searched for COMMACLONER_ overrides, usually os.Environ().  No environment
+	// overrides are applied when it is nil.
+	Environ []string
+
+	// Set holds path=value overrides, ie logging.level=debug.  These take precedence over the environment.
+	Set []string
+	// NoDefaults leaves settings which are missing from the file empty rather than filling in their defaults
+	NoDefaults bool
+	// CheckSecretsOnly checks that secret references are well formed instead of resolving them, so validating a file
+	// never reads a secret file or runs a helper command the file names.  The references are left in place.
+	CheckSecretsOnly bool
+}
+
+// passphrase returns a function which asks for the passphrase at most once
+func (o Options) passphrase() func() (string, error) {
+	source := o.Passphrase
+	if source == nil {
+		source = EnvPassphrase
+	}
+	var passphrase string
+	var err error
+	asked := false
+	return func() (string, error) {
+		if !asked {
+			asked = true
+			passphrase, err = source()
+		}
+		return passphrase, err
+	}
+}
+
+// EnvPassphrase reads the passphrase for encrypted secrets from the COMMACLONER_PASSPHRASE environment variable
+func EnvPassphrase() (string, error) {
+	passphrase, ok := os.LookupEnv(PassphraseEnv)
+	if !ok || passphrase == "" {
+		return "", fmt.Errorf("%s is not set", PassphraseEnv)
+	}
+	return passphrase, nil
+}
+
+// Load reads the configuration file at path and validates it.  The returned error is only set when the file could
+// not be read or parsed; problems with its contents are returned as Issues, located within the file.
+func Load(path string, opts Options) (Config, Issues, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, nil, fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+	c, doc, issues, err := parse(path, data, opts)
+	if err != nil {
+		return c, issues, err
+	}
+	return c, append(issues, doc.Locate(checkFileMode(path, c))...), nil
+}
+
+// Parse decodes and validates configuration data read from file.  Unknown and duplicate keys are checked before
+// decoding; duplicate keys prevent decoding, in which case only the key issues are returned.
+func Parse(file string, data []byte, opts Options) (Config, Issues, error) {
+	c, _, issues, err := parse(file, data, opts)
+	return c, issues, err
+}
+
+func parse(file string, data []byte, opts Options) (Config, Document, Issues, error) {
+	var c Config
+
+	doc, err := parseDocument(file, data)
+	if err != nil {
+		return c, doc, nil, err
+	}
+
+	issues := doc.upgrade(false, opts.Lenient)
+	issues = append(issues, doc.Locate(checkKeys(doc.body(), reflect.TypeOf(c), "", opts.Lenient))...)
+	if err := doc.decode(&c); err != nil {
+		if len(issues.Errors()) != 0 {
+			return c, doc, issues, nil
+		}
+		return c, doc, nil, err
+	}
+
+	c.setOrigins(doc)
+	issues = append(issues, c.include(doc, opts)...)
+
+	// Overlays are applied in increasing order of precedence: environment, then flags.  Defaults only fill in
+	// whatever is still empty afterwards.
+	referenced := make(map[string]bool)
+	envReferences(reflect.ValueOf(c), referenced)
+	envs, envIssues := envOverlays(opts.Environ, referenced)
+	sets, setIssues := setOverlays(opts.Set)
+	issues = append(issues, envIssues...)
+	issues = append(issues, setIssues...)
+	issues = append(issues, c.applyOverlays(envs)...)
+	issues = append(issues, c.applyOverlays(sets)...)
+	if !opts.NoDefaults {
+		c.applyDefaults()
+	}
+
+	// check for inline secrets first, as values taken from the environment are not written in the file
+	c.API.inlineSecrets = c.hasInlineSecrets()
+	expandEnv(reflect.ValueOf(&c))
+	passphrase := opts.passphrase()
+	issues = append(issues, c.locate(doc, c.API.resolveSecrets("api", passphrase, opts.CheckSecretsOnly))...)
+	issues = append(issues, c.locate(doc, c.Admin.resolveSecrets("admin", passphrase, opts.CheckSecretsOnly))...)
+	return c, doc, append(issues, c.locate(doc, c.Check())...), nil
+}
+
+func parseDocument(file string, data []byte) (Document, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return Document{}, fmt.Errorf("error parse config file %s: %v", file, err)
+	}
+	return Document{File: file, root: &root}, nil
+}
+
+// decode converts the document into the given struct.  Decoding passes through JSON so the `json` struct tags remain
+// the single source of truth for field names.
+func (d Document) decode(v interface{}) error {
+	body := d.body()
+	if body == nil {
+		return nil
+	}
+	var raw interface{}
+	if err := body.Decode(&raw); err != nil {
+		return fmt.Errorf("error parse config file %s: %v", d.File, err)
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("error parse config file %s: %v", d.File, err)
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(v); err != nil {
+		return fmt.Errorf("error parse config file %s: %v", d.File, err)
+	}
+	return nil
+}
+
+// body returns the top level node of the document, or nil if the document is empty
+func (d Document) body() *yaml.Node {
+	if d.root == nil || d.root.Kind != yaml.DocumentNode || len(d.root.Content) == 0 {
+		return nil
+	}
+	return d.root.Content[0]
+}
+
+// Locate fills in the file and line of each issue found within this document, keeping any line already known
+func (d Document) Locate(issues Issues) Issues {
+	for i := range issues {
+		issues[i].File = d.File
+		if issues[i].Line == 0 {
+			issues[i].Line = d.Line(issues[i].Path)
+		}
+	}
+	return issues
+}
+
+// Line returns the line number of the element at the given YAML path.  When the element itself is missing the line
+// of its closest existing ancestor is returned instead.  Zero is returned for an empty document.
+func (d Document) Line(path string) int {
+	node := d.body()
+	if node == nil {
+		return 0
+	}
+	line := node.Line
+	for _, segment := range splitPath(path) {
+		if node = child(node, segment); node == nil {
+			break
+		}
+		// Nodes added by a migration have no line, so keep the closest ancestor which does
+		if node.Line > 0 {
+			line = node.Line
+		}
+	}
+	return line
+}
+
+// child returns the value of a mapping key or sequence index, or nil if there is none
+func child(node *yaml.Node, segment string) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == segment {
+				return node.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		index, err := strconv.Atoi(segment)
+		if err == nil && index >= 0 && index < len(node.Content) {
+			return node.Content[index]
+		}
+	}
+	return nil
+}
+
+// splitPath breaks a YAML path such as bots[0].source.bot_id into its keys and indexes
+func splitPath(path string) []string {
+	var segments []string
+	for _, part := range strings.Split(path, ".") {
+		for part != "" {
+			open := strings.Index(part, "[")
+			if open == -1 {
+				segments = append(segments, part)
+				break
+			}
+			if open > 0 {
+				segments = append(segments, part[:open])
+			}
+			end := strings.Index(part, "]")
+			if end < open {
+				segments = append(segments, part[open:])
+				break
+			}
+			segments = append(segments, part[open+1:end])
+			part = part[end+1:]
+		}
+	}
+	return segments
+}
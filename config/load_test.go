@@ -0,0 +1,150 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+const baselineYAML = `logging:
+  level: "debug"
+  format: "console"
+  destination: "console"
+api:
+  key: "qwertyu"
+  secret: "asdfghjkl"
+  websocket_url: "wss://ws.3commas.io/websocket"
+  rest_url: "https://api.3commas.io/public/api"
+bots:
+  -
+    id: my_first_mapping
+    source:
+      bot_id: 1234
+    dest:
+      bot_id: 5678
+`
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		wantIssues Issues
+		wantErr    bool
+	}{
+		{
+			name: "clean path",
+			data: baselineYAML,
+		},
+		{
+			name: "missing destination bot",
+			data: `logging:
+  level: "debug"
+  format: "console"
+  destination: "console"
+api:
+  key: "qwertyu"
+  secret: "asdfghjkl"
+  websocket_url: "wss://ws.3commas.io/websocket"
+  rest_url: "https://api.3commas.io/public/api"
+bots:
+  - id: my_first_mapping
+    source:
+      bot_id: 1234
+    dest: {}
+`,
+			wantIssues: Issues{
+				{Path: "bots[0].dest.bot_id", Message: "no bot mapping id defined", File: "config.yaml", Line: 14},
+			},
+		},
+		{
+			name: "bad log level and missing key",
+			data: `logging:
+  level: "loud"
+  format: "console"
+  destination: "console"
+api:
+  secret: "asdfghjkl"
+  websocket_url: "wss://ws.3commas.io/websocket"
+  rest_url: "https://api.3commas.io/public/api"
+bots:
+  - id: my_first_mapping
+    source:
+      bot_id: 1234
+    dest:
+      bot_id: 5678
+`,
+			wantIssues: Issues{
+				{Path: "logging.level", Message: "invalid log level: loud", File: "config.yaml", Line: 2},
+				{Path: "api.key", Message: "no api key specified in config file", File: "config.yaml", Line: 6},
+			},
+		},
+		{
+			name:    "malformed yaml",
+			data:    "bots: [",
+			wantErr: true,
+		},
+		{
+			name:    "wrong type",
+			data:    "bots:\n  - source:\n      bot_id: abc\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, issues, err := Parse("config.yaml", []byte(tt.data), Options{})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(issues, tt.wantIssues) {
+				t.Errorf("Parse() issues = %v, want %v", issues, tt.wantIssues)
+			}
+		})
+	}
+}
+
+func TestDocument_Line(t *testing.T) {
+	doc, err := parseDocument("config.yaml", []byte(baselineYAML))
+	if err != nil {
+		t.Fatalf("parseDocument() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{name: "top level key", path: "api", want: 6},
+		{name: "nested key", path: "api.secret", want: 7},
+		{name: "sequence element", path: "bots[0]", want: 12},
+		{name: "key within sequence", path: "bots[0].dest.bot_id", want: 16},
+		{name: "missing key falls back to parent", path: "bots[0].overrides.quote_currency", want: 12},
+		{name: "index out of range falls back to parent", path: "bots[3].id", want: 11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := doc.Line(tt.path); got != tt.want {
+				t.Errorf("Line() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_splitPath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{name: "single key", path: "bots", want: []string{"bots"}},
+		{name: "nested keys", path: "api.rest_url", want: []string{"api", "rest_url"}},
+		{name: "indexed key", path: "bots[2].source.bot_id", want: []string{"bots", "2", "source", "bot_id"}},
+		{name: "nested indexes", path: "a[0][1]", want: []string{"a", "0", "1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitPath(tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// currencyPattern matches a single currency symbol as used in 3Commas pairs (ie USDT in USDT_BTC)
+var currencyPattern = regexp.MustCompile(`^[A-Z0-9]+$`)
+
+// checkMappings performs the checks which span more than one bot mapping, such as duplicate ids and cycles
+func (c Config) checkMappings() Issues {
+	var issues Issues
+
+	ids := make(map[string]int)
+	pairs := make(map[[2]int]int)
+	for i, mapping := range c.Bots {
+		path := indexPath("bots", i)
+
+		if first, ok := ids[mapping.ID]; ok && mapping.ID != "" {
+			issues = append(issues, Issue{
+				Path:    joinPath(path, "id"),
+				Message: fmt.Sprintf("duplicate bot mapping id %q, first used by %s", mapping.ID, c.mappingRef(first)),
+			})
+		} else {
+			ids[mapping.ID] = i
+		}
+
+		if mapping.RequireApproval && !mapping.Destination.Simulated() && c.Admin.Listen == "" {
+			issues = append(issues, Issue{
+				Severity: SeverityWarning,
+				Path:     joinPath(path, "require_approval"),
+				Message:  "no admin server is configured (admin.listen), so deals awaiting approval can only expire",
+			})
+		}
+
+		if mapping.Source.ID == 0 || mapping.Destination.ID == 0 || mapping.Destination.Simulated() {
+			continue
+		}
+		if mapping.Source.ID == mapping.Destination.ID {
+			issues = append(issues, Issue{
+				Path:    joinPath(path, "dest.bot_id"),
+				Message: fmt.Sprintf("destination bot %d is the same as the source bot", mapping.Destination.ID),
+			})
+			continue
+		}
+		pair := [2]int{mapping.Source.ID, mapping.Destination.ID}
+		if first, ok := pairs[pair]; ok {
+			issues = append(issues, Issue{
+				Path:    path,
+				Message: fmt.Sprintf("bot %d is already cloned to bot %d by %s", pair[0], pair[1], c.mappingRef(first)),
+			})
+		} else {
+			pairs[pair] = i
+		}
+	}
+
+	return append(issues, c.checkCycles()...)
+}
+
+// checkCycles reports chains of mappings which eventually clone back into their own source bot, as every deal on
+// such a chain would be cloned forever.  Each cycle is reported once, against the first mapping on it.
+func (c Config) checkCycles() Issues {
+	// next lists, for each mapping, the mappings whose source is its destination
+	next := make([][]int, len(c.Bots))
+	for i, from := range c.Bots {
+		for j, to := range c.Bots {
+			if from.Source.ID != from.Destination.ID && from.Destination.ID != 0 && !from.Destination.Simulated() &&
+				from.Destination.ID == to.Source.ID {
+				next[i] = append(next[i], j)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(c.Bots))
+	var stack []int
+	var issues Issues
+	reported := make(map[string]bool)
+
+	var visit func(i int)
+	visit = func(i int) {
+		state[i] = visiting
+		stack = append(stack, i)
+		for _, j := range next[i] {
+			switch state[j] {
+			case unvisited:
+				visit(j)
+			case visiting:
+				cycle := cycleFrom(stack, j)
+				key := fmt.Sprint(cycle)
+				if !reported[key] {
+					reported[key] = true
+					issues = append(issues, Issue{
+						Path:    indexPath("bots", cycle[0]),
+						Message: "bot mappings form a cycle: " + c.describeCycle(cycle),
+					})
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[i] = visited
+	}
+	for i := range c.Bots {
+		if state[i] == unvisited {
+			visit(i)
+		}
+	}
+	return issues
+}
+
+// cycleFrom extracts the cycle beginning at start from the dfs stack, rotated so the lowest index comes first
+func cycleFrom(stack []int, start int) []int {
+	var cycle []int
+	for k := len(stack) - 1; k >= 0; k-- {
+		if stack[k] == start {
+			cycle = append(cycle, stack[k:]...)
+			break
+		}
+	}
+	lowest := 0
+	for k := range cycle {
+		if cycle[k] < cycle[lowest] {
+			lowest = k
+		}
+	}
+	return append(cycle[lowest:], cycle[:lowest]...)
+}
+
+func (c Config) describeCycle(cycle []int) string {
+	steps := make([]string, 0, len(cycle))
+	for _, i := range cycle {
+		steps = append(steps, fmt.Sprintf("%s (%d -> %d)", c.Bots[i].ID, c.Bots[i].Source.ID, c.Bots[i].Destination.ID))
+	}
+	return strings.Join(steps, ", ")
+}
+
+func (o BotOverrides) validate(path string) Issues {
+	var issues Issues
+
+	currencies := []struct {
+		path  string
+		value string
+	}{
+		{"quote_currency", o.QuoteCurrency},
+		{"base_currency", o.BaseCurrency},
+	}
+	for _, currency := range currencies {
+		if currency.value != "" && !currencyPattern.MatchString(currency.value) {
+			issues = append(issues, Issue{
+				Path:    joinPath(path, currency.path),
+				Message: fmt.Sprintf("invalid currency %q, must be a single uppercase symbol such as USDT", currency.value),
+			})
+		}
+	}
+
+	issues = append(issues, o.OnUnavailable.validate(joinPath(path, "on_unavailable"))...)
+	return issues
+}
+
+// Pair applies the currency overrides to a 3Commas pair such as USDT_BTC, where the quote currency comes first.
+// Values which are not pairs are returned as is.
+func (o BotOverrides) Pair(pair string) string {
+	currencies := strings.SplitN(pair, "_", 2)
+	if len(currencies) != 2 {
+		return pair
+	}
+	if o.QuoteCurrency != "" {
+		currencies[0] = o.QuoteCurrency
+	}
+	if o.BaseCurrency != "" {
+		currencies[1] = o.BaseCurrency
+	}
+	return currencies[0] + "_" + currencies[1]
+}
@@ -0,0 +1,230 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mapping(id string, source, dest int) BotMapping {
+	return BotMapping{
+		ID:          id,
+		Source:      BotConfig{ID: source},
+		Destination: BotConfig{ID: dest},
+	}
+}
+
+func TestConfig_checkMappings(t *testing.T) {
+	tests := []struct {
+		name string
+		bots []BotMapping
+		want Issues
+	}{
+		{
+			name: "independent mappings",
+			bots: []BotMapping{mapping("a", 1, 2), mapping("b", 3, 4), mapping("c", 1, 4)},
+		},
+		{
+			name: "chained mappings",
+			bots: []BotMapping{mapping("a", 1, 2), mapping("b", 2, 3)},
+		},
+		{
+			name: "duplicate id",
+			bots: []BotMapping{mapping("a", 1, 2), mapping("a", 3, 4)},
+			want: Issues{
+				{Path: "bots[1].id", Message: "duplicate bot mapping id \"a\", first used by bots[0]"},
+			},
+		},
+		{
+			name: "source is destination",
+			bots: []BotMapping{mapping("a", 1, 1)},
+			want: Issues{
+				{Path: "bots[0].dest.bot_id", Message: "destination bot 1 is the same as the source bot"},
+			},
+		},
+		{
+			name: "duplicate source and destination",
+			bots: []BotMapping{mapping("a", 1, 2), mapping("b", 1, 2)},
+			want: Issues{
+				{Path: "bots[1]", Message: "bot 1 is already cloned to bot 2 by bots[0]"},
+			},
+		},
+		{
+			name: "two mapping cycle",
+			bots: []BotMapping{mapping("a", 1, 2), mapping("b", 2, 1)},
+			want: Issues{
+				{Path: "bots[0]", Message: "bot mappings form a cycle: a (1 -> 2), b (2 -> 1)"},
+			},
+		},
+		{
+			name: "simulated destinations",
+			bots: []BotMapping{
+				{ID: "a", Source: BotConfig{ID: 1}, Destination: BotConfig{Type: BotTypeSimulated}},
+				{ID: "b", Source: BotConfig{ID: 1}, Destination: BotConfig{Type: BotTypeSimulated}},
+				{ID: "c", Source: BotConfig{ID: 2}, Destination: BotConfig{ID: 1, Type: BotTypeSimulated}},
+				mapping("d", 1, 2),
+			},
+		},
+		{
+			name: "approval without an admin server",
+			bots: []BotMapping{{ID: "a", Source: BotConfig{ID: 1}, Destination: BotConfig{ID: 2}, RequireApproval: true}},
+			want: Issues{
+				{Severity: SeverityWarning, Path: "bots[0].require_approval", Message: "no admin server is configured (admin.listen), so deals awaiting approval can only expire"},
+			},
+		},
+		{
+			name: "three mapping cycle",
+			bots: []BotMapping{mapping("x", 7, 8), mapping("b", 2, 3), mapping("c", 3, 1), mapping("a", 1, 2)},
+			want: Issues{
+				{Path: "bots[1]", Message: "bot mappings form a cycle: b (2 -> 3), c (3 -> 1), a (1 -> 2)"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{Bots: tt.bots}
+			if got := c.checkMappings(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkMappings() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBotOverrides_validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides BotOverrides
+		want      Issues
+	}{
+		{
+			name:      "valid overrides",
+			overrides: BotOverrides{QuoteCurrency: "USD", BaseCurrency: "BTC", OnUnavailable: UnavailablePolicy{Default: ActionPanicSell}},
+		},
+		{
+			name:      "malformed currencies",
+			overrides: BotOverrides{QuoteCurrency: "usd", BaseCurrency: "USDT_BTC"},
+			want: Issues{
+				{Path: "overrides.quote_currency", Message: "invalid currency \"usd\", must be a single uppercase symbol such as USDT"},
+				{Path: "overrides.base_currency", Message: "invalid currency \"USDT_BTC\", must be a single uppercase symbol such as USDT"},
+			},
+		},
+		{
+			name:      "invalid policy",
+			overrides: BotOverrides{OnUnavailable: UnavailablePolicy{Funds: "sell"}},
+			want: Issues{
+				{
+					Path:    "overrides.on_unavailable.funds",
+					Message: "invalid action \"sell\", must be one of [ignore cancel panic_sell close_at_market_after_delay disable_source_bot notify_only]",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.overrides.validate("overrides"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBotOverrides_Pair(t *testing.T) {
+	tests := []struct {
+		name      string
+		overrides BotOverrides
+		pair      string
+		want      string
+	}{
+		{name: "no overrides", pair: "USDT_BTC", want: "USDT_BTC"},
+		{name: "quote", overrides: BotOverrides{QuoteCurrency: "USD"}, pair: "USDT_BTC", want: "USD_BTC"},
+		{name: "base", overrides: BotOverrides{BaseCurrency: "XBT"}, pair: "USDT_BTC", want: "USDT_XBT"},
+		{name: "not a pair", overrides: BotOverrides{QuoteCurrency: "USD"}, pair: "BTC", want: "BTC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.overrides.Pair(tt.pair); got != tt.want {
+				t.Errorf("Pair() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBotMapping_validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping BotMapping
+		want    Issues
+	}{
+		{name: "3commas bots", mapping: mapping("a", 1, 2)},
+		{
+			name:    "explicit 3commas type",
+			mapping: BotMapping{ID: "a", Source: BotConfig{ID: 1, Type: BotType3Commas}, Destination: BotConfig{ID: 2}},
+		},
+		{
+			name:    "simulated destination",
+			mapping: BotMapping{ID: "a", Source: BotConfig{ID: 1}, Destination: BotConfig{Type: BotTypeSimulated}},
+		},
+		{
+			name:    "simulated destination with a bot id",
+			mapping: BotMapping{ID: "a", Source: BotConfig{ID: 1}, Destination: BotConfig{ID: 2, Type: BotTypeSimulated}},
+			want: Issues{
+				{Severity: SeverityWarning, Path: "bots[0].dest.bot_id", Message: "simulated bots have no bot id, it is ignored"},
+			},
+		},
+		{
+			name:    "simulated source",
+			mapping: BotMapping{ID: "a", Source: BotConfig{Type: BotTypeSimulated}, Destination: BotConfig{ID: 2}},
+			want: Issues{
+				{Path: "bots[0].source.type", Message: "source bots cannot be simulated"},
+			},
+		},
+		{
+			name:    "unknown type",
+			mapping: BotMapping{ID: "a", Source: BotConfig{ID: 1}, Destination: BotConfig{ID: 2, Type: "paper"}},
+			want: Issues{
+				{Path: "bots[0].dest.type", Message: `invalid bot type "paper", must be "3commas" or "simulated"`},
+			},
+		},
+		{
+			name:    "approval timeout",
+			mapping: BotMapping{ID: "a", Source: BotConfig{ID: 1}, Destination: BotConfig{ID: 2}, RequireApproval: true, ApprovalTimeout: "1h"},
+		},
+		{
+			name:    "invalid approval timeout",
+			mapping: BotMapping{ID: "a", Source: BotConfig{ID: 1}, Destination: BotConfig{ID: 2}, RequireApproval: true, ApprovalTimeout: "soon"},
+			want: Issues{
+				{Path: "bots[0].approval_timeout", Message: `invalid approval timeout "soon", must be a positive duration such as 15m`},
+			},
+		},
+		{
+			name:    "approval timeout without approval",
+			mapping: BotMapping{ID: "a", Source: BotConfig{ID: 1}, Destination: BotConfig{ID: 2}, ApprovalTimeout: "1h"},
+			want: Issues{
+				{Severity: SeverityWarning, Path: "bots[0].approval_timeout", Message: "approval_timeout has no effect unless require_approval is set"},
+			},
+		},
+		{
+			name:    "approval of a simulated destination",
+			mapping: BotMapping{ID: "a", Source: BotConfig{ID: 1}, Destination: BotConfig{Type: BotTypeSimulated}, RequireApproval: true},
+			want: Issues{
+				{Severity: SeverityWarning, Path: "bots[0].require_approval", Message: "simulated destinations open their deals without approval"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.mapping.validate("bots[0]"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBotMapping_ApprovalExpiry(t *testing.T) {
+	if got := (BotMapping{ApprovalTimeout: "1h"}).ApprovalExpiry(); got != time.Hour {
+		t.Errorf("ApprovalExpiry() = %v, want 1h", got)
+	}
+	if got := (BotMapping{}).ApprovalExpiry(); got != DefaultApprovalTimeout {
+		t.Errorf("ApprovalExpiry() = %v, want %v", got, DefaultApprovalTimeout)
+	}
+}
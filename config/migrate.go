@@ -0,0 +1,323 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the config schema version understood and written by this release.  Files which do not declare a
+// version are treated as version 0.
+const CurrentVersion = 2
+
+// versionKey is the top level key holding the schema version of a file
+const versionKey = "version"
+
+// migration upgrades a document by a single schema version
+type migration struct {
+	// description summarises the change for config migrate
+	description string
+	// apply rewrites the top level mapping of a document, reporting whether anything other than the version changed.
+	// mappingFile is set for files pulled in by include, which only hold a bots list.
+	apply func(body *yaml.Node, mappingFile bool) (bool, error)
+}
+
+// migrations[i] upgrades a document from version i to version i+1.  There must be exactly CurrentVersion entries.
+var migrations = []migration{
+	{
+		description: "declare the schema version",
+		apply:       func(body *yaml.Node, mappingFile bool) (bool, error) { return false, nil },
+	},
+	{
+		description: "replace cancelUnavailableDeals and panicSellUnavailableDeals with on_unavailable",
+		apply:       migrateUnavailableFlags,
+	},
+}
+
+// Overrides replaced by on_unavailable in version 2
+const (
+	cancelUnavailableKey    = "cancelUnavailableDeals"
+	panicSellUnavailableKey = "panicSellUnavailableDeals"
+)
+
+// migrateUnavailableFlags translates the cancelUnavailableDeals and panicSellUnavailableDeals overrides of each bot
+// mapping into an on_unavailable policy.  panicSellUnavailableDeals never had any effect without
+// cancelUnavailableDeals, so that combination is dropped.
+func migrateUnavailableFlags(body *yaml.Node, mappingFile bool) (bool, error) {
+	bots := child(body, "bots")
+	if bots == nil || bots.Kind != yaml.SequenceNode {
+		return false, nil
+	}
+
+	changed := false
+	for i, bot := range bots.Content {
+		overrides := child(bot, "overrides")
+		if overrides == nil || overrides.Kind != yaml.MappingNode {
+			continue
+		}
+		path := joinPath(indexPath("bots", i), "overrides")
+
+		var cancel, panicSell bool
+		flags := []struct {
+			key   string
+			value *bool
+		}{
+			{cancelUnavailableKey, &cancel},
+			{panicSellUnavailableKey, &panicSell},
+		}
+		position := -1
+		var key, value *yaml.Node
+		for _, flag := range flags {
+			node := child(overrides, flag.key)
+			if node == nil {
+				continue
+			}
+			if err := node.Decode(flag.value); err != nil {
+				return changed, fmt.Errorf("%s: %v", joinPath(path, flag.key), err)
+			}
+			at, removed := removeKey(overrides, flag.key)
+			if position == -1 || at < position {
+				position, key, value = at, removed, node
+			}
+		}
+		if position == -1 {
+			continue
+		}
+		changed = true
+		if !cancel {
+			continue
+		}
+		if child(overrides, "on_unavailable") != nil {
+			return changed, fmt.Errorf("%s: %s cannot be combined with on_unavailable", path, cancelUnavailableKey)
+		}
+
+		action := ActionCancel
+		if panicSell {
+			action = ActionPanicSell
+		}
+		// Take the place, and comments, of the first flag replaced
+		comment := key.LineComment
+		if comment == "" {
+			comment = value.LineComment
+		}
+		policy := []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "on_unavailable", HeadComment: key.HeadComment, LineComment: comment},
+			{Kind: yaml.MappingNode, Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: "default"},
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: string(action)},
+			}},
+		}
+		overrides.Content = append(overrides.Content[:position], append(policy, overrides.Content[position:]...)...)
+	}
+	return changed, nil
+}
+
+// removeKey deletes a key from a mapping, returning the position it held within the mapping's content and the key
+// node removed
+func removeKey(mapping *yaml.Node, key string) (int, *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			removed := mapping.Content[i]
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return i, removed
+		}
+	}
+	return -1, nil
+}
+
+// version returns the schema version declared by the document
+func (d Document) version() (int, error) {
+	body := d.body()
+	if body == nil || body.Kind != yaml.MappingNode {
+		return 0, nil
+	}
+	node := child(body, versionKey)
+	if node == nil {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(node.Value)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid schema version %q", node.Value)
+	}
+	return version, nil
+}
+
+// migrate upgrades the document in place to CurrentVersion, returning the version it started at, a description of
+// each migration applied and whether any of them changed more than the version.  Comments are kept on every node the
+// migrations leave in place.
+func (d Document) migrate(mappingFile bool) (int, []string, bool, error) {
+	from, err := d.version()
+	if err != nil {
+		return 0, nil, false, err
+	}
+	if from > CurrentVersion {
+		return from, nil, false, fmt.Errorf("schema version %d is newer than this release supports (%d)", from, CurrentVersion)
+	}
+	if from == CurrentVersion {
+		return from, nil, false, nil
+	}
+
+	body := d.body()
+	if body == nil {
+		body = &yaml.Node{Kind: yaml.MappingNode}
+		d.root.Kind = yaml.DocumentNode
+		d.root.Content = []*yaml.Node{body}
+	}
+	if body.Kind != yaml.MappingNode {
+		return from, nil, false, fmt.Errorf("expected a mapping at the top of the file")
+	}
+
+	var applied []string
+	changed := false
+	for version := from; version < CurrentVersion; version++ {
+		c, err := migrations[version].apply(body, mappingFile)
+		if err != nil {
+			return from, applied, changed, fmt.Errorf("migrating from version %d: %v", version, err)
+		}
+		changed = changed || c
+		applied = append(applied, fmt.Sprintf("v%d -> v%d: %s", version, version+1, migrations[version].description))
+	}
+	setVersion(body, CurrentVersion)
+	return from, applied, changed, nil
+}
+
+// upgrade migrates an older document in memory so it can be decoded with the current structs, warning that the file
+// itself should be migrated if it relies on anything which has since changed.  A document newer than this release
+// is an error unless lenient is set.
+func (d Document) upgrade(mappingFile, lenient bool) Issues {
+	from, _, changed, err := d.migrate(mappingFile)
+	switch {
+	case err != nil:
+		issue := Issue{Path: versionKey, Message: err.Error()}
+		if lenient && from > CurrentVersion {
+			issue.Severity = SeverityWarning
+		}
+		return d.Locate(Issues{issue})
+	case changed:
+		return d.Locate(Issues{{
+			Severity: SeverityWarning,
+			Path:     versionKey,
+			Message: fmt.Sprintf("file uses schema version %d, the current version is %d, "+
+				"run `commacloner config migrate` to upgrade it", from, CurrentVersion),
+		}})
+	}
+	return nil
+}
+
+// setVersion sets the version key of a top level mapping, adding it as the first key if it is missing
+func setVersion(body *yaml.Node, version int) {
+	value := strconv.Itoa(version)
+	if node := child(body, versionKey); node != nil {
+		node.Value, node.Tag, node.Style = value, "!!int", 0
+		return
+	}
+	key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: versionKey}
+	// Keep any comment at the top of the file above the new key
+	if len(body.Content) != 0 {
+		key.HeadComment, body.Content[0].HeadComment = body.Content[0].HeadComment, ""
+	}
+	body.Content = append([]*yaml.Node{key, {Kind: yaml.ScalarNode, Tag: "!!int", Value: value}}, body.Content...)
+}
+
+// encode renders the document back to YAML
+func (d Document) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(d.root); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Migration describes the upgrade of a single file by Migrate
+type Migration struct {
+	File    string
+	From    int
+	Applied []string
+	// Backup is the copy of the original file, empty if the file was not written
+	Backup string
+}
+
+// Migrate upgrades a config file and every mapping file it includes to CurrentVersion.  Unless dryRun is set, each
+// file which changes is rewritten after its original contents are saved alongside it as FILE.vN.bak.
+func Migrate(path string, dryRun bool) ([]Migration, error) {
+	main, migration, err := migrateFile(path, false, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	var migrated []Migration
+	if migration != nil {
+		migrated = append(migrated, *migration)
+	}
+
+	var include struct {
+		Include []string `json:"include"`
+	}
+	if err := main.decode(&include); err != nil {
+		return migrated, err
+	}
+	files, issues := includedFiles(main, include.Include)
+	if err := issues.Err(); err != nil {
+		return migrated, err
+	}
+	for _, file := range files {
+		_, migration, err := migrateFile(file.name, true, dryRun)
+		if err != nil {
+			return migrated, err
+		}
+		if migration != nil {
+			migrated = append(migrated, *migration)
+		}
+	}
+	return migrated, nil
+}
+
+// migrateFile upgrades a single file, returning its migrated document and a description of the change, which is nil
+// if the file was already current
+func migrateFile(path string, mappingFile, dryRun bool) (Document, *Migration, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Document{}, nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Document{}, nil, fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+	doc, err := parseDocument(path, data)
+	if err != nil {
+		return doc, nil, err
+	}
+	from, applied, _, err := doc.migrate(mappingFile)
+	if err != nil {
+		return doc, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if len(applied) == 0 {
+		return doc, nil, nil
+	}
+
+	migration := &Migration{File: path, From: from, Applied: applied}
+	if dryRun {
+		return doc, migration, nil
+	}
+	out, err := doc.encode()
+	if err != nil {
+		return doc, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	backup := fmt.Sprintf("%s.v%d.bak", path, from)
+	if err := ioutil.WriteFile(backup, data, info.Mode().Perm()); err != nil {
+		return doc, nil, fmt.Errorf("could not write backup: %v", err)
+	}
+	if err := ioutil.WriteFile(path, out, info.Mode().Perm()); err != nil {
+		return doc, nil, err
+	}
+	migration.Backup = backup
+	return doc, migration, nil
+}
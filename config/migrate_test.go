@@ -0,0 +1,223 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMigrations(t *testing.T) {
+	if len(migrations) != CurrentVersion {
+		t.Errorf("have %d migrations, want one per version up to %d", len(migrations), CurrentVersion)
+	}
+}
+
+func TestDocument_migrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    string
+		from    int
+		applied int
+		changed bool
+		wantErr bool
+	}{
+		{
+			name:    "unversioned file",
+			data:    "# my config\napi:\n  key: abc # inline\n",
+			want:    "# my config\nversion: 2\napi:\n  key: abc # inline\n",
+			applied: 2,
+		},
+		{
+			name: "current file",
+			data: "version: 2\napi:\n  key: abc\n",
+			want: "version: 2\napi:\n  key: abc\n",
+			from: 2,
+		},
+		{
+			name:    "empty file",
+			data:    "",
+			want:    "version: 2\n",
+			applied: 2,
+		},
+		{
+			name: "cancel unavailable deals",
+			data: `version: 1
+bots:
+  - id: a
+    overrides:
+      quote_currency: USD
+      # cancel when unavailable
+      cancelUnavailableDeals: true # always
+      panicSellUnavailableDeals: false
+  - id: b
+    overrides:
+      panicSellUnavailableDeals: true
+      cancelUnavailableDeals: true
+  - id: c
+    overrides:
+      cancelUnavailableDeals: false
+      panicSellUnavailableDeals: true
+`,
+			want: `version: 2
+bots:
+  - id: a
+    overrides:
+      quote_currency: USD
+      # cancel when unavailable
+      on_unavailable: # always
+        default: cancel
+  - id: b
+    overrides:
+      on_unavailable:
+        default: panic_sell
+  - id: c
+    overrides: {}
+`,
+			from:    1,
+			applied: 1,
+			changed: true,
+		},
+		{
+			name:    "flag combined with policy",
+			data:    "version: 1\nbots:\n  - overrides:\n      cancelUnavailableDeals: true\n      on_unavailable:\n        default: ignore\n",
+			from:    1,
+			wantErr: true,
+		},
+		{
+			name:    "flag which is not a boolean",
+			data:    "version: 1\nbots:\n  - overrides:\n      cancelUnavailableDeals: sometimes\n",
+			from:    1,
+			wantErr: true,
+		},
+		{
+			name:    "newer file",
+			data:    "version: 99\n",
+			from:    99,
+			wantErr: true,
+		},
+		{
+			name:    "invalid version",
+			data:    "version: one\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseDocument("config.yaml", []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			from, applied, changed, err := doc.migrate(false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("migrate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if from != tt.from || len(applied) != tt.applied || changed != tt.changed {
+				t.Errorf("migrate() = %d, %v, %v, want from %d with %d migrations changed %v", from, applied, changed, tt.from, tt.applied, tt.changed)
+			}
+			out, err := doc.encode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("migrate() wrote\n%s\nwant\n%s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse_version(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		lenient bool
+		want    Issues
+	}{
+		{
+			name: "unversioned file",
+			data: baselineYAML,
+		},
+		{
+			name: "unversioned file using replaced keys",
+			data: baselineYAML + "    overrides:\n      cancelUnavailableDeals: true\n",
+			want: Issues{{
+				Severity: SeverityWarning,
+				Path:     "version",
+				Message:  "file uses schema version 0, the current version is 2, run `commacloner config migrate` to upgrade it",
+				File:     "config.yaml",
+				Line:     1,
+			}},
+		},
+		{
+			name: "newer file",
+			data: "version: 3\n" + baselineYAML,
+			want: Issues{{Path: "version", Message: "schema version 3 is newer than this release supports (2)", File: "config.yaml", Line: 1}},
+		},
+		{
+			name:    "newer file lenient",
+			data:    "version: 3\n" + baselineYAML,
+			lenient: true,
+			want:    Issues{{Severity: SeverityWarning, Path: "version", Message: "schema version 3 is newer than this release supports (2)", File: "config.yaml", Line: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, issues, _ := Parse("config.yaml", []byte(tt.data), Options{Lenient: tt.lenient})
+			if !reflect.DeepEqual(issues, tt.want) {
+				t.Errorf("Parse() issues = %v, want %v", issues, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"config.yaml":       "include:\n  - mappings.d/*.yaml\n",
+		"mappings.d/a.yaml": "bots: []\n",
+		"mappings.d/b.yaml": "version: 2\nbots: []\n",
+	})
+	path := filepath.Join(dir, "config.yaml")
+
+	migrated, err := Migrate(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrated) != 2 || migrated[0].Backup != "" {
+		t.Fatalf("Migrate() dry run = %+v, want 2 unwritten migrations", migrated)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "include:\n  - mappings.d/*.yaml\n" {
+		t.Errorf("Migrate() dry run wrote %q", data)
+	}
+
+	migrated, err = Migrate(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{path, filepath.Join(dir, "mappings.d/a.yaml")}
+	var files []string
+	for _, m := range migrated {
+		files = append(files, m.File)
+		backup, err := ioutil.ReadFile(m.Backup)
+		if err != nil {
+			t.Errorf("Migrate() backup of %s: %v", m.File, err)
+		}
+		if m.Backup != m.File+".v0.bak" || string(backup) == "" {
+			t.Errorf("Migrate() backup = %s (%q)", m.Backup, backup)
+		}
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("Migrate() files = %v, want %v", files, want)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "version: 2\ninclude:\n  - mappings.d/*.yaml\n" {
+		t.Errorf("Migrate() wrote %q", data)
+	}
+
+	if migrated, err = Migrate(path, false); err != nil || len(migrated) != 0 {
+		t.Errorf("Migrate() of current files = %v, %v, want nothing", migrated, err)
+	}
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix begins the name of every environment variable which overrides a config value.  The rest of the name is
+// the YAML path in upper case with levels separated by underscores, ie COMMACLONER_LOGGING_LEVEL for logging.level
+// or COMMACLONER_BOTS_0_DEST_BOT_ID for bots[0].dest.bot_id.
+const EnvPrefix = "COMMACLONER_"
+
+// reservedEnv are environment variables which share EnvPrefix but do not override config values
+var reservedEnv = map[string]bool{
+	PassphraseEnv: true,
+}
+
+// overlay replaces a single config value
+type overlay struct {
+	path   string
+	value  string
+	source string
+}
+
+// envOverlays collects the overlays given as environment variables, in KEY=value form.  Variables in referenced are
+// read by env: secret references instead, so they are not overlays even when their names share EnvPrefix.
+func envOverlays(environ []string, referenced map[string]bool) ([]overlay, Issues) {
+	var overlays []overlay
+	var issues Issues
+	for _, env := range environ {
+		eq := strings.Index(env, "=")
+		if eq == -1 || !strings.HasPrefix(env, EnvPrefix) || reservedEnv[env[:eq]] || referenced[env[:eq]] {
+			continue
+		}
+		name, value := env[:eq], env[eq+1:]
+		source := "$" + name
+		path, ok := envPath(reflect.TypeOf(Config{}), strings.TrimPrefix(name, EnvPrefix), "")
+		if !ok {
+			issues = append(issues, Issue{
+				Severity: SeverityWarning,
+				File:     source,
+				Message:  "environment variable does not match any config value",
+			})
+			continue
+		}
+		overlays = append(overlays, overlay{path: path, value: value, source: source})
+	}
+	return overlays, issues
+}
+
+// envReferences adds the environment variables named by env: secret references among the values of v to names
+func envReferences(v reflect.Value, names map[string]bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			envReferences(v.Elem(), names)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				envReferences(v.Field(i), names)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			envReferences(v.Index(i), names)
+		}
+	case reflect.String:
+		if value := v.String(); strings.HasPrefix(value, envSecretPrefix) {
+			names[strings.TrimPrefix(value, envSecretPrefix)] = true
+		}
+	}
+}
+
+// setOverlays collects the overlays given as path=value flags
+func setOverlays(sets []string) ([]overlay, Issues) {
+	var overlays []overlay
+	var issues Issues
+	for _, set := range sets {
+		eq := strings.Index(set, "=")
+		if eq <= 0 {
+			issues = append(issues, Issue{File: "--set", Message: fmt.Sprintf("expected path=value, got %q", set)})
+			continue
+		}
+		overlays = append(overlays, overlay{path: set[:eq], value: set[eq+1:], source: "--set"})
+	}
+	return overlays, issues
+}
+
+// envPath converts the remainder of an environment variable name into the YAML path it overrides
+func envPath(t reflect.Type, name, path string) (string, bool) {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return envPath(t.Elem(), name, path)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			key := jsonName(t.Field(i))
+			if key == "" {
+				continue
+			}
+			for _, envKey := range []string{strings.ToUpper(key), strings.ToUpper(snakeCase(key))} {
+				if name == envKey {
+					return joinPath(path, key), true
+				}
+				if strings.HasPrefix(name, envKey+"_") {
+					if found, ok := envPath(t.Field(i).Type, name[len(envKey)+1:], joinPath(path, key)); ok {
+						return found, true
+					}
+				}
+			}
+		}
+	case reflect.Slice:
+		index := name
+		rest := ""
+		if underscore := strings.Index(name, "_"); underscore != -1 {
+			index, rest = name[:underscore], name[underscore+1:]
+		}
+		i, err := strconv.Atoi(index)
+		if err != nil || i < 0 {
+			return "", false
+		}
+		if rest == "" {
+			return indexPath(path, i), true
+		}
+		return envPath(t.Elem(), rest, indexPath(path, i))
+	}
+	return "", false
+}
+
+// snakeCase converts a camelCase key to snake_case
+func snakeCase(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// applyOverlays sets each overlay in order, so later overlays take precedence over earlier ones
+func (c *Config) applyOverlays(overlays []overlay) Issues {
+	var issues Issues
+	for _, o := range overlays {
+		if err := setPath(reflect.ValueOf(c).Elem(), splitPath(o.path), o.value); err != nil {
+			issues = append(issues, Issue{Path: o.path, File: o.source, Message: err.Error()})
+			continue
+		}
+		c.setSource(o.path, o.source)
+	}
+	return issues
+}
+
+// setSource records that the value at path came from somewhere other than the config file
+func (c *Config) setSource(path, source string) {
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+	c.sources[path] = source
+}
+
+// Source describes where the value at the given YAML path came from, or returns an empty string if it was read from
+// the config file
+func (c Config) Source(path string) string {
+	return c.sources[path]
+}
+
+// setPath sets the value at the given path segments, parsing it as YAML for any non-string field
+func setPath(v reflect.Value, segments []string, value string) error {
+	if len(segments) == 0 {
+		if v.Kind() == reflect.String {
+			v.SetString(value)
+			return nil
+		}
+		var raw interface{}
+		if err := yaml.Unmarshal([]byte(value), &raw); err != nil {
+			return fmt.Errorf("invalid value %q: %v", value, err)
+		}
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return fmt.Errorf("invalid value %q: %v", value, err)
+		}
+		target := reflect.New(v.Type())
+		if err := json.Unmarshal(data, target.Interface()); err != nil {
+			return fmt.Errorf("invalid value %q for %s", value, v.Type())
+		}
+		v.Set(target.Elem())
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if jsonName(v.Type().Field(i)) == segments[0] {
+				return setPath(v.Field(i), segments[1:], value)
+			}
+		}
+		return fmt.Errorf("unknown key %q", segments[0])
+	case reflect.Slice:
+		i, err := strconv.Atoi(segments[0])
+		if err != nil || i < 0 || i >= v.Len() {
+			return fmt.Errorf("index %s out of range, there are %d entries", segments[0], v.Len())
+		}
+		return setPath(v.Index(i), segments[1:], value)
+	}
+	return fmt.Errorf("cannot set %q within a %s", segments[0], v.Kind())
+}
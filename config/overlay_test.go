@@ -0,0 +1,121 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_envPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    string
+		want   string
+		wantOk bool
+	}{
+		{name: "top level section", env: "LOGGING_LEVEL", want: "logging.level", wantOk: true},
+		{name: "key containing underscore", env: "API_REST_URL", want: "api.rest_url", wantOk: true},
+		{name: "sequence index", env: "BOTS_0_DEST_BOT_ID", want: "bots[0].dest.bot_id", wantOk: true},
+		{name: "nested keys containing underscores", env: "BOTS_2_OVERRIDES_ON_UNAVAILABLE_DEAL_LIMIT", want: "bots[2].overrides.on_unavailable.deal_limit", wantOk: true},
+		{name: "whole list", env: "INCLUDE", want: "include", wantOk: true},
+		{name: "unknown key", env: "LOGGING_COLOUR"},
+		{name: "bad index", env: "BOTS_X_ID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := envPath(reflect.TypeOf(Config{}), tt.env, "")
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("envPath() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
+func TestParse_overlays(t *testing.T) {
+	tests := []struct {
+		name        string
+		environ     []string
+		set         []string
+		wantLevel   string
+		wantDest    int
+		wantInclude []string
+		wantSource  string
+		wantIssues  Issues
+	}{
+		{
+			name:      "file value",
+			environ:   []string{"HOME=/root", PassphraseEnv + "=hunter2"},
+			wantLevel: "debug",
+			wantDest:  5678,
+		},
+		{
+			name:       "environment overrides file",
+			environ:    []string{"COMMACLONER_LOGGING_LEVEL=info", "COMMACLONER_BOTS_0_DEST_BOT_ID=42"},
+			wantLevel:  "info",
+			wantDest:   42,
+			wantSource: "$COMMACLONER_LOGGING_LEVEL",
+		},
+		{
+			name:        "flags override environment",
+			environ:     []string{"COMMACLONER_LOGGING_LEVEL=info"},
+			set:         []string{"logging.level=warn", "include=[a.yaml, b.yaml]"},
+			wantLevel:   "warn",
+			wantDest:    5678,
+			wantInclude: []string{"a.yaml", "b.yaml"},
+			wantSource:  "--set",
+		},
+		{
+			name:      "bad overrides",
+			environ:   []string{"COMMACLONER_LOGGING_COLOUR=red"},
+			set:       []string{"bots[0].dest.bot_id=abc", "bots[3].id=x", "nonsense"},
+			wantLevel: "debug",
+			wantDest:  5678,
+			wantIssues: Issues{
+				{Severity: SeverityWarning, File: "$COMMACLONER_LOGGING_COLOUR", Message: "environment variable does not match any config value"},
+				{File: "--set", Message: "expected path=value, got \"nonsense\""},
+				{Path: "bots[0].dest.bot_id", File: "--set", Message: "invalid value \"abc\" for int"},
+				{Path: "bots[3].id", File: "--set", Message: "index 3 out of range, there are 1 entries"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, issues, err := Parse("config.yaml", []byte(baselineYAML), Options{Environ: tt.environ, Set: tt.set})
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(issues, tt.wantIssues) {
+				t.Errorf("Parse() issues = %v, want %v", issues, tt.wantIssues)
+			}
+			if c.Logging.Level != tt.wantLevel || c.Bots[0].Destination.ID != tt.wantDest {
+				t.Errorf("Parse() level = %v, dest = %v, want %v, %v", c.Logging.Level, c.Bots[0].Destination.ID, tt.wantLevel, tt.wantDest)
+			}
+			if !reflect.DeepEqual(c.Include, tt.wantInclude) {
+				t.Errorf("Parse() include = %v, want %v", c.Include, tt.wantInclude)
+			}
+			if got := c.Source("logging.level"); got != tt.wantSource {
+				t.Errorf("Source() = %v, want %v", got, tt.wantSource)
+			}
+		})
+	}
+}
+
+func TestParse_envReferences(t *testing.T) {
+	data := strings.Replace(baselineYAML, `secret: "asdfghjkl"`, `secret: "env:COMMACLONER_SECRET"`, 1) + `admin:
+  listen: "127.0.0.1:8421"
+  token: "env:COMMACLONER_ADMIN_TOKEN"
+`
+	t.Setenv("COMMACLONER_SECRET", "asdfghjkl")
+	t.Setenv("COMMACLONER_ADMIN_TOKEN", "t0k3n")
+	environ := []string{"COMMACLONER_SECRET=asdfghjkl", "COMMACLONER_ADMIN_TOKEN=t0k3n"}
+	c, issues, err := Parse("config.yaml", []byte(data), Options{Environ: environ})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("Parse() issues = %v, want none", issues)
+	}
+	if c.API.Secret != "asdfghjkl" || c.Admin.Token != "t0k3n" {
+		t.Errorf("Parse() secret = %v, token = %v, want the referenced variables", c.API.Secret, c.Admin.Token)
+	}
+}
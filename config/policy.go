@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// UnavailableAction is what happens to a source deal which could not be started on the destination bot
+type UnavailableAction string
+
+// Actions which may be taken on a source deal which could not be started on the destination bot
+const (
+	// ActionIgnore leaves the source deal running
+	ActionIgnore UnavailableAction = "ignore"
+	// ActionCancel cancels the source deal, leaving any position it holds
+	ActionCancel UnavailableAction = "cancel"
+	// ActionPanicSell cancels the source deal and sells its position at market
+	ActionPanicSell UnavailableAction = "panic_sell"
+	// ActionCloseAfterDelay panic sells the source deal once the policy's close delay has passed
+	ActionCloseAfterDelay UnavailableAction = "close_at_market_after_delay"
+	// ActionDisableSourceBot leaves the source deal running but stops the source bot opening any more
+	ActionDisableSourceBot UnavailableAction = "disable_source_bot"
+	// ActionNotifyOnly leaves the source deal running and logs the failure as an error
+	ActionNotifyOnly UnavailableAction = "notify_only"
+)
+
+// unavailableActions lists every accepted action, matching the enum tags on UnavailablePolicy
+var unavailableActions = []UnavailableAction{
+	ActionIgnore, ActionCancel, ActionPanicSell, ActionCloseAfterDelay, ActionDisableSourceBot, ActionNotifyOnly,
+}
+
+// UnavailableReason classifies why a deal could not be started on the destination bot
+type UnavailableReason string
+
+// Reasons a deal could not be started on the destination bot
+const (
+	// ReasonPairMissing means the pair is not traded on the destination bot's exchange or not enabled on the bot
+	ReasonPairMissing UnavailableReason = "pair_missing"
+	// ReasonDealLimit means the destination bot already has its maximum number of active deals
+	ReasonDealLimit UnavailableReason = "deal_limit"
+	// ReasonFunds means the destination account does not have the funds to open the deal
+	ReasonFunds UnavailableReason = "funds"
+	// ReasonOther covers every other failure, including network errors
+	ReasonOther UnavailableReason = "other"
+	// ReasonApprovalExpired means the deal waited for approval longer than the mapping's approval_timeout.  It takes
+	// the default action.
+	ReasonApprovalExpired UnavailableReason = "approval_expired"
+)
+
+// DefaultCloseDelay is how long close_at_market_after_delay waits when no close_delay is given
+const DefaultCloseDelay = 5 * time.Minute
+
+// UnavailablePolicy decides what happens to a source deal which could not be started on the destination bot.  Each
+// reason may be given its own action, falling back to Default, and then to ignore.
+type UnavailablePolicy struct {
+	Default     UnavailableAction `json:"default" enum:"ignore,cancel,panic_sell,close_at_market_after_delay,disable_source_bot,notify_only"`
+	PairMissing UnavailableAction `json:"pair_missing" enum:"ignore,cancel,panic_sell,close_at_market_after_delay,disable_source_bot,notify_only"`
+	DealLimit   UnavailableAction `json:"deal_limit" enum:"ignore,cancel,panic_sell,close_at_market_after_delay,disable_source_bot,notify_only"`
+	Funds       UnavailableAction `json:"funds" enum:"ignore,cancel,panic_sell,close_at_market_after_delay,disable_source_bot,notify_only"`
+
+	// CloseDelay is how long close_at_market_after_delay waits before selling, ie "10m"
+	CloseDelay string `json:"close_delay"`
+}
+
+// Action returns the action to take for a deal which failed for the given reason
+func (p UnavailablePolicy) Action(reason UnavailableReason) UnavailableAction {
+	var action UnavailableAction
+	switch reason {
+	case ReasonPairMissing:
+		action = p.PairMissing
+	case ReasonDealLimit:
+		action = p.DealLimit
+	case ReasonFunds:
+		action = p.Funds
+	}
+	if action == "" {
+		action = p.Default
+	}
+	if action == "" {
+		action = ActionIgnore
+	}
+	return action
+}
+
+// Delay returns how long close_at_market_after_delay waits before selling
+func (p UnavailablePolicy) Delay() time.Duration {
+	delay, err := time.ParseDuration(p.CloseDelay)
+	if err != nil || delay <= 0 {
+		return DefaultCloseDelay
+	}
+	return delay
+}
+
+func (p UnavailablePolicy) validate(path string) Issues {
+	var issues Issues
+
+	actions := []struct {
+		path   string
+		action UnavailableAction
+	}{
+		{"default", p.Default},
+		{"pair_missing", p.PairMissing},
+		{"deal_limit", p.DealLimit},
+		{"funds", p.Funds},
+	}
+	delayed := false
+	for _, a := range actions {
+		if a.action != "" && !a.action.Valid() {
+			issues = append(issues, Issue{
+				Path:    joinPath(path, a.path),
+				Message: fmt.Sprintf("invalid action %q, must be one of %v", a.action, unavailableActions),
+			})
+		}
+		delayed = delayed || a.action == ActionCloseAfterDelay
+	}
+
+	if p.CloseDelay != "" {
+		if delay, err := time.ParseDuration(p.CloseDelay); err != nil || delay <= 0 {
+			issues = append(issues, Issue{
+				Path:    joinPath(path, "close_delay"),
+				Message: fmt.Sprintf("invalid close delay %q, must be a positive duration such as 10m", p.CloseDelay),
+			})
+		} else if !delayed {
+			issues = append(issues, Issue{
+				Severity: SeverityWarning,
+				Path:     joinPath(path, "close_delay"),
+				Message:  "close_delay has no effect unless an action is close_at_market_after_delay",
+			})
+		}
+	}
+	return issues
+}
+
+// Valid reports whether the action is one of those accepted
+func (a UnavailableAction) Valid() bool {
+	for _, action := range unavailableActions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
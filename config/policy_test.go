@@ -0,0 +1,76 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnavailablePolicy_Action(t *testing.T) {
+	policy := UnavailablePolicy{Default: ActionCancel, DealLimit: ActionNotifyOnly}
+	tests := []struct {
+		name   string
+		policy UnavailablePolicy
+		reason UnavailableReason
+		want   UnavailableAction
+	}{
+		{name: "reason specific action", policy: policy, reason: ReasonDealLimit, want: ActionNotifyOnly},
+		{name: "falls back to default", policy: policy, reason: ReasonFunds, want: ActionCancel},
+		{name: "other failures use default", policy: policy, reason: ReasonOther, want: ActionCancel},
+		{name: "empty policy ignores", reason: ReasonPairMissing, want: ActionIgnore},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Action(tt.reason); got != tt.want {
+				t.Errorf("Action() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnavailablePolicy_Delay(t *testing.T) {
+	if got := (UnavailablePolicy{CloseDelay: "90s"}).Delay(); got != 90*time.Second {
+		t.Errorf("Delay() = %v, want 90s", got)
+	}
+	if got := (UnavailablePolicy{}).Delay(); got != DefaultCloseDelay {
+		t.Errorf("Delay() = %v, want %v", got, DefaultCloseDelay)
+	}
+}
+
+func TestUnavailablePolicy_validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy UnavailablePolicy
+		want   Issues
+	}{
+		{
+			name:   "valid policy",
+			policy: UnavailablePolicy{Default: ActionIgnore, Funds: ActionCloseAfterDelay, CloseDelay: "10m"},
+		},
+		{
+			name:   "invalid close delay",
+			policy: UnavailablePolicy{Default: ActionCloseAfterDelay, CloseDelay: "soon"},
+			want: Issues{
+				{Path: "on_unavailable.close_delay", Message: "invalid close delay \"soon\", must be a positive duration such as 10m"},
+			},
+		},
+		{
+			name:   "unused close delay",
+			policy: UnavailablePolicy{Default: ActionCancel, CloseDelay: "10m"},
+			want: Issues{
+				{
+					Severity: SeverityWarning,
+					Path:     "on_unavailable.close_delay",
+					Message:  "close_delay has no effect unless an action is close_at_market_after_delay",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.validate("on_unavailable"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("validate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
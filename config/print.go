@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values when printing the configuration
+const redacted = "<redacted>"
+
+// Print renders the configuration as YAML.  Fields tagged `secret:"true"` are redacted, and any value which did not
+// come from the config file is annotated with where it came from.
+func (c Config) Print() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.node(reflect.ValueOf(c), "", false)); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// node builds the YAML node for a value, keeping struct fields in their declared order
+func (c Config) node(v reflect.Value, path string, secret bool) *yaml.Node {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+		}
+		return c.node(v.Elem(), path, secret)
+	case reflect.Struct:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name := jsonName(field)
+			if name == "" {
+				continue
+			}
+			fieldPath := joinPath(path, name)
+			value := c.node(v.Field(i), fieldPath, field.Tag.Get("secret") == "true")
+			if source := c.Source(fieldPath); source != "" {
+				value.LineComment = "from " + source
+			}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, value)
+		}
+		return node
+	case reflect.Slice, reflect.Array:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for i := 0; i < v.Len(); i++ {
+			node.Content = append(node.Content, c.node(v.Index(i), indexPath(path, i), secret))
+		}
+		if v.Type().Elem() == reflect.TypeOf(BotMapping{}) && len(c.Include) != 0 {
+			for i, item := range node.Content {
+				if origin := c.Bots[i].Origin(); origin != "" {
+					item.HeadComment = "from " + origin
+				}
+			}
+		}
+		return node
+	case reflect.Map:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, key := range v.MapKeys() {
+			node.Content = append(node.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: fmt.Sprint(key.Interface())},
+				c.node(v.MapIndex(key), joinPath(path, fmt.Sprint(key.Interface())), secret))
+		}
+		return node
+	case reflect.String:
+		value := v.String()
+		if secret && value != "" {
+			value = redacted
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Style: yaml.DoubleQuotedStyle, Value: value}
+	case reflect.Bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v.Bool())}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.FormatInt(v.Int(), 10)}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.FormatUint(v.Uint(), 10)}
+	case reflect.Float32, reflect.Float64:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: strconv.FormatFloat(v.Float(), 'g', -1, 64)}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+}
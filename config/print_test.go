@@ -0,0 +1,38 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfig_Print(t *testing.T) {
+	c, _, err := Parse("config.yaml", []byte(baselineYAML), Options{Set: []string{"logging.level=info"}})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	out, err := c.Print()
+	if err != nil {
+		t.Fatalf("Print() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		want    string
+		present bool
+	}{
+		{name: "key redacted", want: `key: "<redacted>"`, present: true},
+		{name: "secret redacted", want: `secret: "<redacted>"`, present: true},
+		{name: "plaintext secret", want: "asdfghjkl"},
+		{name: "empty secret file not redacted", want: `secret_file: ""`, present: true},
+		{name: "override annotated", want: `level: "info" # from --set`, present: true},
+		{name: "fields in declared order", want: "api:\n  key:", present: true},
+		{name: "integers unquoted", want: "bot_id: 1234", present: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Contains(string(out), tt.want); got != tt.present {
+				t.Errorf("Print() contains %q = %v, want %v\n%s", tt.want, got, tt.present, out)
+			}
+		})
+	}
+}
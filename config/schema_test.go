@@ -0,0 +1,41 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	data, err := Schema()
+	if err != nil {
+		t.Fatalf("Schema() error = %v", err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("Schema() produced invalid json: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		path []string
+		want interface{}
+	}{
+		{name: "draft", path: []string{"$schema"}, want: schemaDraft},
+		{name: "bots are an array", path: []string{"properties", "bots", "type"}, want: "array"},
+		{name: "bot ids are integers", path: []string{"properties", "bots", "items", "properties", "source", "properties", "bot_id", "type"}, want: "integer"},
+		{name: "log format enum", path: []string{"properties", "logging", "properties", "format", "enum"}, want: []interface{}{"json", "console"}},
+		{name: "unknown keys rejected", path: []string{"properties", "api", "additionalProperties"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got interface{} = schema
+			for _, key := range tt.path {
+				got = got.(map[string]interface{})[key]
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Schema() %v = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
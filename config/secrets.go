@@ -0,0 +1,244 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Secret references.  A key or secret beginning with one of these prefixes is resolved when the config is loaded
+// rather than used as is.
+const (
+	// envSecretPrefix reads the secret from the named environment variable, ie env:COMMACLONER_SECRET
+	envSecretPrefix = "env:"
+	// fileSecretPrefix reads the secret from a file, ie file:/run/secrets/3commas_secret
+	fileSecretPrefix = "file:"
+	// execSecretPrefix runs a helper command and uses its output, ie exec:pass show 3commas/secret.  The command is
+	// split on whitespace and run directly, not through a shell.
+	execSecretPrefix = "exec:"
+)
+
+// execSecretTimeout bounds how long a secret helper command may run
+const execSecretTimeout = 30 * time.Second
+
+// expandEnv applies os.ExpandEnv to every string field tagged `expand:"env"`.  Expansion is limited to these fields
+// so a `$` anywhere else in the file is left untouched.
+func expandEnv(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			expandEnv(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if field.Type.Kind() == reflect.String && field.Tag.Get("expand") == "env" {
+				v.Field(i).SetString(os.ExpandEnv(v.Field(i).String()))
+				continue
+			}
+			expandEnv(v.Field(i))
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			expandEnv(v.Index(i))
+		}
+	}
+}
+
+// resolveSecrets replaces the key and secret with the values they reference or decrypt to, reporting any which fail
+// to resolve.  With checkOnly the references are only checked to be well formed and left as they are.
+func (c *API) resolveSecrets(path string, passphrase func() (string, error), checkOnly bool) Issues {
+	var issues Issues
+
+	secrets := []struct {
+		value     *string
+		file      string
+		path      string
+		filePath  string
+		secretFor string
+	}{
+		{&c.Key, c.KeyFile, "key", "key_file", "api key"},
+		{&c.Secret, c.SecretFile, "secret", "secret_file", "api secret"},
+	}
+	for _, secret := range secrets {
+		if secret.file != "" {
+			if *secret.value != "" {
+				issues = append(issues, Issue{
+					Path:    joinPath(path, secret.filePath),
+					Message: fmt.Sprintf("%s and %s are mutually exclusive", secret.path, secret.filePath),
+				})
+				continue
+			}
+			*secret.value = fileSecretPrefix + secret.file
+		}
+
+		if isInlineSecret(*secret.value) {
+			continue
+		}
+
+		resolved, err := resolveSecretValue(*secret.value, passphrase, checkOnly)
+		if err != nil {
+			p := secret.path
+			if secret.file != "" {
+				p = secret.filePath
+			}
+			issues = append(issues, Issue{
+				Path:    joinPath(path, p),
+				Message: fmt.Sprintf("could not resolve %s: %v", secret.secretFor, err),
+			})
+			continue
+		}
+		*secret.value = resolved
+	}
+	return issues
+}
+
+// resolveSecrets replaces the admin token with the value it references or decrypts to.  With checkOnly the reference
+// is only checked to be well formed and left as it is.
+func (a *Admin) resolveSecrets(path string, passphrase func() (string, error), checkOnly bool) Issues {
+	if a.Token == "" || isInlineSecret(a.Token) {
+		return nil
+	}
+	resolved, err := resolveSecretValue(a.Token, passphrase, checkOnly)
+	if err != nil {
+		return Issues{{Path: joinPath(path, "token"), Message: fmt.Sprintf("could not resolve admin token: %v", err)}}
+	}
+	a.Token = resolved
+	return nil
+}
+
+// resolveSecretValue resolves a secret reference and decrypts the secret it gives, if encrypted.  With checkOnly a
+// reference is only checked, so no file is read and no helper command run, and the value is returned as it is.  An
+// encrypted secret is then only checked to be well formed too, unless the passphrase is set in the environment.
+func resolveSecretValue(value string, passphrase func() (string, error), checkOnly bool) (string, error) {
+	if checkOnly && isSecretReference(value) {
+		return value, checkSecretReference(value)
+	}
+	if checkOnly && IsEncryptedSecret(value) {
+		if err := checkEncryptedSecret(value); err != nil {
+			return value, err
+		}
+		key, err := EnvPassphrase()
+		if err != nil {
+			return value, nil
+		}
+		return DecryptSecret(value, key)
+	}
+	resolved, err := resolveSecret(value)
+	if err == nil && IsEncryptedSecret(resolved) {
+		var key string
+		if key, err = passphrase(); err == nil {
+			resolved, err = DecryptSecret(resolved, key)
+		}
+	}
+	return resolved, err
+}
+
+// isInlineSecret reports whether a value is a plaintext secret rather than a reference, an environment variable or an
+// encrypted secret
+func isInlineSecret(value string) bool {
+	return value != "" && !isSecretReference(value) && !referencesEnv(value) && !IsEncryptedSecret(value)
+}
+
+// referencesEnv reports whether a value, before expandEnv, refers to an environment variable
+func referencesEnv(value string) bool {
+	found := false
+	os.Expand(value, func(string) string {
+		found = true
+		return ""
+	})
+	return found
+}
+
+// hasInlineSecrets reports whether the config file holds a plaintext key or secret.  Values given as overrides are
+// not counted as they are not stored in the file.
+func (c Config) hasInlineSecrets() bool {
+	return isInlineSecret(c.API.Key) && c.Source("api.key") == "" ||
+		isInlineSecret(c.API.Secret) && c.Source("api.secret") == ""
+}
+
+// isSecretReference reports whether a value refers to a secret stored elsewhere
+func isSecretReference(value string) bool {
+	return strings.HasPrefix(value, envSecretPrefix) ||
+		strings.HasPrefix(value, fileSecretPrefix) ||
+		strings.HasPrefix(value, execSecretPrefix)
+}
+
+// checkSecretReference checks a secret reference names what it refers to, without resolving it
+func checkSecretReference(value string) error {
+	switch {
+	case strings.HasPrefix(value, envSecretPrefix):
+		if strings.TrimSpace(strings.TrimPrefix(value, envSecretPrefix)) == "" {
+			return errors.New("no environment variable given")
+		}
+	case strings.HasPrefix(value, fileSecretPrefix):
+		if strings.TrimSpace(strings.TrimPrefix(value, fileSecretPrefix)) == "" {
+			return errors.New("no file given")
+		}
+	case strings.HasPrefix(value, execSecretPrefix):
+		if len(strings.Fields(strings.TrimPrefix(value, execSecretPrefix))) == 0 {
+			return errors.New("no command given")
+		}
+	}
+	return nil
+}
+
+// resolveSecret returns the value a secret reference points to.  Values which are not references are returned as is.
+func resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, envSecretPrefix):
+		name := strings.TrimPrefix(value, envSecretPrefix)
+		secret, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return secret, nil
+	case strings.HasPrefix(value, fileSecretPrefix):
+		data, err := ioutil.ReadFile(strings.TrimPrefix(value, fileSecretPrefix))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	case strings.HasPrefix(value, execSecretPrefix):
+		args := strings.Fields(strings.TrimPrefix(value, execSecretPrefix))
+		if len(args) == 0 {
+			return "", fmt.Errorf("no command given")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), execSecretTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", args[0], err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	return value, nil
+}
+
+// checkFileMode warns when a config file containing inline secrets can be read by users other than its owner
+func checkFileMode(path string, c Config) Issues {
+	if !c.API.inlineSecrets {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.Mode().Perm()&0077 == 0 {
+		return nil
+	}
+	return Issues{{
+		Severity: SeverityWarning,
+		Path:     "api",
+		Message: fmt.Sprintf("config file contains inline secrets but is readable by other users (mode %04o), "+
+			"consider chmod 600 or key_file/secret_file", info.Mode().Perm()),
+	}}
+}
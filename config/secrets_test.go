@@ -0,0 +1,219 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_resolveSecret(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	if err := ioutil.WriteFile(secretFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("COMMACLONER_TEST_SECRET", "from-env")
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "inline", value: "s0m3s3cr3t!!", want: "s0m3s3cr3t!!"},
+		{name: "env", value: "env:COMMACLONER_TEST_SECRET", want: "from-env"},
+		{name: "unset env", value: "env:COMMACLONER_TEST_UNSET", wantErr: true},
+		{name: "file", value: "file:" + secretFile, want: "from-file"},
+		{name: "missing file", value: "file:" + filepath.Join(dir, "missing"), wantErr: true},
+		{name: "exec", value: "exec:echo from-exec", want: "from-exec"},
+		{name: "failing exec", value: "exec:false", wantErr: true},
+		{name: "empty exec", value: "exec:", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveSecret(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("resolveSecret() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("resolveSecret() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPI_resolveSecrets(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := ioutil.WriteFile(keyFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		api        API
+		wantKey    string
+		wantSecret string
+		checkOnly  bool
+		wantIssues Issues
+	}{
+		{
+			name:       "inline secrets",
+			api:        API{Key: "abcd1234", Secret: "a1b2c3d4e5"},
+			wantKey:    "abcd1234",
+			wantSecret: "a1b2c3d4e5",
+		},
+		{
+			name:       "key file and exec secret",
+			api:        API{KeyFile: keyFile, Secret: "exec:echo a1b2c3d4e5"},
+			wantKey:    "from-file",
+			wantSecret: "a1b2c3d4e5",
+		},
+		{
+			name:       "key and key file",
+			api:        API{Key: "abcd1234", KeyFile: keyFile, Secret: "exec:echo a1b2c3d4e5"},
+			wantKey:    "abcd1234",
+			wantSecret: "a1b2c3d4e5",
+			wantIssues: Issues{{Path: "api.key_file", Message: "key and key_file are mutually exclusive"}},
+		},
+		{
+			name:       "checked, not run",
+			api:        API{KeyFile: keyFile, Secret: "exec:touch " + filepath.Join(dir, "ran")},
+			checkOnly:  true,
+			wantKey:    "file:" + keyFile,
+			wantSecret: "exec:touch " + filepath.Join(dir, "ran"),
+		},
+		{
+			name:       "checked, malformed",
+			api:        API{Key: "env:", Secret: "exec: "},
+			checkOnly:  true,
+			wantKey:    "env:",
+			wantSecret: "exec: ",
+			wantIssues: Issues{
+				{Path: "api.key", Message: "could not resolve api key: no environment variable given"},
+				{Path: "api.secret", Message: "could not resolve api secret: no command given"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := tt.api
+			issues := a.resolveSecrets("api", EnvPassphrase, tt.checkOnly)
+			if !reflect.DeepEqual(issues, tt.wantIssues) {
+				t.Errorf("resolveSecrets() = %v, want %v", issues, tt.wantIssues)
+			}
+			if a.Key != tt.wantKey || a.Secret != tt.wantSecret {
+				t.Errorf("resolveSecrets() resolved key %q secret %q, want %q %q", a.Key, a.Secret, tt.wantKey, tt.wantSecret)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "ran")); err == nil {
+				t.Error("resolveSecrets() ran a helper command")
+			}
+		})
+	}
+}
+
+func Test_resolveSecretValue_encrypted(t *testing.T) {
+	encrypted, err := EncryptSecret("a1b2c3d4e5", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	noPassphrase := func() (string, error) { t.Fatal("asked for the passphrase"); return "", nil }
+
+	// checked without a passphrase, decrypted with the one in the environment
+	t.Setenv(PassphraseEnv, "")
+	if got, err := resolveSecretValue(encrypted, noPassphrase, true); err != nil || got != encrypted {
+		t.Errorf("resolveSecretValue() = %q, %v, want it checked and left as it is", got, err)
+	}
+	if _, err := resolveSecretValue("enc:v1:AAAA", noPassphrase, true); err == nil {
+		t.Error("resolveSecretValue() of a malformed secret expected error")
+	}
+	t.Setenv(PassphraseEnv, "hunter2")
+	if got, err := resolveSecretValue(encrypted, noPassphrase, true); err != nil || got != "a1b2c3d4e5" {
+		t.Errorf("resolveSecretValue() = %q, %v, want it decrypted", got, err)
+	}
+	t.Setenv(PassphraseEnv, "hunter3")
+	if _, err := resolveSecretValue(encrypted, noPassphrase, true); err == nil {
+		t.Error("resolveSecretValue() with the wrong passphrase expected error")
+	}
+}
+
+func TestConfig_hasInlineSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		api     API
+		sources map[string]string
+		want    bool
+	}{
+		{name: "inline key", api: API{Key: "abcd1234", Secret: "env:SECRET"}, want: true},
+		{name: "references", api: API{Key: "file:/run/secrets/key", Secret: "exec:pass show secret"}},
+		{name: "encrypted", api: API{Key: "enc:v1:AAAA", Secret: "enc:v1:BBBB"}},
+		{name: "environment variables", api: API{Key: "$COMMACLONER_API_KEY", Secret: "${COMMACLONER_API_SECRET}"}},
+		{name: "inline secret beside a variable", api: API{Key: "$COMMACLONER_API_KEY", Secret: "a1b2c3d4e5"}, want: true},
+		{name: "overridden", api: API{Key: "abcd1234", Secret: "a1b2c3d4e5"}, sources: map[string]string{
+			"api.key":    "$COMMACLONER_API_KEY",
+			"api.secret": "$COMMACLONER_API_SECRET",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Config{API: tt.api, sources: tt.sources}
+			if got := c.hasInlineSecrets(); got != tt.want {
+				t.Errorf("hasInlineSecrets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_expandEnv(t *testing.T) {
+	t.Setenv("COMMACLONER_TEST_KEY", "expanded")
+
+	c := Config{
+		API: API{Key: "${COMMACLONER_TEST_KEY}", RestURL: "https://example.com/$COMMACLONER_TEST_KEY"},
+		Bots: []BotMapping{
+			{ID: "$COMMACLONER_TEST_KEY"},
+		},
+	}
+	expandEnv(reflect.ValueOf(&c))
+
+	if c.API.Key != "expanded" {
+		t.Errorf("expandEnv() key = %v, want expanded", c.API.Key)
+	}
+	if c.API.RestURL != "https://example.com/$COMMACLONER_TEST_KEY" {
+		t.Errorf("expandEnv() expanded unmarked field rest_url = %v", c.API.RestURL)
+	}
+	if c.Bots[0].ID != "$COMMACLONER_TEST_KEY" {
+		t.Errorf("expandEnv() expanded unmarked field id = %v", c.Bots[0].ID)
+	}
+}
+
+func Test_checkFileMode(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name      string
+		mode      os.FileMode
+		inline    bool
+		wantIssue bool
+	}{
+		{name: "private file with inline secrets", mode: 0600, inline: true},
+		{name: "world readable file with inline secrets", mode: 0644, inline: true, wantIssue: true},
+		{name: "world readable file with referenced secrets", mode: 0644},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name)
+			if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(path, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			c := Config{API: API{inlineSecrets: tt.inline}}
+			if got := checkFileMode(path, c); (len(got) != 0) != tt.wantIssue {
+				t.Errorf("checkFileMode() = %v, wantIssue %v", got, tt.wantIssue)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mergeKey is the YAML merge key, which is always permitted
+const mergeKey = "<<"
+
+// checkKeys walks the YAML node tree alongside the config structs, reporting any keys which do not map to a field as
+// well as any key defined more than once within the same mapping.  Unknown keys are reported as warnings when
+// lenient is set; duplicate keys are always errors as there is no way to tell which value was intended.
+func checkKeys(node *yaml.Node, t reflect.Type, path string, lenient bool) Issues {
+	if node == nil {
+		return nil
+	}
+	if node.Kind == yaml.AliasNode {
+		return checkKeys(node.Alias, t, path, lenient)
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var issues Issues
+	switch node.Kind {
+	case yaml.MappingNode:
+		var fields map[string]reflect.Type
+		switch t.Kind() {
+		case reflect.Struct:
+			fields = structFields(t)
+		case reflect.Map:
+		default:
+			return nil
+		}
+
+		seen := make(map[string]int)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == mergeKey {
+				continue
+			}
+			keyPath := joinPath(path, key.Value)
+			if line, ok := seen[key.Value]; ok {
+				issues = append(issues, Issue{
+					Path:    keyPath,
+					Message: fmt.Sprintf("duplicate key %q, first defined on line %d", key.Value, line),
+					Line:    key.Line,
+				})
+				continue
+			}
+			seen[key.Value] = key.Line
+
+			var fieldType reflect.Type
+			if fields == nil {
+				fieldType = t.Elem()
+			} else {
+				var ok bool
+				if fieldType, ok = fields[key.Value]; !ok {
+					issue := Issue{Path: keyPath, Message: unknownKeyMessage(key.Value, fields), Line: key.Line}
+					if lenient {
+						issue.Severity = SeverityWarning
+					}
+					issues = append(issues, issue)
+					continue
+				}
+			}
+			issues = append(issues, checkKeys(value, fieldType, keyPath, lenient)...)
+		}
+	case yaml.SequenceNode:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return nil
+		}
+		for i, item := range node.Content {
+			issues = append(issues, checkKeys(item, t.Elem(), indexPath(path, i), lenient)...)
+		}
+	}
+	return issues
+}
+
+// structFields maps the encoded name of each field in a struct to its type
+func structFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if name := jsonName(field); name != "" {
+			fields[name] = field.Type
+		}
+	}
+	return fields
+}
+
+// unknownKeyMessage describes an unknown key, suggesting the closest known key if there is a likely typo
+func unknownKeyMessage(key string, fields map[string]reflect.Type) string {
+	best, bestDistance := "", 3
+	for name := range fields {
+		distance := editDistance(normalizeKey(key), normalizeKey(name))
+		if distance < bestDistance || distance == bestDistance && best != "" && name < best {
+			best, bestDistance = name, distance
+		}
+	}
+	if best == "" {
+		return fmt.Sprintf("unknown key %q", key)
+	}
+	return fmt.Sprintf("unknown key %q, did you mean %q?", key, best)
+}
+
+// normalizeKey removes case and separator differences so snake_case and camelCase spellings compare as equal
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+}
+
+// editDistance computes the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = minInt(previous[j]+1, minInt(current[j-1]+1, previous[j-1]+cost))
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse_strict(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		lenient    bool
+		wantIssues Issues
+		wantErr    bool
+	}{
+		{
+			name: "misspelled override",
+			data: baselineYAML + `    overrides:
+      on_unavailble:
+        default: cancel
+`,
+			wantIssues: Issues{
+				{
+					Path:    "bots[0].overrides.on_unavailble",
+					Message: "unknown key \"on_unavailble\", did you mean \"on_unavailable\"?",
+					File:    "config.yaml",
+					Line:    18,
+				},
+			},
+		},
+		{
+			name: "unknown key is a warning when lenient",
+			data: baselineYAML + `    dest_bot_id: 3
+`,
+			lenient: true,
+			wantIssues: Issues{
+				{
+					Severity: SeverityWarning,
+					Path:     "bots[0].dest_bot_id",
+					Message:  "unknown key \"dest_bot_id\"",
+					File:     "config.yaml",
+					Line:     17,
+				},
+			},
+		},
+		{
+			name: "duplicate key",
+			data: baselineYAML + `    id: other_mapping
+`,
+			lenient: true,
+			wantIssues: Issues{
+				{
+					Path:    "bots[0].id",
+					Message: "duplicate key \"id\", first defined on line 12",
+					File:    "config.yaml",
+					Line:    17,
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, issues, err := Parse("config.yaml", []byte(tt.data), Options{Lenient: tt.lenient})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(issues, tt.wantIssues) {
+				t.Errorf("Parse() issues = %v, want %v", issues, tt.wantIssues)
+			}
+		})
+	}
+}
+
+func Test_editDistance(t *testing.T) {
+	tests := []struct {
+		a    string
+		b    string
+		want int
+	}{
+		{a: "", b: "abc", want: 3},
+		{a: "bot_id", b: "bot_id", want: 0},
+		{a: "cancelunavailabledeal", b: "cancelunavailabledeals", want: 1},
+		{a: "kitten", b: "sitting", want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			if got := editDistance(tt.a, tt.b); got != tt.want {
+				t.Errorf("editDistance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+// Package flatten closes every open destination deal commacloner started and disables the destination bots, for when
+// something has gone badly wrong
+package flatten
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jslowik/commacloner/api/rest"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/state"
+)
+
+// activeScope is the deal scope of open deals, see rest.DealScopes
+const activeScope = "active"
+
+// Options narrow what is flattened and how
+type Options struct {
+	// Mappings limits flattening to these mappings, every mapping if empty
+	Mappings []string
+	// Cancel cancels the deals, leaving the positions they hold, rather than panic selling them
+	Cancel bool
+	// AllDeals includes every open deal on the destination bots, not only those the deal link store records
+	// commacloner starting
+	AllDeals bool
+}
+
+// Bot is a destination bot to disable
+type Bot struct {
+	BotID    int      `json:"bot_id"`
+	Mappings []string `json:"mappings"`
+}
+
+// Deal is an open destination deal to close
+type Deal struct {
+	Mapping string `json:"mapping"`
+	BotID   int    `json:"bot_id"`
+	DealID  int    `json:"deal_id"`
+	Pair    string `json:"pair"`
+	// Linked is set if the deal link store records commacloner starting the deal
+	Linked bool `json:"linked"`
+}
+
+// Plan is what flattening will do
+type Plan struct {
+	Action config.UnavailableAction `json:"action"`
+	Bots   []Bot                    `json:"bots"`
+	Deals  []Deal                   `json:"deals"`
+}
+
+// BotResult is the outcome of disabling a bot, and the call made to do so
+type BotResult struct {
+	Bot
+	Disabled bool      `json:"disabled"`
+	Error    string    `json:"error,omitempty"`
+	Call     rest.Call `json:"call"`
+}
+
+// DealResult is the outcome of closing a deal, and the call made to do so
+type DealResult struct {
+	Deal
+	Closed bool      `json:"closed"`
+	Error  string    `json:"error,omitempty"`
+	Call   rest.Call `json:"call"`
+}
+
+// Report is what flattening did
+type Report struct {
+	Action   config.UnavailableAction `json:"action"`
+	Started  time.Time                `json:"started"`
+	Finished time.Time                `json:"finished"`
+	Bots     []BotResult              `json:"bots"`
+	Deals    []DealResult             `json:"deals"`
+	// ListError is why the deals could not be listed again once the bots were disabled, in which case the deals of
+	// the plan were closed
+	ListError string `json:"list_error,omitempty"`
+}
+
+// Failures counts the bots which could not be disabled and the deals which could not be closed
+func (r Report) Failures() int {
+	failures := 0
+	for _, bot := range r.Bots {
+		if !bot.Disabled {
+			failures++
+		}
+	}
+	for _, deal := range r.Deals {
+		if !deal.Closed {
+			failures++
+		}
+	}
+	return failures
+}
+
+// NewPlan finds the destination bots of the mappings and the deals open on them which commacloner started, according
+// to the links recorded by serve.  Simulated destinations have nothing to flatten.
+func NewPlan(c config.Config, links []state.Link, opts Options) (Plan, error) {
+	plan := Plan{Action: config.ActionPanicSell, Bots: []Bot{}, Deals: []Deal{}}
+	if opts.Cancel {
+		plan.Action = config.ActionCancel
+	}
+
+	selected := make(map[string]bool)
+	for _, id := range opts.Mappings {
+		selected[id] = true
+	}
+	found := make(map[string]bool)
+	bots := make(map[int]*Bot)
+	var botIDs []int
+	for _, mapping := range c.Bots {
+		if len(selected) != 0 && !selected[mapping.ID] {
+			continue
+		}
+		found[mapping.ID] = true
+		if mapping.Destination.Simulated() {
+			continue
+		}
+		bot, ok := bots[mapping.Destination.ID]
+		if !ok {
+			bot = &Bot{BotID: mapping.Destination.ID}
+			bots[mapping.Destination.ID] = bot
+			botIDs = append(botIDs, mapping.Destination.ID)
+		}
+		bot.Mappings = append(bot.Mappings, mapping.ID)
+	}
+	for _, id := range opts.Mappings {
+		if !found[id] {
+			return plan, fmt.Errorf("unknown mapping %s", id)
+		}
+	}
+	sort.Ints(botIDs)
+	for _, botID := range botIDs {
+		plan.Bots = append(plan.Bots, *bots[botID])
+	}
+
+	deals, err := listDeals(c.API, plan.Bots, links, opts.AllDeals)
+	if err != nil {
+		return plan, err
+	}
+	plan.Deals = deals
+	return plan, nil
+}
+
+// listDeals lists the deals open on the bots which commacloner started, according to the links recorded by serve, or
+// every open deal if allDeals is set
+func listDeals(apiConfig config.API, bots []Bot, links []state.Link, allDeals bool) ([]Deal, error) {
+	// the mapping which started each linked deal, limited to the destination bots being flattened
+	linked := make(map[int]string)
+	for _, link := range links {
+		for _, bot := range bots {
+			if bot.BotID == link.DestBotID && contains(bot.Mappings, link.Mapping) {
+				linked[link.DestDealID] = link.Mapping
+			}
+		}
+	}
+
+	deals := []Deal{}
+	for _, bot := range bots {
+		open, err := rest.ListDeals(apiConfig, rest.DealFilter{BotID: bot.BotID, Scope: activeScope})
+		if err != nil {
+			return deals, fmt.Errorf("could not list the open deals of bot %d: %v", bot.BotID, err)
+		}
+		for _, deal := range open {
+			mapping, isLinked := linked[deal.ID]
+			if !isLinked && !allDeals {
+				continue
+			}
+			if !isLinked {
+				mapping = bot.Mappings[0]
+			}
+			deals = append(deals, Deal{Mapping: mapping, BotID: bot.BotID, DealID: deal.ID, Pair: deal.Pair, Linked: isLinked})
+		}
+	}
+	return deals, nil
+}
+
+// Execute disables the bots, so they open no new deals, and then lists the deals open on them again and closes them,
+// so deals opened since the plan was made are closed too.  Should the deals not be listed, those in the plan are
+// closed instead.  Every bot and deal is attempted whatever happens to the others.
+func (p Plan) Execute(c config.Config, links []state.Link, opts Options) Report {
+	report := Report{Action: p.Action, Started: time.Now().UTC(), Bots: []BotResult{}, Deals: []DealResult{}}
+	for _, bot := range p.Bots {
+		result := BotResult{Bot: bot, Disabled: true}
+		call, err := rest.DisableBot(c.API, bot.BotID)
+		if err != nil {
+			result.Disabled, result.Error = false, err.Error()
+		}
+		result.Call = call
+		report.Bots = append(report.Bots, result)
+	}
+
+	deals, err := listDeals(c.API, p.Bots, links, opts.AllDeals)
+	if err != nil {
+		report.ListError = err.Error()
+		deals = p.Deals
+	}
+	for _, deal := range deals {
+		result := DealResult{Deal: deal, Closed: true}
+		call, err := rest.CancelDeal(c.API, deal.DealID, p.Action == config.ActionPanicSell)
+		if err != nil {
+			result.Closed, result.Error = false, err.Error()
+		}
+		result.Call = call
+		report.Deals = append(report.Deals, result)
+	}
+	report.Finished = time.Now().UTC()
+	return report
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
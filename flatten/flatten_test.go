@@ -0,0 +1,162 @@
+package flatten
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/api/rest"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/state"
+)
+
+// newTest3CServer mocks the 3Commas API, serving the given deals as active and recording every call made to close a
+// deal or disable a bot.  Closing failDeal fails.
+func newTest3CServer(deals []api.Deal, failDeal int) (*httptest.Server, *[]string) {
+	var mu sync.Mutex
+	var calls []string
+	record := func(status int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			calls = append(calls, r.URL.Path)
+			mu.Unlock()
+			if mux.Vars(r)["id"] == strconv.Itoa(failDeal) {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(status)
+		}
+	}
+
+	rtr := mux.NewRouter()
+	rtr.HandleFunc(rest.ListDealsRoute, func(w http.ResponseWriter, r *http.Request) {
+		page := []api.Deal{}
+		for _, deal := range deals {
+			if r.URL.Query().Get("offset") == "0" && r.URL.Query().Get("scope") == "active" &&
+				r.URL.Query().Get("bot_id") == strconv.Itoa(deal.BotID) {
+				page = append(page, deal)
+			}
+		}
+		json.NewEncoder(w).Encode(page)
+	})
+	rtr.HandleFunc("/ver1/deals/{id:[0-9]+}/cancel", record(http.StatusCreated))
+	rtr.HandleFunc("/ver1/deals/{id:[0-9]+}/panic_sell", record(http.StatusCreated))
+	rtr.HandleFunc("/ver1/bots/{bot:[0-9]+}/disable", record(http.StatusOK))
+	return httptest.NewServer(rtr), &calls
+}
+
+func TestNewPlan(t *testing.T) {
+	deals := []api.Deal{
+		{ID: 101, BotID: 2, Pair: "USDT_BTC"},
+		{ID: 102, BotID: 2, Pair: "USDT_ETH"},
+		{ID: 103, BotID: 4, Pair: "USDT_ADA"},
+	}
+	test3CServer, _ := newTest3CServer(deals, 0)
+	defer test3CServer.Close()
+
+	c := config.Config{
+		API: config.API{RestURL: test3CServer.URL},
+		Bots: []config.BotMapping{
+			{ID: "a", Source: config.BotConfig{ID: 1}, Destination: config.BotConfig{ID: 2}},
+			{ID: "b", Source: config.BotConfig{ID: 3}, Destination: config.BotConfig{ID: 4}},
+			{ID: "paper", Source: config.BotConfig{ID: 1}, Destination: config.BotConfig{Type: config.BotTypeSimulated}},
+		},
+	}
+	links := []state.Link{
+		{Mapping: "a", DestBotID: 2, DestDealID: 101},
+		{Mapping: "b", DestBotID: 4, DestDealID: 103},
+		{Mapping: "a", DestBotID: 2, DestDealID: 90},
+	}
+
+	tests := []struct {
+		name    string
+		opts    Options
+		want    Plan
+		wantErr bool
+	}{
+		{
+			name: "linked deals",
+			want: Plan{
+				Action: config.ActionPanicSell,
+				Bots:   []Bot{{BotID: 2, Mappings: []string{"a"}}, {BotID: 4, Mappings: []string{"b"}}},
+				Deals: []Deal{
+					{Mapping: "a", BotID: 2, DealID: 101, Pair: "USDT_BTC", Linked: true},
+					{Mapping: "b", BotID: 4, DealID: 103, Pair: "USDT_ADA", Linked: true},
+				},
+			},
+		},
+		{
+			name: "every deal of a mapping, cancelled",
+			opts: Options{Mappings: []string{"a"}, Cancel: true, AllDeals: true},
+			want: Plan{
+				Action: config.ActionCancel,
+				Bots:   []Bot{{BotID: 2, Mappings: []string{"a"}}},
+				Deals: []Deal{
+					{Mapping: "a", BotID: 2, DealID: 101, Pair: "USDT_BTC", Linked: true},
+					{Mapping: "a", BotID: 2, DealID: 102, Pair: "USDT_ETH"},
+				},
+			},
+		},
+		{
+			name: "simulated mapping",
+			opts: Options{Mappings: []string{"paper"}},
+			want: Plan{Action: config.ActionPanicSell, Bots: []Bot{}, Deals: []Deal{}},
+		},
+		{
+			name:    "unknown mapping",
+			opts:    Options{Mappings: []string{"a", "c"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewPlan(c, links, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewPlan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewPlan() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlan_Execute(t *testing.T) {
+	// deal 103 was opened after the plan was made and deal 100 closed
+	deals := []api.Deal{{ID: 101, BotID: 2}, {ID: 102, BotID: 2}, {ID: 103, BotID: 2}}
+	test3CServer, calls := newTest3CServer(deals, 102)
+	defer test3CServer.Close()
+
+	plan := Plan{
+		Action: config.ActionPanicSell,
+		Bots:   []Bot{{BotID: 2, Mappings: []string{"a"}}},
+		Deals:  []Deal{{Mapping: "a", BotID: 2, DealID: 100}, {Mapping: "a", BotID: 2, DealID: 101}, {Mapping: "a", BotID: 2, DealID: 102}},
+	}
+	c := config.Config{API: config.API{RestURL: test3CServer.URL}}
+	report := plan.Execute(c, nil, Options{AllDeals: true})
+
+	want := []string{"/ver1/bots/2/disable", "/ver1/deals/101/panic_sell", "/ver1/deals/102/panic_sell", "/ver1/deals/103/panic_sell"}
+	if !reflect.DeepEqual(*calls, want) {
+		t.Errorf("calls = %v, want %v", *calls, want)
+	}
+	if report.Failures() != 1 || report.Deals[1].Closed || report.Deals[1].Error == "" || report.ListError != "" {
+		t.Errorf("Execute() = %+v, want only deal 102 to fail", report)
+	}
+	if call := report.Deals[1].Call; call.Method != http.MethodPost || call.Status != http.StatusInternalServerError {
+		t.Errorf("Execute() deal 102 call = %+v, want the failed panic sell", call)
+	}
+
+	// the planned deals are closed if the deals cannot be listed again
+	*calls = nil
+	c.API.RestURL = test3CServer.URL + "/missing"
+	report = plan.Execute(c, nil, Options{AllDeals: true})
+	if report.ListError == "" || len(report.Deals) != 3 || report.Deals[0].DealID != 100 {
+		t.Errorf("Execute() = %+v, want the planned deals attempted", report)
+	}
+}
@@ -13,6 +13,8 @@ import (
 
 var (
 	globalLogger *zap.Logger
+	// level is the level of the global logger, kept so it can be changed while running
+	level = zap.NewAtomicLevel()
 )
 
 type lumberjackSink struct {
@@ -31,8 +33,9 @@ func InitWithConfiguration(config config.Logger) error {
 		return fmt.Errorf("invalid log level: %v", err)
 	}
 
+	level.SetLevel(lvl.Level())
 	cnfg := zap.NewProductionConfig()
-	cnfg.Level = lvl
+	cnfg.Level = level
 	cnfg.Encoding = config.Format
 	cnfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 	cnfg.OutputPaths = []string{"stderr"}
@@ -82,6 +85,11 @@ func createDir(path string) error {
 	return nil
 }
 
+// Level returns the level of the global logger.  Changing it changes the level of every logger.
+func Level() zap.AtomicLevel {
+	return level
+}
+
 func NewLogger(name string) *zap.SugaredLogger {
 	if globalLogger == nil {
 		c := config.Logger{
@@ -0,0 +1,182 @@
+// Package metrics exposes what a running serve is doing to Prometheus
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/monitor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "commacloner"
+
+// Modes a deal is cloned in, matching the mode field of log lines
+const (
+	ModeLive      = "live"
+	ModeDryRun    = "dry_run"
+	ModeSimulated = "simulated"
+)
+
+// skipReasons are the reasons a deal is skipped which are counted under their own label.  Any other is counted as
+// other, so a free text reason cannot create a series of its own.
+var skipReasons = map[string]bool{
+	monitor.ReasonPaused:        true,
+	monitor.ReasonNoApproval:    true,
+	monitor.ReasonAlreadyClosed: true,
+}
+
+// Metrics counts the deals of each mapping, times calls to the 3Commas API and reports the state of the deals stream.
+// A nil Metrics records nothing.
+type Metrics struct {
+	registry     *prometheus.Registry
+	received     *prometheus.CounterVec
+	cloned       *prometheus.CounterVec
+	skipped      *prometheus.CounterVec
+	failed       *prometheus.CounterVec
+	approvals    *prometheus.CounterVec
+	cancelled    *prometheus.CounterVec
+	panicSold    *prometheus.CounterVec
+	restDuration *prometheus.HistogramVec
+}
+
+// New creates the metrics of the mappings, reporting the state of the deals stream from mon
+func New(mappings []config.BotMapping, mon *monitor.Monitor) *Metrics {
+	counter := func(name, help string, labels ...string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: namespace, Name: name, Help: help}, labels)
+	}
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		received: counter("deals_received_total", "New source deals received by each mapping.", "mapping"),
+		cloned: counter("deals_cloned_total",
+			"Source deals cloned by each mapping, by mode: live, dry_run or simulated.", "mapping", "mode"),
+		skipped: counter("deals_skipped_total", "Source deals not cloned by each mapping, by reason.", "mapping", "reason"),
+		failed: counter("deals_failed_total",
+			"Source deals which could not be cloned by each mapping, by error class.", "mapping", "error_class"),
+		approvals: counter("approvals_total",
+			"Source deals of each mapping queued for approval, rejected or expired.", "mapping", "outcome"),
+		cancelled: counter("deals_cancelled_total", "Source deals cancelled by the on_unavailable policy of each mapping.", "mapping"),
+		panicSold: counter("deals_panic_sold_total", "Source deals panic sold by the on_unavailable policy of each mapping.", "mapping"),
+		restDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "rest_request_duration_seconds",
+			Help:      "How long calls to the 3Commas API took, by endpoint and status code, 0 if there was no response.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "endpoint", "status"}),
+	}
+	m.registry.MustRegister(m.received, m.cloned, m.skipped, m.failed, m.approvals, m.cancelled, m.panicSold, m.restDuration)
+	m.registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	if mon != nil {
+		m.registerStream(mon)
+	}
+
+	// every mapping is listed from the start, rather than once it first sees a deal
+	for _, mapping := range mappings {
+		m.received.WithLabelValues(mapping.ID)
+		m.cancelled.WithLabelValues(mapping.ID)
+		m.panicSold.WithLabelValues(mapping.ID)
+	}
+	return m
+}
+
+// registerStream registers the gauges reporting the state of the deals stream
+func (m *Metrics) registerStream(mon *monitor.Monitor) {
+	for _, state := range []monitor.ConnectionState{monitor.StateConnecting, monitor.StateConnected, monitor.StateSubscribed, monitor.StateDisconnected} {
+		state := state
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "websocket_state",
+			Help:        "1 for the state the connection to the deals stream is in, 0 for the others.",
+			ConstLabels: prometheus.Labels{"state": string(state)},
+		}, func() float64 {
+			if mon.Health().State == state {
+				return 1
+			}
+			return 0
+		}))
+	}
+	m.registry.MustRegister(prometheus.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_reconnects_total",
+		Help:      "Times the connection to the deals stream has been re-established.",
+	}, func() float64 {
+		return float64(mon.Health().Reconnects)
+	}))
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_last_ping_seconds",
+		Help:      "Seconds since the deals stream last sent a ping, or since serve started if it has not.",
+	}, func() float64 {
+		health := mon.Health()
+		if health.LastPing == nil {
+			return time.Since(health.Started).Seconds()
+		}
+		return time.Since(*health.LastPing).Seconds()
+	}))
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Received counts a new source deal of a mapping
+func (m *Metrics) Received(mapping string) {
+	if m == nil {
+		return
+	}
+	m.received.WithLabelValues(mapping).Inc()
+}
+
+// Decide counts what was done with a source deal
+func (m *Metrics) Decide(decision monitor.Decision) {
+	if m == nil {
+		return
+	}
+	switch decision.Outcome {
+	case monitor.OutcomeCloned:
+		m.cloned.WithLabelValues(decision.Mapping, ModeLive).Inc()
+	case monitor.OutcomeDryRun:
+		m.cloned.WithLabelValues(decision.Mapping, ModeDryRun).Inc()
+	case monitor.OutcomeSimulated:
+		m.cloned.WithLabelValues(decision.Mapping, ModeSimulated).Inc()
+	case monitor.OutcomeSkipped:
+		reason := decision.Reason
+		if !skipReasons[reason] {
+			reason = string(config.ReasonOther)
+		}
+		m.skipped.WithLabelValues(decision.Mapping, reason).Inc()
+	case monitor.OutcomeFailed:
+		class := decision.Reason
+		if class == "" {
+			class = string(config.ReasonOther)
+		}
+		m.failed.WithLabelValues(decision.Mapping, class).Inc()
+	case monitor.OutcomeQueued, monitor.OutcomeRejected, monitor.OutcomeExpired:
+		m.approvals.WithLabelValues(decision.Mapping, string(decision.Outcome)).Inc()
+	}
+}
+
+// Closed counts a source deal of a mapping closed by its on_unavailable policy
+func (m *Metrics) Closed(mapping string, panicSell bool) {
+	if m == nil {
+		return
+	}
+	if panicSell {
+		m.panicSold.WithLabelValues(mapping).Inc()
+	} else {
+		m.cancelled.WithLabelValues(mapping).Inc()
+	}
+}
+
+// ObserveRequest records how long a call to the 3Commas API took, as a rest.Observer
+func (m *Metrics) ObserveRequest(method, endpoint string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.restDuration.WithLabelValues(method, endpoint, strconv.Itoa(status)).Observe(duration.Seconds())
+}
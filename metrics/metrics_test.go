@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/monitor"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	mappings := []config.BotMapping{{ID: "live", Source: config.BotConfig{ID: 1}, Destination: config.BotConfig{ID: 2}}}
+	mon := monitor.New(mappings, 0)
+	m := New(mappings, mon)
+
+	m.Received("live")
+	m.Decide(monitor.Decision{Mapping: "live", Outcome: monitor.OutcomeCloned})
+	m.Decide(monitor.Decision{Mapping: "live", Outcome: monitor.OutcomeDryRun})
+	m.Decide(monitor.Decision{Mapping: "live", Outcome: monitor.OutcomeSkipped, Reason: monitor.ReasonPaused})
+	m.Decide(monitor.Decision{Mapping: "live", Outcome: monitor.OutcomeSkipped, Reason: "approval 7, already completed"})
+	m.Decide(monitor.Decision{Mapping: "live", Outcome: monitor.OutcomeFailed, Reason: string(config.ReasonFunds)})
+	m.Decide(monitor.Decision{Mapping: "live", Outcome: monitor.OutcomeFailed})
+	m.Decide(monitor.Decision{Mapping: "live", Outcome: monitor.OutcomeQueued})
+	m.Closed("live", true)
+	m.ObserveRequest("POST", "/ver1/bots/{id}/start_new_deal", 201, 250*time.Millisecond)
+	mon.SetState(monitor.StateSubscribed)
+
+	counts := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"received", testutil.ToFloat64(m.received.WithLabelValues("live")), 1},
+		{"cloned live", testutil.ToFloat64(m.cloned.WithLabelValues("live", ModeLive)), 1},
+		{"cloned dry run", testutil.ToFloat64(m.cloned.WithLabelValues("live", ModeDryRun)), 1},
+		{"skipped paused", testutil.ToFloat64(m.skipped.WithLabelValues("live", monitor.ReasonPaused)), 1},
+		{"skipped other", testutil.ToFloat64(m.skipped.WithLabelValues("live", string(config.ReasonOther))), 1},
+		{"failed funds", testutil.ToFloat64(m.failed.WithLabelValues("live", string(config.ReasonFunds))), 1},
+		{"failed other", testutil.ToFloat64(m.failed.WithLabelValues("live", string(config.ReasonOther))), 1},
+		{"queued", testutil.ToFloat64(m.approvals.WithLabelValues("live", string(monitor.OutcomeQueued))), 1},
+		{"cancelled", testutil.ToFloat64(m.cancelled.WithLabelValues("live")), 0},
+		{"panic sold", testutil.ToFloat64(m.panicSold.WithLabelValues("live")), 1},
+	}
+	for _, count := range counts {
+		if count.got != count.want {
+			t.Errorf("%s = %v, want %v", count.name, count.got, count.want)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(recorder.Body)
+	for _, want := range []string{
+		`commacloner_websocket_state{state="subscribed"} 1`,
+		`commacloner_websocket_state{state="connecting"} 0`,
+		`commacloner_websocket_reconnects_total 0`,
+		`commacloner_rest_request_duration_seconds_count{endpoint="/ver1/bots/{id}/start_new_deal",method="POST",status="201"} 1`,
+		`commacloner_websocket_last_ping_seconds`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics do not contain %s", want)
+		}
+	}
+}
+
+func TestMetrics_nil(t *testing.T) {
+	var m *Metrics
+	m.Received("live")
+	m.Decide(monitor.Decision{Mapping: "live", Outcome: monitor.OutcomeCloned})
+	m.Closed("live", false)
+	m.ObserveRequest("GET", "/ver1/bots", 200, time.Second)
+}
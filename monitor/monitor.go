@@ -0,0 +1,307 @@
+// Package monitor keeps track of how a running serve is doing: the state of its websocket connection, how many deals
+// each mapping has seen and what was decided for them
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jslowik/commacloner/config"
+)
+
+// ConnectionState is the state of the connection to the deals stream
+type ConnectionState string
+
+// Connection states
+const (
+	StateConnecting   ConnectionState = "connecting"
+	StateConnected    ConnectionState = "connected"
+	StateSubscribed   ConnectionState = "subscribed"
+	StateDisconnected ConnectionState = "disconnected"
+)
+
+// Outcome is what was decided for a source deal
+type Outcome string
+
+// Outcomes of a decision
+const (
+	OutcomeCloned    Outcome = "cloned"
+	OutcomeSkipped   Outcome = "skipped"
+	OutcomeFailed    Outcome = "failed"
+	OutcomeQueued    Outcome = "queued"
+	OutcomeRejected  Outcome = "rejected"
+	OutcomeExpired   Outcome = "expired"
+	OutcomeDryRun    Outcome = "dry_run"
+	OutcomeSimulated Outcome = "simulated"
+	// OutcomeClosed is a source deal closed once the delay of close_at_market_after_delay passed, or found to be
+	// closed already
+	OutcomeClosed Outcome = "closed"
+	// OutcomeFlattened is a destination bot disabled or deal closed by flatten.  It is only recorded in the audit log.
+	OutcomeFlattened Outcome = "flattened"
+)
+
+// Reasons a deal is skipped.  They are used as metric labels, so a skip is given one of these and any detail, such as
+// the approval it was queued as, goes in the error of its decision.
+const (
+	ReasonPaused     = "paused"
+	ReasonNoApproval = "no_approval_queue"
+	// ReasonAlreadyClosed is an approved deal which closed while it waited
+	ReasonAlreadyClosed = "already_closed"
+)
+
+// DefaultDecisions is how many recent decisions are kept
+const DefaultDecisions = 100
+
+// Decision is what was done with a source deal for a mapping
+type Decision struct {
+	Time         time.Time `json:"time"`
+	Mapping      string    `json:"mapping"`
+	SourceBotID  int       `json:"source_bot_id"`
+	SourceDealID int       `json:"source_deal_id"`
+	DestBotID    int       `json:"dest_bot_id,omitempty"`
+	DestDealID   int       `json:"dest_deal_id,omitempty"`
+	Pair         string    `json:"pair,omitempty"`
+	Outcome      Outcome   `json:"outcome"`
+	// Reason is why the deal was skipped or could not be started, or the approval id it is queued as
+	Reason string `json:"reason,omitempty"`
+	// Action is the on_unavailable action applied to the source deal, if any
+	Action config.UnavailableAction `json:"action,omitempty"`
+	Error  string                   `json:"error,omitempty"`
+}
+
+// Counters count the source deals of a mapping by what was decided for them, and the source deals closed by its
+// on_unavailable policy
+type Counters struct {
+	Received  int `json:"received"`
+	Cloned    int `json:"cloned"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+	Queued    int `json:"queued"`
+	Rejected  int `json:"rejected"`
+	Expired   int `json:"expired"`
+	DryRun    int `json:"dry_run"`
+	Simulated int `json:"simulated"`
+	Cancelled int `json:"cancelled"`
+	PanicSold int `json:"panic_sold"`
+}
+
+// count adds a decision to the counters
+func (c *Counters) count(outcome Outcome) {
+	switch outcome {
+	case OutcomeCloned:
+		c.Cloned++
+	case OutcomeSkipped:
+		c.Skipped++
+	case OutcomeFailed:
+		c.Failed++
+	case OutcomeQueued:
+		c.Queued++
+	case OutcomeRejected:
+		c.Rejected++
+	case OutcomeExpired:
+		c.Expired++
+	case OutcomeDryRun:
+		c.DryRun++
+	case OutcomeSimulated:
+		c.Simulated++
+	}
+}
+
+// Mapping is a configured mapping and its counters
+type Mapping struct {
+	ID              string   `json:"id"`
+	SourceBotID     int      `json:"source_bot_id"`
+	DestBotID       int      `json:"dest_bot_id,omitempty"`
+	Simulated       bool     `json:"simulated,omitempty"`
+	DryRun          bool     `json:"dry_run,omitempty"`
+	RequireApproval bool     `json:"require_approval,omitempty"`
+	Counters        Counters `json:"counters"`
+}
+
+// Health is the state of the connection to the deals stream
+type Health struct {
+	State ConnectionState `json:"state"`
+	// Since is when the connection entered its state
+	Since       time.Time  `json:"since"`
+	Started     time.Time  `json:"started"`
+	LastMessage *time.Time `json:"last_message,omitempty"`
+	// LastMessageAge is how many seconds ago the last message was received
+	LastMessageAge *float64   `json:"last_message_age,omitempty"`
+	LastPing       *time.Time `json:"last_ping,omitempty"`
+	Reconnects     int        `json:"reconnects"`
+}
+
+// Monitor records the connection state and decisions of a running serve.  A nil Monitor records nothing, and it is safe
+// for concurrent use.
+type Monitor struct {
+	mu          sync.Mutex
+	now         func() time.Time
+	started     time.Time
+	state       ConnectionState
+	since       time.Time
+	lastMessage time.Time
+	lastPing    time.Time
+	reconnects  int
+	mappings    []Mapping
+	index       map[string]int
+	decisions   []Decision
+	keep        int
+}
+
+// New creates a monitor for the mappings, keeping the given number of recent decisions
+func New(mappings []config.BotMapping, keep int) *Monitor {
+	return newMonitor(mappings, keep, time.Now)
+}
+
+func newMonitor(mappings []config.BotMapping, keep int, now func() time.Time) *Monitor {
+	m := &Monitor{now: now, keep: keep, index: make(map[string]int)}
+	m.started = now().UTC()
+	m.state, m.since = StateConnecting, m.started
+	for _, mapping := range mappings {
+		m.index[mapping.ID] = len(m.mappings)
+		m.mappings = append(m.mappings, Mapping{
+			ID:              mapping.ID,
+			SourceBotID:     mapping.Source.ID,
+			DestBotID:       mapping.Destination.ID,
+			Simulated:       mapping.Destination.Simulated(),
+			DryRun:          mapping.DryRun,
+			RequireApproval: mapping.RequireApproval,
+		})
+	}
+	return m
+}
+
+// SetState records a change of the connection state.  Moving from disconnected to connecting counts as a reconnect.
+func (m *Monitor) SetState(state ConnectionState) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if state == m.state {
+		return
+	}
+	if state == StateConnecting && m.state == StateDisconnected {
+		m.reconnects++
+	}
+	m.state, m.since = state, m.now().UTC()
+}
+
+// Message records a message received from the deals stream
+func (m *Monitor) Message(ping bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastMessage = m.now().UTC()
+	if ping {
+		m.lastPing = m.lastMessage
+	}
+}
+
+// Received counts a new source deal of a mapping
+func (m *Monitor) Received(mapping string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if i, ok := m.index[mapping]; ok {
+		m.mappings[i].Counters.Received++
+	}
+}
+
+// Decide records what was done with a source deal, stamping it with the time if it has none
+func (m *Monitor) Decide(decision Decision) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if decision.Time.IsZero() {
+		decision.Time = m.now().UTC()
+	}
+	if i, ok := m.index[decision.Mapping]; ok {
+		m.mappings[i].Counters.count(decision.Outcome)
+	}
+	if m.keep <= 0 {
+		return
+	}
+	if len(m.decisions) == m.keep {
+		m.decisions = append(m.decisions[:0], m.decisions[1:]...)
+	}
+	m.decisions = append(m.decisions, decision)
+}
+
+// Closed counts a source deal of a mapping closed by its on_unavailable policy
+func (m *Monitor) Closed(mapping string, panicSell bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i, ok := m.index[mapping]
+	if !ok {
+		return
+	}
+	if panicSell {
+		m.mappings[i].Counters.PanicSold++
+	} else {
+		m.mappings[i].Counters.Cancelled++
+	}
+}
+
+// Health returns the state of the connection
+func (m *Monitor) Health() Health {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	health := Health{State: m.state, Since: m.since, Started: m.started, Reconnects: m.reconnects}
+	if !m.lastMessage.IsZero() {
+		lastMessage := m.lastMessage
+		age := m.now().Sub(lastMessage).Seconds()
+		health.LastMessage, health.LastMessageAge = &lastMessage, &age
+	}
+	if !m.lastPing.IsZero() {
+		lastPing := m.lastPing
+		health.LastPing = &lastPing
+	}
+	return health
+}
+
+// Ready reports whether deals are being received: the subscription is confirmed and a message, such as a ping, has
+// arrived within maxAge.  If not, the reason is returned.
+func (m *Monitor) Ready(maxAge time.Duration) (bool, string) {
+	health := m.Health()
+	if health.State != StateSubscribed {
+		return false, "deals stream is " + string(health.State)
+	}
+	if health.LastMessageAge == nil || *health.LastMessageAge > maxAge.Seconds() {
+		return false, "no message received from the deals stream in " + maxAge.String()
+	}
+	return true, ""
+}
+
+// Mappings returns the mappings and their counters, in the order they are configured
+func (m *Monitor) Mappings() []Mapping {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Mapping{}, m.mappings...)
+}
+
+// Decisions returns up to limit of the most recent decisions, of the mapping if one is given, newest first.  A limit
+// of 0 returns every decision kept.
+func (m *Monitor) Decisions(mapping string, limit int) []Decision {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	decisions := []Decision{}
+	for i := len(m.decisions) - 1; i >= 0; i-- {
+		if limit > 0 && len(decisions) == limit {
+			break
+		}
+		if mapping == "" || m.decisions[i].Mapping == mapping {
+			decisions = append(decisions, m.decisions[i])
+		}
+	}
+	return decisions
+}
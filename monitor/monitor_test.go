@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jslowik/commacloner/config"
+)
+
+func TestMonitor(t *testing.T) {
+	now := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	m := newMonitor([]config.BotMapping{
+		{ID: "live", Source: config.BotConfig{ID: 1}, Destination: config.BotConfig{ID: 2}},
+		{ID: "paper", Source: config.BotConfig{ID: 1}, Destination: config.BotConfig{Type: config.BotTypeSimulated}},
+	}, 2, func() time.Time { return now })
+
+	if ready, _ := m.Ready(time.Minute); ready {
+		t.Error("Ready() before connecting = true, want false")
+	}
+	m.SetState(StateConnected)
+	m.SetState(StateSubscribed)
+	now = now.Add(time.Second)
+	m.Message(true)
+	if ready, reason := m.Ready(time.Minute); !ready {
+		t.Errorf("Ready() once subscribed = false (%s), want true", reason)
+	}
+	now = now.Add(2 * time.Minute)
+	if ready, _ := m.Ready(time.Minute); ready {
+		t.Error("Ready() with a stale message = true, want false")
+	}
+	m.SetState(StateDisconnected)
+	m.SetState(StateConnecting)
+	if health := m.Health(); health.State != StateConnecting || health.Reconnects != 1 || *health.LastMessageAge != 120 {
+		t.Errorf("Health() = %+v, want connecting with 1 reconnect and a last message 120s old", health)
+	}
+
+	m.Received("live")
+	m.Received("live")
+	m.Received("paper")
+	m.Received("unknown")
+	m.Decide(Decision{Mapping: "live", SourceDealID: 10, Outcome: OutcomeCloned})
+	m.Decide(Decision{Mapping: "live", SourceDealID: 11, Outcome: OutcomeFailed, Reason: "no_funds", Action: config.ActionPanicSell})
+	m.Closed("live", true)
+	m.Decide(Decision{Mapping: "paper", SourceDealID: 10, Outcome: OutcomeSimulated})
+
+	wantCounters := []Counters{{Received: 2, Cloned: 1, Failed: 1, PanicSold: 1}, {Received: 1, Simulated: 1}}
+	for i, mapping := range m.Mappings() {
+		if mapping.Counters != wantCounters[i] {
+			t.Errorf("Mappings()[%d].Counters = %+v, want %+v", i, mapping.Counters, wantCounters[i])
+		}
+	}
+
+	var got []int
+	for _, decision := range m.Decisions("", 0) {
+		got = append(got, decision.SourceDealID)
+		if !decision.Time.Equal(now) {
+			t.Errorf("Decision time = %v, want %v", decision.Time, now)
+		}
+	}
+	if want := []int{10, 11}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Decisions() = %v, want the last two kept, newest first %v", got, want)
+	}
+	if got := m.Decisions("live", 0); len(got) != 1 || got[0].SourceDealID != 11 {
+		t.Errorf("Decisions(live) = %+v, want deal 11", got)
+	}
+}
+
+func TestMonitor_nil(t *testing.T) {
+	var m *Monitor
+	m.SetState(StateConnected)
+	m.Message(false)
+	m.Received("live")
+	m.Decide(Decision{Mapping: "live", Outcome: OutcomeCloned})
+	m.Closed("live", false)
+}
@@ -0,0 +1,243 @@
+// Package pause stops mappings starting new deals while commacloner keeps running.  Mappings are paused one at a time
+// or all at once, either through the admin server, which keeps the pause across restarts, or with a sentinel file in
+// the state directory.
+package pause
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jslowik/commacloner/log"
+	"github.com/jslowik/commacloner/state"
+)
+
+// SentinelFile is the name of the sentinel file within the state directory.  While it exists, the mappings it lists,
+// one id per line, are paused; an empty file pauses every mapping.  Lines starting with # are ignored.
+const SentinelFile = "PAUSE"
+
+var (
+	// ErrUnknownMapping is returned when pausing or resuming a mapping which is not configured
+	ErrUnknownMapping = errors.New("no such mapping")
+	// ErrPaused is returned when acting on a paused mapping
+	ErrPaused = errors.New("mapping is paused")
+)
+
+// Status is what is paused, and why
+type Status struct {
+	// All is set when every mapping was paused through the switch
+	All bool `json:"all"`
+	// Mappings are the mappings paused one at a time through the switch
+	Mappings []string `json:"mappings"`
+	// Sentinel is set while the sentinel file exists
+	Sentinel bool `json:"sentinel"`
+	// SentinelAll is set when the sentinel file pauses every mapping, and SentinelMappings lists those it pauses
+	// otherwise
+	SentinelAll      bool     `json:"sentinel_all"`
+	SentinelMappings []string `json:"sentinel_mappings"`
+}
+
+// Switch pauses and resumes mappings.  Changes are saved to a store if one is given, otherwise they are only kept in
+// memory.
+type Switch struct {
+	mu       sync.Mutex
+	store    *state.Pauses
+	sentinel string
+	known    map[string]bool
+	all      bool
+	paused   map[string]bool
+	now      func() time.Time
+}
+
+// New creates a switch for the given mappings, picking up the pauses saved in the store by a previous run.  The
+// sentinel file is looked for in dir.  store may be nil, and dir empty if there is no sentinel file.
+func New(store *state.Pauses, dir string, mappings []string) (*Switch, error) {
+	s := &Switch{store: store, known: make(map[string]bool), paused: make(map[string]bool), now: time.Now}
+	if dir != "" {
+		s.sentinel = filepath.Join(dir, SentinelFile)
+	}
+	for _, mapping := range mappings {
+		s.known[mapping] = true
+	}
+	if store == nil {
+		return s, nil
+	}
+
+	changes, err := store.All()
+	if err != nil {
+		return nil, fmt.Errorf("could not read pauses: %v", err)
+	}
+	for _, change := range changes {
+		s.apply(change)
+	}
+	return s, nil
+}
+
+// Paused reports whether a mapping is paused, and if so why
+func (s *Switch) Paused(mapping string) (bool, string) {
+	s.mu.Lock()
+	all, paused := s.all, s.paused[mapping]
+	s.mu.Unlock()
+
+	switch {
+	case all:
+		return true, "all mappings are paused"
+	case paused:
+		return true, "the mapping is paused"
+	}
+	sentinelAll, sentinelMappings, exists, err := s.readSentinel()
+	switch {
+	case err != nil:
+		return true, fmt.Sprintf("the sentinel file could not be read: %v", err)
+	case !exists:
+		return false, ""
+	case sentinelAll:
+		return true, "all mappings are paused by " + s.sentinel
+	}
+	for _, m := range sentinelMappings {
+		if m == mapping {
+			return true, "the mapping is paused by " + s.sentinel
+		}
+	}
+	return false, ""
+}
+
+// Pause pauses a mapping, or every mapping if mapping is empty
+func (s *Switch) Pause(mapping string) error {
+	return s.change(state.PauseChange{Mapping: mapping, Paused: true})
+}
+
+// Resume resumes a mapping paused through the switch, or lifts the pause of every mapping, including those paused one
+// by one, if mapping is empty.  Mappings paused by the sentinel file stay paused until it is removed.
+func (s *Switch) Resume(mapping string) error {
+	return s.change(state.PauseChange{Mapping: mapping, Paused: false})
+}
+
+// Status returns what is paused
+func (s *Switch) Status() Status {
+	s.mu.Lock()
+	status := Status{All: s.all, Mappings: []string{}}
+	for mapping := range s.paused {
+		status.Mappings = append(status.Mappings, mapping)
+	}
+	s.mu.Unlock()
+	sort.Strings(status.Mappings)
+
+	var err error
+	status.SentinelAll, status.SentinelMappings, status.Sentinel, err = s.readSentinel()
+	if err != nil {
+		// a sentinel file which cannot be read pauses everything, see Paused
+		status.Sentinel, status.SentinelAll = true, true
+	}
+	if status.SentinelMappings == nil {
+		status.SentinelMappings = []string{}
+	}
+	return status
+}
+
+func (s *Switch) change(change state.PauseChange) error {
+	if change.Mapping != "" && !s.known[change.Mapping] {
+		return ErrUnknownMapping
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	change.Changed = s.now().UTC()
+	if s.store != nil {
+		if err := s.store.Add(change); err != nil {
+			return err
+		}
+	}
+	s.apply(change)
+
+	name := "all mappings"
+	if change.Mapping != "" {
+		name = "mapping " + change.Mapping
+	}
+	if change.Paused {
+		log.NewLogger("pause").Warnf("paused %s", name)
+	} else {
+		log.NewLogger("pause").Infof("resumed %s", name)
+	}
+	return nil
+}
+
+// apply makes a change.  The lock must be held, or the switch not yet shared.
+func (s *Switch) apply(change state.PauseChange) {
+	switch {
+	case change.Mapping == "" && change.Paused:
+		s.all = true
+	case change.Mapping == "":
+		s.all = false
+		s.paused = make(map[string]bool)
+	case change.Paused:
+		s.paused[change.Mapping] = true
+	default:
+		delete(s.paused, change.Mapping)
+	}
+}
+
+// WriteSentinel pauses the mappings, or every mapping if none are given, with the sentinel file in dir, returning the
+// path of the file.  Whatever the file already pauses stays paused.
+func WriteSentinel(dir string, mappings []string) (string, error) {
+	path := filepath.Join(dir, SentinelFile)
+	all, paused, exists, err := readSentinel(path)
+	if err != nil {
+		return path, fmt.Errorf("could not read %s: %v", path, err)
+	}
+	if exists && all {
+		return path, nil
+	}
+
+	var content string
+	if len(mappings) != 0 {
+		content = strings.Join(append(paused, mappings...), "\n") + "\n"
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return path, fmt.Errorf("could not create state directory %s: %v", dir, err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		return path, fmt.Errorf("could not write %s: %v", path, err)
+	}
+	return path, nil
+}
+
+// readSentinel reads the sentinel file, reporting whether it exists and whether it pauses every mapping or only those
+// listed
+func (s *Switch) readSentinel() (all bool, mappings []string, exists bool, err error) {
+	if s.sentinel == "" {
+		return false, nil, false, nil
+	}
+	return readSentinel(s.sentinel)
+}
+
+// readSentinel reads the sentinel file at path, see (*Switch).readSentinel
+func readSentinel(path string) (all bool, mappings []string, exists bool, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil, false, nil
+		}
+		return false, nil, true, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			mappings = append(mappings, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, nil, true, err
+	}
+	return len(mappings) == 0, mappings, true, nil
+}
@@ -0,0 +1,128 @@
+package pause
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jslowik/commacloner/state"
+)
+
+func TestSwitch(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	store, err := state.OpenPauses(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mappings := []string{"a", "b"}
+	s, err := New(store, dir, mappings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertPaused := func(t *testing.T, s *Switch, want map[string]bool) {
+		t.Helper()
+		for _, mapping := range mappings {
+			if paused, reason := s.Paused(mapping); paused != want[mapping] {
+				t.Errorf("Paused(%s) = %v (%s), want %v", mapping, paused, reason, want[mapping])
+			}
+		}
+	}
+
+	assertPaused(t, s, nil)
+	if err := s.Pause("c"); err != ErrUnknownMapping {
+		t.Errorf("Pause() of an unknown mapping error = %v, want %v", err, ErrUnknownMapping)
+	}
+	if err := s.Pause("a"); err != nil {
+		t.Fatal(err)
+	}
+	assertPaused(t, s, map[string]bool{"a": true})
+	if err := s.Pause(""); err != nil {
+		t.Fatal(err)
+	}
+	assertPaused(t, s, map[string]bool{"a": true, "b": true})
+
+	// Pauses survive a restart
+	s, err = New(store, dir, mappings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Status{All: true, Mappings: []string{"a"}, SentinelMappings: []string{}}); !reflect.DeepEqual(s.Status(), want) {
+		t.Errorf("Status() = %+v, want %+v", s.Status(), want)
+	}
+	if err := s.Resume("a"); err != nil {
+		t.Fatal(err)
+	}
+	assertPaused(t, s, map[string]bool{"a": true, "b": true})
+
+	// Resuming every mapping lifts the pauses of single mappings too, including after a restart
+	if err := s.Pause("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Resume(""); err != nil {
+		t.Fatal(err)
+	}
+	assertPaused(t, s, nil)
+	s, err = New(store, dir, mappings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertPaused(t, s, nil)
+	if want := (Status{Mappings: []string{}, SentinelMappings: []string{}}); !reflect.DeepEqual(s.Status(), want) {
+		t.Errorf("Status() = %+v, want %+v", s.Status(), want)
+	}
+
+	// The sentinel file pauses the mappings it lists, or every mapping if it is empty
+	sentinel := filepath.Join(dir, SentinelFile)
+	if err := ioutil.WriteFile(sentinel, []byte("# paused while the exchange is down\nb\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assertPaused(t, s, map[string]bool{"b": true})
+	if want := (Status{Mappings: []string{}, Sentinel: true, SentinelMappings: []string{"b"}}); !reflect.DeepEqual(s.Status(), want) {
+		t.Errorf("Status() = %+v, want %+v", s.Status(), want)
+	}
+	if err := ioutil.WriteFile(sentinel, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	assertPaused(t, s, map[string]bool{"a": true, "b": true})
+	if err := os.Remove(sentinel); err != nil {
+		t.Fatal(err)
+	}
+	assertPaused(t, s, nil)
+}
+
+func TestWriteSentinel(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	mappings := []string{"a", "b", "c"}
+	s, err := New(nil, dir, mappings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := WriteSentinel(dir, []string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	path, err := WriteSentinel(dir, []string{"b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != filepath.Join(dir, SentinelFile) {
+		t.Errorf("WriteSentinel() = %s, want the sentinel file in %s", path, dir)
+	}
+	if status := s.Status(); !status.Sentinel || !reflect.DeepEqual(status.SentinelMappings, []string{"a", "b"}) {
+		t.Errorf("Status() = %+v, want a and b paused by the sentinel file", status)
+	}
+
+	// pausing every mapping empties the file, and it then stays that way
+	if _, err := WriteSentinel(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WriteSentinel(dir, []string{"c"}); err != nil {
+		t.Fatal(err)
+	}
+	if status := s.Status(); !status.SentinelAll {
+		t.Errorf("Status() = %+v, want every mapping paused by the sentinel file", status)
+	}
+}
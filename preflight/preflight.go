@@ -0,0 +1,141 @@
+// Package preflight checks a configuration against the 3Commas account its API key belongs to
+package preflight
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/api/rest"
+	"github.com/jslowik/commacloner/config"
+)
+
+// Run checks that the API key is accepted and may start deals, that every bot the mappings use exists, and that each
+// destination bot can take the deals its source bot opens.  Problems which would stop deals being cloned are errors;
+// those which only might are warnings.  Simulated destinations are not checked, and write access is not checked when
+// no mapping sends requests, as testing it sends a cancel request.  The config is expected to have been validated
+// already.
+func Run(c config.Config) config.Issues {
+	bots, err := rest.ListBots(c.API)
+	if err != nil {
+		return config.Issues{{
+			Path:    "api",
+			Message: fmt.Sprintf("could not list bots, check the key and secret and that the key has the bots read permission: %v", err),
+		}}
+	}
+
+	var issues config.Issues
+	if sendsRequests(c) {
+		issues = append(issues, checkWriteAccess(c.API)...)
+	}
+
+	byID := make(map[int]api.Bot, len(bots))
+	for _, bot := range bots {
+		byID[bot.ID] = bot
+	}
+	for i, mapping := range c.Bots {
+		issues = append(issues, checkMapping(fmt.Sprintf("bots[%d]", i), mapping, byID)...)
+	}
+	return issues
+}
+
+// checkWriteAccess checks the API key may start and cancel deals
+func checkWriteAccess(apiConfig config.API) config.Issues {
+	write, err := rest.WriteAccess(apiConfig)
+	if err != nil {
+		return config.Issues{{Severity: config.SeverityWarning, Path: "api", Message: err.Error()}}
+	}
+	if !write {
+		return config.Issues{{
+			Path:    "api",
+			Message: "the key does not have the bots write permission, so deals cannot be started or cancelled",
+		}}
+	}
+	return nil
+}
+
+// sendsRequests reports whether any mapping starts or cancels deals, rather than being a dry run or simulated
+func sendsRequests(c config.Config) bool {
+	if c.DryRun {
+		return false
+	}
+	for _, mapping := range c.Bots {
+		if !mapping.DryRun && !mapping.Destination.Simulated() {
+			return true
+		}
+	}
+	return false
+}
+
+// checkMapping checks the bots of a single mapping, found at path in the config
+func checkMapping(path string, mapping config.BotMapping, bots map[int]api.Bot) config.Issues {
+	var issues config.Issues
+
+	source, sourceFound := bots[mapping.Source.ID]
+	if !sourceFound {
+		issues = append(issues, config.Issue{
+			Path:    path + ".source.bot_id",
+			Message: fmt.Sprintf("bot %d was not found on the account", mapping.Source.ID),
+		})
+	}
+	if mapping.Destination.Simulated() {
+		return issues
+	}
+	dest, destFound := bots[mapping.Destination.ID]
+	if !destFound {
+		issues = append(issues, config.Issue{
+			Path:    path + ".dest.bot_id",
+			Message: fmt.Sprintf("bot %d was not found on the account", mapping.Destination.ID),
+		})
+		return issues
+	}
+
+	if !dest.ManualStart() {
+		issues = append(issues, config.Issue{
+			Severity: config.SeverityWarning,
+			Path:     path + ".dest.bot_id",
+			Message:  fmt.Sprintf("bot %d (%s) does not start deals \"Manually/API\", so it will also open deals of its own", dest.ID, dest.Name),
+		})
+	}
+	if !dest.IsEnabled {
+		issues = append(issues, config.Issue{
+			Severity: config.SeverityWarning,
+			Path:     path + ".dest.bot_id",
+			Message:  fmt.Sprintf("bot %d (%s) is disabled, so 3Commas will refuse the deals sent to it", dest.ID, dest.Name),
+		})
+	}
+
+	if sourceFound {
+		if missing := missingPairs(source.Pairs, dest.Pairs, mapping.Overrides); len(missing) != 0 {
+			issues = append(issues, config.Issue{
+				Severity: config.SeverityWarning,
+				Path:     path + ".dest.bot_id",
+				Message:  fmt.Sprintf("bot %d (%s) does not trade %s", dest.ID, dest.Name, strings.Join(missing, ", ")),
+			})
+		}
+	}
+	return issues
+}
+
+// missingPairs lists the source pairs which, once the overrides are applied, the destination bot does not trade.  A
+// pair changed by the overrides is shown as both the source pair and the pair sent.
+func missingPairs(source, dest []string, overrides config.BotOverrides) []string {
+	traded := make(map[string]bool, len(dest))
+	for _, pair := range dest {
+		traded[pair] = true
+	}
+
+	var missing []string
+	for _, pair := range source {
+		sent := overrides.Pair(pair)
+		if traded[sent] {
+			continue
+		}
+		if sent != pair {
+			missing = append(missing, fmt.Sprintf("%s (sent as %s)", pair, sent))
+		} else {
+			missing = append(missing, pair)
+		}
+	}
+	return missing
+}
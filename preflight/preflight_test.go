@@ -0,0 +1,193 @@
+package preflight
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/api/rest"
+	"github.com/jslowik/commacloner/config"
+)
+
+// newTest3CServer mocks the 3Commas API, listing the given bots.  listStatus and cancelStatus are the statuses of the
+// bot list and of cancelling a deal.
+func newTest3CServer(bots []api.Bot, listStatus, cancelStatus int) *httptest.Server {
+	rtr := mux.NewRouter()
+	rtr.HandleFunc(rest.ListBotsRoute, func(w http.ResponseWriter, r *http.Request) {
+		if listStatus != http.StatusOK {
+			w.WriteHeader(listStatus)
+			return
+		}
+		if r.URL.Query().Get("offset") != "0" {
+			bots = nil
+		}
+		json.NewEncoder(w).Encode(append([]api.Bot{}, bots...))
+	})
+	rtr.HandleFunc("/ver1/deals/{id:[0-9]+}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(cancelStatus)
+	})
+	return httptest.NewServer(rtr)
+}
+
+func manualBot(id int, pairs ...string) api.Bot {
+	return api.Bot{
+		ID:           id,
+		Name:         "bot",
+		Pairs:        pairs,
+		IsEnabled:    true,
+		StrategyList: []api.BotStrategy{{Strategy: "manual"}},
+	}
+}
+
+func TestRun(t *testing.T) {
+	mapping := config.BotMapping{
+		ID:          "test",
+		Source:      config.BotConfig{ID: 1},
+		Destination: config.BotConfig{ID: 2},
+	}
+	overridden := mapping
+	overridden.Overrides = config.BotOverrides{QuoteCurrency: "USD"}
+	simulated := mapping
+	simulated.Destination = config.BotConfig{Type: config.BotTypeSimulated}
+
+	tests := []struct {
+		name         string
+		bots         []api.Bot
+		mapping      config.BotMapping
+		listStatus   int
+		cancelStatus int
+		dryRun       bool
+		want         []string
+		wantWarnings []string
+	}{
+		{
+			name:    "ok",
+			bots:    []api.Bot{manualBot(1, "USDT_BTC"), manualBot(2, "USDT_BTC", "USDT_ETH")},
+			mapping: mapping,
+		},
+		{
+			name:       "bad credentials",
+			listStatus: http.StatusUnauthorized,
+			mapping:    mapping,
+			want:       []string{"api"},
+		},
+		{
+			name:         "read only key",
+			bots:         []api.Bot{manualBot(1), manualBot(2)},
+			mapping:      mapping,
+			cancelStatus: http.StatusForbidden,
+			want:         []string{"api"},
+		},
+		{
+			name:         "dry run sends no cancel",
+			bots:         []api.Bot{manualBot(1), manualBot(2)},
+			mapping:      mapping,
+			cancelStatus: http.StatusForbidden,
+			dryRun:       true,
+		},
+		{
+			name:         "simulated sends no cancel",
+			bots:         []api.Bot{manualBot(1, "USDT_BTC")},
+			mapping:      simulated,
+			cancelStatus: http.StatusForbidden,
+		},
+		{
+			name:         "write access unknown",
+			bots:         []api.Bot{manualBot(1), manualBot(2)},
+			mapping:      mapping,
+			cancelStatus: http.StatusBadGateway,
+			wantWarnings: []string{"api"},
+		},
+		{
+			name:    "missing bots",
+			mapping: mapping,
+			want:    []string{"bots[0].source.bot_id", "bots[0].dest.bot_id"},
+		},
+		{
+			name:         "destination not manual and disabled",
+			bots:         []api.Bot{manualBot(1), {ID: 2}},
+			mapping:      mapping,
+			wantWarnings: []string{"bots[0].dest.bot_id", "bots[0].dest.bot_id"},
+		},
+		{
+			name:         "missing pairs",
+			bots:         []api.Bot{manualBot(1, "USDT_BTC", "USDT_ETH"), manualBot(2, "USDT_BTC")},
+			mapping:      mapping,
+			wantWarnings: []string{"bots[0].dest.bot_id"},
+		},
+		{
+			name:    "simulated destination",
+			bots:    []api.Bot{manualBot(1, "USDT_BTC")},
+			mapping: simulated,
+		},
+		{
+			name:    "pairs after overrides",
+			bots:    []api.Bot{manualBot(1, "USDT_BTC"), manualBot(2, "USD_BTC")},
+			mapping: overridden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.listStatus == 0 {
+				tt.listStatus = http.StatusOK
+			}
+			if tt.cancelStatus == 0 {
+				tt.cancelStatus = http.StatusNotFound
+			}
+			test3CServer := newTest3CServer(tt.bots, tt.listStatus, tt.cancelStatus)
+			defer test3CServer.Close()
+
+			c := config.Config{
+				API:    config.API{Key: "abcd1234", Secret: "zyxw9876", RestURL: test3CServer.URL},
+				Bots:   []config.BotMapping{tt.mapping},
+				DryRun: tt.dryRun,
+			}
+			issues := Run(c)
+
+			var got, gotWarnings []string
+			for _, issue := range issues.Errors() {
+				got = append(got, issue.Path)
+			}
+			for _, issue := range issues.Warnings() {
+				gotWarnings = append(gotWarnings, issue.Path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Run() errors = %v, want %v", issues.Errors(), tt.want)
+			}
+			if !reflect.DeepEqual(gotWarnings, tt.wantWarnings) {
+				t.Errorf("Run() warnings = %v, want %v", issues.Warnings(), tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func Test_missingPairs(t *testing.T) {
+	tests := []struct {
+		name      string
+		source    []string
+		dest      []string
+		overrides config.BotOverrides
+		want      []string
+	}{
+		{name: "all traded", source: []string{"USDT_BTC"}, dest: []string{"USDT_BTC", "USDT_ETH"}},
+		{name: "missing", source: []string{"USDT_BTC", "USDT_ETH"}, dest: []string{"USDT_BTC"}, want: []string{"USDT_ETH"}},
+		{
+			name:      "overridden",
+			source:    []string{"USDT_BTC"},
+			dest:      []string{"USDT_BTC"},
+			overrides: config.BotOverrides{QuoteCurrency: "BUSD"},
+			want:      []string{"USDT_BTC (sent as BUSD_BTC)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingPairs(tt.source, tt.dest, tt.overrides); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("missingPairs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
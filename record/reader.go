@@ -0,0 +1,111 @@
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/gorilla/websocket"
+)
+
+// Reader reads the frames of a recording.  Besides the files written by a Recorder, it accepts dumps of the raw
+// messages 3Commas sent, either one JSON object per line or a single JSON array, reading each as an inbound text
+// frame with no time.
+type Reader struct {
+	lines *bufio.Reader
+	dump  *json.Decoder
+	line  int
+}
+
+// NewReader reads frames from r
+func NewReader(r io.Reader) (*Reader, error) {
+	lines := bufio.NewReader(r)
+	first, err := firstByte(lines)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if first != '[' {
+		return &Reader{lines: lines}, nil
+	}
+
+	dump := json.NewDecoder(lines)
+	if _, err := dump.Token(); err != nil {
+		return nil, fmt.Errorf("could not read payload dump: %v", err)
+	}
+	return &Reader{dump: dump}, nil
+}
+
+// firstByte peeks at the first byte which is not whitespace
+func firstByte(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			return b, r.UnreadByte()
+		}
+	}
+}
+
+// Next returns the next frame, or io.EOF once there are none left
+func (r *Reader) Next() (Frame, error) {
+	if r.dump != nil {
+		if !r.dump.More() {
+			return Frame{}, io.EOF
+		}
+		var payload json.RawMessage
+		if err := r.dump.Decode(&payload); err != nil {
+			return Frame{}, fmt.Errorf("could not read payload dump: %v", err)
+		}
+		return payloadFrame(payload), nil
+	}
+
+	for {
+		line, err := r.lines.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return Frame{}, err
+		}
+		r.line++
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		frame, parseErr := parseFrame(line)
+		if parseErr != nil {
+			return Frame{}, fmt.Errorf("line %d: %v", r.line, parseErr)
+		}
+		return frame, nil
+	}
+}
+
+// parseFrame reads a line of a recording, which is either a recorded frame or a raw message
+func parseFrame(line []byte) (Frame, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return Frame{}, fmt.Errorf("not a JSON object: %v", err)
+	}
+	if _, ok := fields["direction"]; !ok {
+		return payloadFrame(line), nil
+	}
+	var frame Frame
+	if err := json.Unmarshal(line, &frame); err != nil {
+		return Frame{}, fmt.Errorf("invalid frame: %v", err)
+	}
+	return frame, nil
+}
+
+// payloadFrame wraps a raw message in an inbound text frame
+func payloadFrame(payload []byte) Frame {
+	return Frame{Direction: Inbound, Type: messageTypes[websocket.TextMessage], Data: append(json.RawMessage(nil), payload...)}
+}
+
+// Payload returns the content of the frame as it was sent, less any redacted credentials
+func (f Frame) Payload() []byte {
+	if len(f.Data) != 0 {
+		return f.Data
+	}
+	return []byte(f.Text)
+}
@@ -0,0 +1,72 @@
+package record
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReader_Next(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "recording",
+			data: `{"time":"2021-11-01T12:00:00Z","direction":"in","type":"text","data":{"type":"welcome"}}
+{"time":"2021-11-01T12:00:01Z","direction":"out","type":"text","data":{"command":"subscribe"}}
+
+{"time":"2021-11-01T12:00:02Z","direction":"in","type":"binary","text":"not json"}
+`,
+			want: []string{`in text {"type":"welcome"}`, `out text {"command":"subscribe"}`, `in binary not json`},
+		},
+		{
+			name: "payload lines",
+			data: `{"type":"welcome"}
+{"message":{"id":1}}`,
+			want: []string{`in text {"type":"welcome"}`, `in text {"message":{"id":1}}`},
+		},
+		{
+			name: "payload array",
+			data: ` [{"type":"welcome"}, {"message":{"id":1}}]`,
+			want: []string{`in text {"type":"welcome"}`, `in text {"message":{"id":1}}`},
+		},
+		{
+			name: "empty",
+		},
+		{
+			name:    "not json",
+			data:    "{\"type\":\"welcome\"}\nnot json\n",
+			want:    []string{`in text {"type":"welcome"}`},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("NewReader() error = %v", err)
+			}
+			var got []string
+			for {
+				frame, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					if !tt.wantErr {
+						t.Fatalf("Next() error = %v", err)
+					}
+					break
+				}
+				got = append(got, string(frame.Direction)+" "+frame.Type+" "+string(frame.Payload()))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("frames = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Package record writes the raw frames of a websocket connection to a file, one JSON object per line, so a session can
+// be inspected or replayed later
+package record
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Direction is whether a frame was received or sent
+type Direction string
+
+// Directions a frame may travel in
+const (
+	// Inbound frames were received from 3Commas
+	Inbound Direction = "in"
+	// Outbound frames were sent to 3Commas
+	Outbound Direction = "out"
+)
+
+// Redacted replaces the value of every credential found in a frame
+const Redacted = "<redacted>"
+
+// credentialPattern matches the values of credential fields.  The deals subscription carries them in an identifier
+// which is itself encoded as a JSON string, so the quotes around them may be escaped.
+var credentialPattern = regexp.MustCompile(`(\\*"(?:api_key|signature|secret)\\*"\s*:\s*\\*")[^"\\]*`)
+
+// messageTypes names the websocket message types
+var messageTypes = map[int]string{
+	websocket.TextMessage:   "text",
+	websocket.BinaryMessage: "binary",
+	websocket.CloseMessage:  "close",
+	websocket.PingMessage:   "ping",
+	websocket.PongMessage:   "pong",
+}
+
+// Frame is a single recorded websocket frame.  Data holds frames which are valid JSON, anything else is kept as Text.
+// Close frames are kept as Text in the form "CODE REASON".
+type Frame struct {
+	Time      time.Time       `json:"time"`
+	Direction Direction       `json:"direction"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Text      string          `json:"text,omitempty"`
+}
+
+// Rotation limits the size of a recording.  Once the file reaches MaxSize megabytes it is renamed with a timestamp
+// and a new file started, keeping at most MaxBackups old files for at most MaxAge days.  Zero MaxBackups or MaxAge
+// keeps every old file.
+type Rotation struct {
+	MaxSize    int
+	MaxBackups int
+	MaxAge     int
+	Compress   bool
+}
+
+// DefaultRotation is used for recordings unless told otherwise
+var DefaultRotation = Rotation{MaxSize: 100, MaxBackups: 5}
+
+// Recorder writes frames to a recording.  A nil Recorder records nothing, so callers need not check whether recording
+// is enabled.
+type Recorder struct {
+	mu  sync.Mutex
+	out io.WriteCloser
+	enc *json.Encoder
+	now func() time.Time
+}
+
+// New records frames to out
+func New(out io.WriteCloser) *Recorder {
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	return &Recorder{out: out, enc: enc, now: time.Now}
+}
+
+// Open records frames to the file at path, rotating it as given
+func Open(path string, rotation Rotation) (*Recorder, error) {
+	if rotation.MaxSize <= 0 {
+		return nil, fmt.Errorf("invalid recording size limit %d, must be at least 1MB", rotation.MaxSize)
+	}
+	// recordings hold account activity, so create them private; rotated files keep the mode of the original
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return New(&lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    rotation.MaxSize,
+		MaxBackups: rotation.MaxBackups,
+		MaxAge:     rotation.MaxAge,
+		Compress:   rotation.Compress,
+	}), nil
+}
+
+// Record writes a frame of the given websocket message type, redacting any credentials it holds
+func (r *Recorder) Record(direction Direction, messageType int, data []byte) error {
+	if r == nil {
+		return nil
+	}
+
+	data = Redact(data)
+	frame := Frame{Direction: direction, Type: messageTypes[messageType]}
+	if frame.Type == "" {
+		frame.Type = fmt.Sprintf("%d", messageType)
+	}
+	if messageType == websocket.CloseMessage && len(data) >= 2 {
+		// close frames carry a binary status code ahead of the reason
+		frame.Text = strings.TrimSpace(fmt.Sprintf("%d %s", binary.BigEndian.Uint16(data), data[2:]))
+	} else if json.Valid(data) {
+		frame.Data = data
+	} else {
+		frame.Text = string(data)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	frame.Time = r.now().UTC()
+	if err := r.enc.Encode(frame); err != nil {
+		return fmt.Errorf("could not record frame: %v", err)
+	}
+	return nil
+}
+
+// Close closes the recording
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.out.Close()
+}
+
+// Redact replaces the values of the API key, secret and signatures found in a frame
+func Redact(data []byte) []byte {
+	return credentialPattern.ReplaceAll(data, []byte("${1}"+Redacted))
+}
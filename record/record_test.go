@@ -0,0 +1,134 @@
+package record
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// nopCloser lets a buffer stand in for the recording file
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "plain",
+			data: `{"api_key":"abcd","signature":"1234"}`,
+			want: `{"api_key":"<redacted>","signature":"<redacted>"}`,
+		},
+		{
+			name: "subscription identifier",
+			data: `{"identifier":"{\"channel\":\"DealsChannel\",\"users\":[{\"api_key\":\"abcd\",\"signature\":\"1234\"}]}","command":"subscribe"}`,
+			want: `{"identifier":"{\"channel\":\"DealsChannel\",\"users\":[{\"api_key\":\"<redacted>\",\"signature\":\"<redacted>\"}]}","command":"subscribe"}`,
+		},
+		{
+			name: "nothing to redact",
+			data: `{"type":"ping","message":1234}`,
+			want: `{"type":"ping","message":1234}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(Redact([]byte(tt.data))); got != tt.want {
+				t.Errorf("Redact() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecorder_Record(t *testing.T) {
+	buf := nopCloser{&bytes.Buffer{}}
+	r := New(buf)
+	now := time.Date(2021, 11, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	frames := []struct {
+		direction   Direction
+		messageType int
+		data        string
+	}{
+		{Outbound, websocket.TextMessage, `{"command":"subscribe","identifier":"{\"users\":[{\"api_key\":\"abcd\"}]}"}`},
+		{Inbound, websocket.TextMessage, `{"type":"ping","message":1}`},
+		{Inbound, websocket.BinaryMessage, "not json"},
+		{Outbound, websocket.CloseMessage, string(websocket.FormatCloseMessage(websocket.CloseNormalClosure, "bye"))},
+	}
+	for _, f := range frames {
+		if err := r.Record(f.direction, f.messageType, []byte(f.data)); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(frames) {
+		t.Fatalf("recorded %d lines, want %d", len(lines), len(frames))
+	}
+	want := []Frame{
+		{Time: now, Direction: Outbound, Type: "text", Data: json.RawMessage(`{"command":"subscribe","identifier":"{\"users\":[{\"api_key\":\"<redacted>\"}]}"}`)},
+		{Time: now, Direction: Inbound, Type: "text", Data: json.RawMessage(`{"type":"ping","message":1}`)},
+		{Time: now, Direction: Inbound, Type: "binary", Text: "not json"},
+		{Time: now, Direction: Outbound, Type: "close", Text: "1000 bye"},
+	}
+	for i, line := range lines {
+		var got Frame
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("line %d is not a frame: %v", i, err)
+		}
+		if !got.Time.Equal(want[i].Time) || got.Direction != want[i].Direction || got.Type != want[i].Type ||
+			string(got.Data) != string(want[i].Data) || got.Text != want[i].Text {
+			t.Errorf("line %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestRecorder_nil(t *testing.T) {
+	var r *Recorder
+	if err := r.Record(Inbound, websocket.TextMessage, []byte("{}")); err != nil {
+		t.Errorf("Record() error = %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.ndjson")
+	if _, err := Open(path, Rotation{}); err == nil {
+		t.Fatalf("Open() without a size limit succeeded")
+	}
+
+	r, err := Open(path, DefaultRotation)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err := r.Record(Inbound, websocket.TextMessage, []byte(`{"type":"welcome"}`)); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read recording: %v", err)
+	}
+	if !strings.Contains(string(data), `"data":{"type":"welcome"}`) {
+		t.Errorf("recording = %s, want the welcome frame", data)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("recording mode = %v, want 0600", info.Mode().Perm())
+	}
+}
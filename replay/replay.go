@@ -0,0 +1,52 @@
+// Package replay plays recorded websocket frames back through deal handling, sending the destination calls they
+// cause to a stand in for the 3Commas REST API
+package replay
+
+import (
+	"io"
+	"time"
+
+	"github.com/jslowik/commacloner/record"
+)
+
+// Player plays back the inbound frames of a recording.  Speed scales the gaps between frames: 1 plays at the recorded
+// speed, 10 ten times faster, and 0 as fast as possible.  Frames without a time, such as those of a payload dump, are
+// played without waiting.
+type Player struct {
+	Speed float64
+
+	// sleep waits between frames, replaced in tests
+	sleep func(time.Duration)
+}
+
+// Play passes the payload of each inbound frame to handle, in order, returning the number of frames played
+func (p Player) Play(frames *record.Reader, handle func(payload []byte)) (int, error) {
+	sleep := p.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	played := 0
+	var last time.Time
+	for {
+		frame, err := frames.Next()
+		if err == io.EOF {
+			return played, nil
+		}
+		if err != nil {
+			return played, err
+		}
+		if frame.Direction != record.Inbound {
+			continue
+		}
+
+		if p.Speed > 0 && !frame.Time.IsZero() {
+			if !last.IsZero() && frame.Time.After(last) {
+				sleep(time.Duration(float64(frame.Time.Sub(last)) / p.Speed))
+			}
+			last = frame.Time
+		}
+		handle(frame.Payload())
+		played++
+	}
+}
@@ -0,0 +1,110 @@
+package replay
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jslowik/commacloner/api/rest"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/record"
+)
+
+const recording = `{"time":"2021-11-01T12:00:00Z","direction":"in","type":"text","data":{"type":"welcome"}}
+{"time":"2021-11-01T12:00:00.5Z","direction":"out","type":"text","data":{"command":"subscribe"}}
+{"time":"2021-11-01T12:00:01Z","direction":"in","type":"text","data":{"type":"confirm_subscription"}}
+{"time":"2021-11-01T12:00:11Z","direction":"in","type":"text","data":{"type":"ping","message":1}}
+`
+
+func TestPlayer_Play(t *testing.T) {
+	tests := []struct {
+		name  string
+		speed float64
+		data  string
+		want  []time.Duration
+	}{
+		{name: "recorded speed", speed: 1, data: recording, want: []time.Duration{time.Second, 10 * time.Second}},
+		{name: "accelerated", speed: 10, data: recording, want: []time.Duration{100 * time.Millisecond, time.Second}},
+		{name: "as fast as possible", speed: 0, data: recording},
+		{name: "payload dump", speed: 1, data: "{\"type\":\"welcome\"}\n{\"type\":\"ping\",\"message\":1}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames, err := record.NewReader(strings.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("NewReader() error = %v", err)
+			}
+			var slept []time.Duration
+			p := Player{Speed: tt.speed, sleep: func(d time.Duration) { slept = append(slept, d) }}
+
+			var payloads []string
+			played, err := p.Play(frames, func(payload []byte) { payloads = append(payloads, string(payload)) })
+			if err != nil {
+				t.Fatalf("Play() error = %v", err)
+			}
+			if played != len(payloads) || strings.Contains(strings.Join(payloads, ""), "subscribe\"") {
+				t.Errorf("Play() played %d frames %v, want only the inbound frames", played, payloads)
+			}
+			if !reflect.DeepEqual(slept, tt.want) {
+				t.Errorf("Play() slept %v, want %v", slept, tt.want)
+			}
+		})
+	}
+}
+
+func TestSink(t *testing.T) {
+	sink := NewSink()
+	server := httptest.NewServer(sink)
+	defer server.Close()
+	apiConfig := config.API{Key: "abcd1234", Secret: "zyxw9876", RestURL: server.URL}
+
+	mapping := config.BotMapping{ID: "test", Destination: config.BotConfig{ID: 2}}
+	deal, _, err := rest.StartNewDeal(apiConfig, mapping, "USDT_BTC")
+	if err != nil {
+		t.Fatalf("StartNewDeal() error = %v", err)
+	}
+	if deal.ID != 1 || deal.BotID != 2 || deal.Pair != "USDT_BTC" {
+		t.Errorf("StartNewDeal() = %+v, want deal 1 of bot 2 on USDT_BTC", deal)
+	}
+	if shown, _, err := rest.GetDeal(apiConfig, 1); err != nil || shown.ID != 1 || shown.Status != "created" {
+		t.Errorf("GetDeal() = %+v, %v, want deal 1 created", shown, err)
+	}
+	if _, err := rest.CancelDeal(apiConfig, 1, false); err != nil {
+		t.Errorf("CancelDeal() error = %v", err)
+	}
+	if shown, _, err := rest.GetDeal(apiConfig, 1); err != nil || shown.Status != "cancelled" || shown.Active() {
+		t.Errorf("GetDeal() = %+v, %v, want deal 1 cancelled", shown, err)
+	}
+	if _, err := rest.CancelDeal(apiConfig, 10, true); err != nil {
+		t.Errorf("CancelDeal() error = %v", err)
+	}
+	if _, _, err := rest.GetDeal(apiConfig, 10); err == nil {
+		t.Errorf("GetDeal() of a deal never started: no error")
+	}
+	if _, err := rest.DisableBot(apiConfig, 1); err != nil {
+		t.Errorf("DisableBot() error = %v", err)
+	}
+	if bots, err := rest.ListBots(apiConfig); err != nil || len(bots) != 0 {
+		t.Errorf("ListBots() = %v, %v, want no bots", bots, err)
+	}
+
+	var paths []string
+	for _, call := range sink.Calls() {
+		paths = append(paths, call.Method+" "+call.Path)
+	}
+	want := []string{
+		"POST /ver1/bots/2/start_new_deal",
+		"GET /ver1/deals/1/show",
+		"POST /ver1/deals/1/cancel",
+		"GET /ver1/deals/1/show",
+		"POST /ver1/deals/10/panic_sell",
+		"GET /ver1/deals/10/show",
+		"POST /ver1/bots/1/disable",
+		"GET /ver1/bots",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("Calls() = %v, want %v", paths, want)
+	}
+}
@@ -0,0 +1,121 @@
+package replay
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/api/rest"
+	"github.com/jslowik/commacloner/log"
+)
+
+// Call is a request made to a Sink
+type Call struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+}
+
+// Sink stands in for the 3Commas REST API.  Every deal is started, cancelled or sold and every bot disabled without
+// anything happening, and each request is kept so it can be reported afterwards.  Deals it starts are remembered, so
+// showing one returns it as it was started, or as cancelled or sold once either has been asked for.
+type Sink struct {
+	mu     sync.Mutex
+	calls  []Call
+	dealID int
+	deals  map[int]api.Deal
+	router *mux.Router
+}
+
+// NewSink creates a Sink.  Deals it starts are numbered from 1.
+func NewSink() *Sink {
+	s := &Sink{deals: map[int]api.Deal{}}
+	s.router = mux.NewRouter()
+	s.router.HandleFunc("/ver1/bots/{id:[0-9]+}/start_new_deal", s.startNewDeal).Methods("POST")
+	s.router.HandleFunc("/ver1/deals/{id:[0-9]+}/cancel", s.closeDeal("cancelled")).Methods("POST")
+	s.router.HandleFunc("/ver1/deals/{id:[0-9]+}/panic_sell", s.closeDeal("panic_sold")).Methods("POST")
+	s.router.HandleFunc("/ver1/deals/{id:[0-9]+}/show", s.showDeal).Methods("GET")
+	s.router.HandleFunc("/ver1/bots/{id:[0-9]+}/disable", s.respond(http.StatusOK)).Methods("POST")
+	s.router.HandleFunc(rest.ListBotsRoute, s.list).Methods("GET")
+	s.router.HandleFunc(rest.ListDealsRoute, s.list).Methods("GET")
+	return s
+}
+
+// ServeHTTP keeps the request and answers it as 3Commas would if it succeeded
+func (s *Sink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.calls = append(s.calls, Call{Method: r.Method, Path: r.URL.Path, Query: r.URL.RawQuery})
+	s.mu.Unlock()
+
+	logger := log.NewLogger("sink")
+	logger.Infof("%s %s %s", r.Method, r.URL.Path, r.URL.RawQuery)
+	s.router.ServeHTTP(w, r)
+}
+
+// Calls returns the requests made so far, in order
+func (s *Sink) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+func (s *Sink) startNewDeal(w http.ResponseWriter, r *http.Request) {
+	botID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	s.mu.Lock()
+	s.dealID++
+	deal := api.Deal{ID: s.dealID, BotID: botID, Pair: r.URL.Query().Get("pair"), Status: "created"}
+	s.deals[deal.ID] = deal
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(deal)
+}
+
+// closeDeal answers a cancel or panic sell, giving the deal the status 3Commas would once it had closed
+func (s *Sink) closeDeal(status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dealID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+		s.mu.Lock()
+		if deal, ok := s.deals[dealID]; ok {
+			deal.Status = status
+			s.deals[dealID] = deal
+		}
+		s.mu.Unlock()
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// showDeal answers with a deal the sink started, or not found for any other
+func (s *Sink) showDeal(w http.ResponseWriter, r *http.Request) {
+	dealID, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	s.mu.Lock()
+	deal, ok := s.deals[dealID]
+	s.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deal)
+}
+
+func (s *Sink) respond(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}
+}
+
+// list answers listing requests with an empty list
+func (s *Sink) list(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("[]"))
+}
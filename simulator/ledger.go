@@ -0,0 +1,64 @@
+package simulator
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jslowik/commacloner/state"
+)
+
+// Entry totals the paper deals of a mapping in a single quote currency
+type Entry struct {
+	Mapping  string `json:"mapping"`
+	Currency string `json:"currency"`
+	Open     int    `json:"open"`
+	Closed   int    `json:"closed"`
+	Won      int    `json:"won"`
+	Lost     int    `json:"lost"`
+	// OpenVolume is the amount bought by the deals still open
+	OpenVolume float64 `json:"open_volume"`
+	// Profit is the profit, or loss, made by the closed deals
+	Profit float64 `json:"profit"`
+}
+
+// Ledger totals paper deals by mapping and quote currency, ordered by mapping and then currency
+func Ledger(deals []state.SimulatedDeal) []Entry {
+	index := make(map[[2]string]*Entry)
+	var entries []*Entry
+	for _, deal := range deals {
+		currency := strings.SplitN(deal.Pair, "_", 2)[0]
+		k := [2]string{deal.Mapping, currency}
+		entry, ok := index[k]
+		if !ok {
+			entry = &Entry{Mapping: deal.Mapping, Currency: currency}
+			index[k] = entry
+			entries = append(entries, entry)
+		}
+
+		if deal.Status == StatusActive {
+			entry.Open++
+			entry.OpenVolume += deal.BoughtVolume
+			continue
+		}
+		entry.Closed++
+		entry.Profit += deal.Profit
+		switch {
+		case deal.Profit > 0:
+			entry.Won++
+		case deal.Profit < 0:
+			entry.Lost++
+		}
+	}
+
+	ledger := make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		ledger = append(ledger, *entry)
+	}
+	sort.Slice(ledger, func(i, j int) bool {
+		if ledger[i].Mapping != ledger[j].Mapping {
+			return ledger[i].Mapping < ledger[j].Mapping
+		}
+		return ledger[i].Currency < ledger[j].Currency
+	})
+	return ledger
+}
@@ -0,0 +1,167 @@
+// Package simulator stands in for destination bots.  Rather than starting a deal on 3Commas, a simulated destination
+// opens a paper deal which follows the source deal's updates until it closes, keeping a ledger of the profit and loss.
+package simulator
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/state"
+)
+
+// StatusActive is the status of a paper deal whose source deal is still open
+const StatusActive = "active"
+
+// closedStatuses are the source deal statuses which close a paper deal.  The paper deal takes the source's status.
+var closedStatuses = map[string]bool{
+	"completed":          true,
+	"panic_sold":         true,
+	"stop_loss_finished": true,
+	"cancelled":          true,
+	"failed":             true,
+}
+
+// Event is what an update of a source deal did to its paper deal
+type Event string
+
+// Events returned by Observe
+const (
+	// EventNone means the update did not change any paper deal
+	EventNone Event = ""
+	// EventOpened means a paper deal was opened for a new source deal
+	EventOpened Event = "opened"
+	// EventUpdated means an open paper deal changed, such as when a safety order filled
+	EventUpdated Event = "updated"
+	// EventClosed means the source deal closed and its paper deal with it
+	EventClosed Event = "closed"
+)
+
+// key identifies the paper deal a mapping opened for a source deal
+type key struct {
+	mapping      string
+	sourceDealID int
+}
+
+// Simulator opens and follows paper deals.  Deals are saved to a store if one is given, otherwise they are only kept
+// in memory.
+type Simulator struct {
+	mu     sync.Mutex
+	store  *state.Simulated
+	open   map[key]state.SimulatedDeal
+	closed []state.SimulatedDeal
+	nextID int
+	now    func() time.Time
+}
+
+// New creates a simulator, picking up the deals left open in the store by a previous run.  store may be nil.
+func New(store *state.Simulated) (*Simulator, error) {
+	s := &Simulator{store: store, open: make(map[key]state.SimulatedDeal), nextID: 1, now: time.Now}
+	if store == nil {
+		return s, nil
+	}
+
+	deals, err := store.All()
+	if err != nil {
+		return nil, fmt.Errorf("could not read simulated deals: %v", err)
+	}
+	for _, deal := range deals {
+		if deal.ID >= s.nextID {
+			s.nextID = deal.ID + 1
+		}
+		if deal.Status == StatusActive {
+			s.open[key{deal.Mapping, deal.SourceDealID}] = deal
+		} else {
+			s.closed = append(s.closed, deal)
+		}
+	}
+	return s, nil
+}
+
+// Observe applies an update of a source deal to the mapping's paper deal.  A paper deal is opened for a new source
+// deal, and closed when the source deal closes; updates of source deals which have no paper deal are ignored.  The
+// paper deal is returned along with what the update did to it.
+func (s *Simulator) Observe(mapping config.BotMapping, source api.DealDetails, isNew bool) (state.SimulatedDeal, Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := key{mapping.ID, source.ID}
+	deal, tracked := s.open[k]
+	switch {
+	case tracked:
+	case isNew:
+		deal = state.SimulatedDeal{
+			ID:           s.nextID,
+			Mapping:      mapping.ID,
+			SourceBotID:  source.BotID,
+			SourceDealID: source.ID,
+			Pair:         mapping.Overrides.Pair(source.Pair),
+			Status:       StatusActive,
+			Opened:       s.now().UTC(),
+		}
+		s.nextID++
+	default:
+		return deal, EventNone, nil
+	}
+
+	updated := deal
+	if volume := amount(source.BoughtVolume); volume != 0 {
+		updated.BoughtVolume = volume
+	}
+	if closedStatuses[source.Status] {
+		closed := s.now().UTC()
+		updated.Status = source.Status
+		updated.ProfitPercentage = amount(source.FinalProfitPercentage)
+		// the profit 3Commas reports is used as is, and only worked out from the percentage when it is missing
+		profit, err := strconv.ParseFloat(source.FinalProfit, 64)
+		if err != nil {
+			profit = updated.BoughtVolume * updated.ProfitPercentage / 100
+		}
+		updated.Profit = profit
+		updated.Closed = &closed
+	}
+	if tracked && updated == deal {
+		return deal, EventNone, nil
+	}
+
+	if s.store != nil {
+		if err := s.store.Save(updated); err != nil {
+			return deal, EventNone, err
+		}
+	}
+	if updated.Status != StatusActive {
+		delete(s.open, k)
+		s.closed = append(s.closed, updated)
+		return updated, EventClosed, nil
+	}
+	s.open[k] = updated
+	if !tracked {
+		return updated, EventOpened, nil
+	}
+	return updated, EventUpdated, nil
+}
+
+// Deals returns every paper deal, ordered by id
+func (s *Simulator) Deals() []state.SimulatedDeal {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deals := append([]state.SimulatedDeal(nil), s.closed...)
+	for _, deal := range s.open {
+		deals = append(deals, deal)
+	}
+	sort.Slice(deals, func(i, j int) bool { return deals[i].ID < deals[j].ID })
+	return deals
+}
+
+// amount parses an amount sent by 3Commas, which are sent as strings.  Missing or invalid amounts are zero.
+func amount(value string) float64 {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
@@ -0,0 +1,130 @@
+package simulator
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jslowik/commacloner/api"
+	"github.com/jslowik/commacloner/config"
+	"github.com/jslowik/commacloner/state"
+)
+
+func TestSimulator_Observe(t *testing.T) {
+	store, err := state.OpenSimulated(filepath.Join(t.TempDir(), "state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	mapping := config.BotMapping{
+		ID:          "paper",
+		Source:      config.BotConfig{ID: 1},
+		Destination: config.BotConfig{Type: config.BotTypeSimulated},
+		Overrides:   config.BotOverrides{QuoteCurrency: "USD"},
+	}
+	steps := []struct {
+		name      string
+		source    api.DealDetails
+		isNew     bool
+		wantEvent Event
+		want      state.SimulatedDeal
+	}{
+		{
+			name:   "update of an untracked deal",
+			source: api.DealDetails{ID: 99, BotID: 1, Pair: "USDT_BTC", Status: "bought", BoughtVolume: "10"},
+		},
+		{
+			name:      "new deal",
+			source:    api.DealDetails{ID: 100, BotID: 1, Pair: "USDT_BTC", Status: "bought", BoughtVolume: "10"},
+			isNew:     true,
+			wantEvent: EventOpened,
+			want:      state.SimulatedDeal{ID: 1, Mapping: "paper", SourceBotID: 1, SourceDealID: 100, Pair: "USD_BTC", Status: StatusActive, BoughtVolume: 10, Opened: now},
+		},
+		{
+			name:   "repeated update",
+			source: api.DealDetails{ID: 100, BotID: 1, Pair: "USDT_BTC", Status: "bought", BoughtVolume: "10"},
+			isNew:  true,
+			want:   state.SimulatedDeal{ID: 1, Mapping: "paper", SourceBotID: 1, SourceDealID: 100, Pair: "USD_BTC", Status: StatusActive, BoughtVolume: 10, Opened: now},
+		},
+		{
+			name:      "safety order filled",
+			source:    api.DealDetails{ID: 100, BotID: 1, Pair: "USDT_BTC", Status: "bought", CompletedSafetyOrdersCount: 1, BoughtVolume: "30"},
+			wantEvent: EventUpdated,
+			want:      state.SimulatedDeal{ID: 1, Mapping: "paper", SourceBotID: 1, SourceDealID: 100, Pair: "USD_BTC", Status: StatusActive, BoughtVolume: 30, Opened: now},
+		},
+		{
+			name:      "completed",
+			source:    api.DealDetails{ID: 100, BotID: 1, Pair: "USDT_BTC", Status: "completed", BoughtVolume: "30", FinalProfit: "0.58", FinalProfitPercentage: "2.0"},
+			wantEvent: EventClosed,
+			want:      state.SimulatedDeal{ID: 1, Mapping: "paper", SourceBotID: 1, SourceDealID: 100, Pair: "USD_BTC", Status: "completed", BoughtVolume: 30, Profit: 0.58, ProfitPercentage: 2, Opened: now, Closed: &now},
+		},
+		{
+			name:   "update after closing",
+			source: api.DealDetails{ID: 100, BotID: 1, Pair: "USDT_BTC", Status: "completed", BoughtVolume: "30"},
+		},
+		{
+			name:      "second deal",
+			source:    api.DealDetails{ID: 101, BotID: 1, Pair: "USDT_ETH", Status: "bought", BoughtVolume: "10"},
+			isNew:     true,
+			wantEvent: EventOpened,
+			want:      state.SimulatedDeal{ID: 2, Mapping: "paper", SourceBotID: 1, SourceDealID: 101, Pair: "USD_ETH", Status: StatusActive, BoughtVolume: 10, Opened: now},
+		},
+		{
+			name:      "closed without a final profit",
+			source:    api.DealDetails{ID: 101, BotID: 1, Pair: "USDT_ETH", Status: "stop_loss_finished", BoughtVolume: "10", FinalProfitPercentage: "-1.5"},
+			wantEvent: EventClosed,
+			want:      state.SimulatedDeal{ID: 2, Mapping: "paper", SourceBotID: 1, SourceDealID: 101, Pair: "USD_ETH", Status: "stop_loss_finished", BoughtVolume: 10, Profit: -0.15, ProfitPercentage: -1.5, Opened: now, Closed: &now},
+		},
+	}
+	for _, step := range steps {
+		got, event, err := s.Observe(mapping, step.source, step.isNew)
+		if err != nil {
+			t.Fatalf("%s: Observe() error = %v", step.name, err)
+		}
+		if event != step.wantEvent {
+			t.Errorf("%s: Observe() event = %q, want %q", step.name, event, step.wantEvent)
+		}
+		if !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: Observe() = %+v, want %+v", step.name, got, step.want)
+		}
+	}
+
+	// a new simulator carries on from the store
+	restarted, err := New(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := restarted.Deals(); !reflect.DeepEqual(got, s.Deals()) {
+		t.Errorf("Deals() after restart = %+v, want %+v", got, s.Deals())
+	}
+	restarted.now = s.now
+	got, _, err := restarted.Observe(mapping, api.DealDetails{ID: 102, BotID: 1, Pair: "USDT_BTC", Status: "bought"}, true)
+	if err != nil || got.ID != 3 {
+		t.Errorf("Observe() after restart = %+v, %v, want deal 3", got, err)
+	}
+}
+
+func TestLedger(t *testing.T) {
+	deals := []state.SimulatedDeal{
+		{Mapping: "b", Pair: "USD_BTC", Status: "completed", BoughtVolume: 100, Profit: 2},
+		{Mapping: "a", Pair: "USD_BTC", Status: "completed", BoughtVolume: 100, Profit: 1.5},
+		{Mapping: "a", Pair: "USD_ETH", Status: "stop_loss_finished", BoughtVolume: 50, Profit: -2.5},
+		{Mapping: "a", Pair: "USD_ETH", Status: "cancelled", BoughtVolume: 50},
+		{Mapping: "a", Pair: "BTC_ETH", Status: StatusActive, BoughtVolume: 0.1},
+	}
+	want := []Entry{
+		{Mapping: "a", Currency: "BTC", Open: 1, OpenVolume: 0.1},
+		{Mapping: "a", Currency: "USD", Closed: 3, Won: 1, Lost: 1, Profit: -1},
+		{Mapping: "b", Currency: "USD", Closed: 1, Won: 1, Profit: 2},
+	}
+	if got := Ledger(deals); !reflect.DeepEqual(got, want) {
+		t.Errorf("Ledger() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,84 @@
+package state
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// approvalsFile is the name of the approval queue store within the state directory
+const approvalsFile = "approvals.jsonl"
+
+// ApprovalStatus is where a queued deal is in the approval process
+type ApprovalStatus string
+
+// Approval statuses
+const (
+	// ApprovalPending deals are waiting to be approved or rejected
+	ApprovalPending ApprovalStatus = "pending"
+	// ApprovalApproved deals were approved and sent to the destination bot
+	ApprovalApproved ApprovalStatus = "approved"
+	// ApprovalRejected deals were rejected and never sent
+	ApprovalRejected ApprovalStatus = "rejected"
+	// ApprovalExpired deals were not approved in time and were handled by the mapping's on_unavailable policy
+	ApprovalExpired ApprovalStatus = "expired"
+)
+
+// Approval is a new source deal a mapping is waiting for approval to clone.  Pair is the source deal's pair and
+// DestPair the pair which would be sent to the destination bot.  Once approved, DestDealID is the deal started, or
+// Error why it could not be.
+type Approval struct {
+	ID           int            `json:"id"`
+	Mapping      string         `json:"mapping"`
+	SourceBotID  int            `json:"source_bot_id"`
+	SourceDealID int            `json:"source_deal_id"`
+	DestBotID    int            `json:"dest_bot_id"`
+	Pair         string         `json:"pair"`
+	DestPair     string         `json:"dest_pair"`
+	Status       ApprovalStatus `json:"status"`
+	Created      time.Time      `json:"created"`
+	Expires      time.Time      `json:"expires"`
+	Decided      *time.Time     `json:"decided,omitempty"`
+	DestDealID   int            `json:"dest_deal_id,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
+
+// Approvals is the approval queue store.  Each change to an approval is appended to approvals.jsonl as the whole
+// approval, one JSON object per line, and the latest line with each id wins.
+type Approvals struct {
+	journal *journal
+}
+
+// OpenApprovals opens the approval queue store in the given state directory, creating the directory if needed
+func OpenApprovals(dir string) (*Approvals, error) {
+	j, err := openJournal(dir, approvalsFile, "approvals")
+	if err != nil {
+		return nil, err
+	}
+	return &Approvals{journal: j}, nil
+}
+
+// Save records the current state of an approval
+func (a *Approvals) Save(approval Approval) error {
+	return a.journal.append(approval)
+}
+
+// All returns the latest state of every approval, ordered by id
+func (a *Approvals) All() ([]Approval, error) {
+	latest := make(map[int]Approval)
+	err := a.journal.each(func(data []byte) error {
+		var approval Approval
+		if err := json.Unmarshal(data, &approval); err != nil {
+			return err
+		}
+		latest[approval.ID] = approval
+		return nil
+	})
+
+	approvals := make([]Approval, 0, len(latest))
+	for _, approval := range latest {
+		approvals = append(approvals, approval)
+	}
+	sort.Slice(approvals, func(i, j int) bool { return approvals[i].ID < approvals[j].ID })
+	return approvals, err
+}
@@ -0,0 +1,41 @@
+package state
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApprovals(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	store, err := OpenApprovals(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	decided := created.Add(time.Minute)
+	expires := created.Add(15 * time.Minute)
+	saved := []Approval{
+		{ID: 1, Mapping: "a", SourceDealID: 100, Pair: "USDT_BTC", DestPair: "USD_BTC", Status: ApprovalPending, Created: created, Expires: expires},
+		{ID: 2, Mapping: "a", SourceDealID: 101, Pair: "USDT_ETH", DestPair: "USD_ETH", Status: ApprovalPending, Created: created, Expires: expires},
+		{ID: 1, Mapping: "a", SourceDealID: 100, Pair: "USDT_BTC", DestPair: "USD_BTC", Status: ApprovalApproved, Created: created, Expires: expires, Decided: &decided, DestDealID: 777},
+	}
+	for _, approval := range saved {
+		if err := store.Save(approval); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err := OpenApprovals(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	approvals, err := reopened.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Approval{saved[2], saved[1]}; !reflect.DeepEqual(approvals, want) {
+		t.Errorf("All() = %+v, want %+v", approvals, want)
+	}
+}
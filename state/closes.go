@@ -0,0 +1,70 @@
+package state
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// closesFile is the name of the pending close store within the state directory
+const closesFile = "closes.jsonl"
+
+// Close is a source deal the close_at_market_after_delay action closes at market once it is due.  Done is set once it
+// has been closed, or was found closed already.
+type Close struct {
+	Mapping      string    `json:"mapping"`
+	SourceBotID  int       `json:"source_bot_id"`
+	SourceDealID int       `json:"source_deal_id"`
+	Pair         string    `json:"pair"`
+	Reason       string    `json:"reason"`
+	Due          time.Time `json:"due"`
+	Done         bool      `json:"done"`
+}
+
+// closeKey identifies a pending close
+type closeKey struct {
+	mapping string
+	dealID  int
+}
+
+// Closes is the pending close store, kept so closes survive restarts.  Each change to a close is appended to
+// closes.jsonl as the whole close, and the latest line for each mapping and source deal wins.
+type Closes struct {
+	journal *journal
+}
+
+// OpenCloses opens the pending close store in the given state directory, creating the directory if needed
+func OpenCloses(dir string) (*Closes, error) {
+	j, err := openJournal(dir, closesFile, "pending closes")
+	if err != nil {
+		return nil, err
+	}
+	return &Closes{journal: j}, nil
+}
+
+// Save records the current state of a close
+func (c *Closes) Save(close Close) error {
+	return c.journal.append(close)
+}
+
+// Pending returns the closes which are not done, the soonest due first
+func (c *Closes) Pending() ([]Close, error) {
+	latest := make(map[closeKey]Close)
+	err := c.journal.each(func(data []byte) error {
+		var close Close
+		if err := json.Unmarshal(data, &close); err != nil {
+			return err
+		}
+		latest[closeKey{close.Mapping, close.SourceDealID}] = close
+		return nil
+	})
+
+	var pending []Close
+	for _, close := range latest {
+		if !close.Done {
+			pending = append(pending, close)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Due.Before(pending[j].Due) })
+	return pending, err
+}
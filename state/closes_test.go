@@ -0,0 +1,40 @@
+package state
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCloses(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	store, err := OpenCloses(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	due := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	saved := []Close{
+		{Mapping: "a", SourceBotID: 1, SourceDealID: 100, Pair: "USDT_BTC", Reason: "funds", Due: due.Add(time.Hour)},
+		{Mapping: "a", SourceBotID: 1, SourceDealID: 101, Pair: "USDT_ETH", Reason: "funds", Due: due.Add(2 * time.Hour)},
+		{Mapping: "b", SourceBotID: 1, SourceDealID: 100, Pair: "USDT_BTC", Reason: "deal_limit", Due: due},
+		{Mapping: "a", SourceBotID: 1, SourceDealID: 101, Pair: "USDT_ETH", Reason: "funds", Due: due.Add(2 * time.Hour), Done: true},
+	}
+	for _, close := range saved {
+		if err := store.Save(close); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err := OpenCloses(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending, err := reopened.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Close{saved[2], saved[0]}; !reflect.DeepEqual(pending, want) {
+		t.Errorf("Pending() = %+v, want %+v", pending, want)
+	}
+}
@@ -0,0 +1,109 @@
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/jslowik/commacloner/log"
+)
+
+// journal is a file of JSON records, one per line.  Records are only ever appended so a crash can lose at most the
+// record being written: the torn line it leaves is skipped when reading, and the next record starts on a line of its
+// own.
+type journal struct {
+	path string
+	// name describes the records in errors, ie "deal links"
+	name string
+	mu   sync.Mutex
+}
+
+// openJournal opens the journal file in the given state directory, creating the directory if needed
+func openJournal(dir, file, name string) (*journal, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("could not create state directory: %v", err)
+	}
+	return &journal{path: filepath.Join(dir, file), name: name}, nil
+}
+
+// readJournal opens an existing journal file without creating anything, returning nil if there is none
+func readJournal(dir, file, name string) (*journal, error) {
+	path := filepath.Join(dir, file)
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &journal{path: path, name: name}, nil
+}
+
+// append writes a record to the end of the journal
+func (j *journal) append(record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open %s: %v", j.name, err)
+	}
+	torn, err := endsTorn(f)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("could not read %s: %v", j.name, err)
+	}
+	if torn {
+		data = append([]byte{'\n'}, data...)
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write %s: %v", j.name, err)
+	}
+	return f.Close()
+}
+
+// endsTorn reports whether a file ends part way through a line, as a crash while appending leaves it
+func endsTorn(f *os.File) (bool, error) {
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return false, err
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, info.Size()-1); err != nil {
+		return false, err
+	}
+	return last[0] != '\n', nil
+}
+
+// each passes every record to decode in the order they were written.  Records which cannot be decoded, such as the
+// torn line left by a crash, are skipped with a warning.
+func (j *journal) each(decode func(data []byte) error) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.Open(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("could not open %s: %v", j.name, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := decode(scanner.Bytes()); err != nil {
+			log.NewLogger("state").Warnf("skipping %s record %s:%d: %v", j.name, j.path, line, err)
+		}
+	}
+	return scanner.Err()
+}
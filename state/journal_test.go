@@ -0,0 +1,44 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJournal_torn(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenApprovals(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	first := Approval{ID: 1, Mapping: "a", SourceDealID: 100, Status: ApprovalPending, Created: created, Expires: created}
+	if err := store.Save(first); err != nil {
+		t.Fatal(err)
+	}
+
+	// a crash part way through appending the second record leaves a torn line
+	f, err := os.OpenFile(filepath.Join(dir, approvalsFile), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte(`{"id":2,"mapping":"a","sou`)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	third := Approval{ID: 3, Mapping: "a", SourceDealID: 102, Status: ApprovalPending, Created: created, Expires: created}
+	if err := store.Save(third); err != nil {
+		t.Fatal(err)
+	}
+	approvals, err := store.All()
+	if err != nil {
+		t.Fatalf("All() error = %v, want the torn line skipped", err)
+	}
+	if want := []Approval{first, third}; !reflect.DeepEqual(approvals, want) {
+		t.Errorf("All() = %+v, want %+v", approvals, want)
+	}
+}
@@ -0,0 +1,76 @@
+// Package state keeps the records commacloner needs between runs in a state directory
+package state
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// linksFile is the name of the deal link store within the state directory
+const linksFile = "links.jsonl"
+
+// Link records a destination deal started for a source deal
+type Link struct {
+	Mapping      string    `json:"mapping"`
+	SourceBotID  int       `json:"source_bot_id"`
+	SourceDealID int       `json:"source_deal_id"`
+	DestBotID    int       `json:"dest_bot_id"`
+	DestDealID   int       `json:"dest_deal_id"`
+	Pair         string    `json:"pair"`
+	Created      time.Time `json:"created"`
+}
+
+// Links is the deal link store.  Links are appended to a JSON lines file so a crash can lose at most the link being
+// written.
+type Links struct {
+	journal *journal
+}
+
+// OpenLinks opens the deal link store in the given state directory, creating the directory if needed
+func OpenLinks(dir string) (*Links, error) {
+	j, err := openJournal(dir, linksFile, "deal links")
+	if err != nil {
+		return nil, err
+	}
+	return &Links{journal: j}, nil
+}
+
+// ReadLinks opens an existing deal link store without creating anything, returning nil if there is none
+func ReadLinks(dir string) (*Links, error) {
+	j, err := readJournal(dir, linksFile, "deal links")
+	if j == nil || err != nil {
+		return nil, err
+	}
+	return &Links{journal: j}, nil
+}
+
+// Add records a link
+func (l *Links) Add(link Link) error {
+	return l.journal.append(link)
+}
+
+// All returns every link in the order they were recorded
+func (l *Links) All() ([]Link, error) {
+	var links []Link
+	err := l.journal.each(func(data []byte) error {
+		var link Link
+		if err := json.Unmarshal(data, &link); err != nil {
+			return err
+		}
+		links = append(links, link)
+		return nil
+	})
+	return links, err
+}
+
+// ForDeal returns the links in which the deal is either the source or the destination
+func (l *Links) ForDeal(dealID int) ([]Link, error) {
+	all, err := l.All()
+	var links []Link
+	for _, link := range all {
+		if link.SourceDealID == dealID || link.DestDealID == dealID {
+			links = append(links, link)
+		}
+	}
+	return links, err
+}
@@ -0,0 +1,70 @@
+package state
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLinks(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+
+	if links, err := ReadLinks(dir); links != nil || err != nil {
+		t.Fatalf("ReadLinks() of a missing store = %v, %v, want nil", links, err)
+	}
+
+	links, err := OpenLinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	added := []Link{
+		{Mapping: "a", SourceBotID: 1, SourceDealID: 100, DestBotID: 2, DestDealID: 200, Pair: "USDT_BTC", Created: created},
+		{Mapping: "b", SourceBotID: 1, SourceDealID: 100, DestBotID: 3, DestDealID: 300, Pair: "USD_BTC", Created: created},
+		{Mapping: "a", SourceBotID: 1, SourceDealID: 101, DestBotID: 2, DestDealID: 201, Pair: "USDT_ETH", Created: created},
+	}
+	for _, link := range added {
+		if err := links.Add(link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read, err := ReadLinks(dir)
+	if err != nil || read == nil {
+		t.Fatalf("ReadLinks() = %v, %v", read, err)
+	}
+	tests := []struct {
+		name   string
+		dealID int
+		want   []Link
+	}{
+		{name: "source deal", dealID: 100, want: added[:2]},
+		{name: "destination deal", dealID: 201, want: added[2:]},
+		{name: "unlinked deal", dealID: 999},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := read.ForDeal(tt.dealID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ForDeal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLinks_All_corrupt(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, linksFile), []byte("{\"mapping\":\"a\"}\nnot json\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	links, _ := ReadLinks(dir)
+	got, err := links.All()
+	if err != nil || len(got) != 1 {
+		t.Errorf("All() = %v, %v, want the first link with the corrupt line skipped", got, err)
+	}
+}
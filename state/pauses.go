@@ -0,0 +1,50 @@
+package state
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// pausesFile is the name of the pause store within the state directory
+const pausesFile = "pauses.jsonl"
+
+// PauseChange records a mapping being paused or resumed.  An empty Mapping pauses or resumes every mapping at once.
+type PauseChange struct {
+	Mapping string    `json:"mapping,omitempty"`
+	Paused  bool      `json:"paused"`
+	Changed time.Time `json:"changed"`
+}
+
+// Pauses is the pause store.  Each pause or resume is appended to pauses.jsonl as a JSON object holding the mapping,
+// empty for every mapping, and whether it was paused; replaying them in order gives what is paused.
+type Pauses struct {
+	journal *journal
+}
+
+// OpenPauses opens the pause store in the given state directory, creating the directory if needed
+func OpenPauses(dir string) (*Pauses, error) {
+	j, err := openJournal(dir, pausesFile, "pauses")
+	if err != nil {
+		return nil, err
+	}
+	return &Pauses{journal: j}, nil
+}
+
+// Add records a change
+func (p *Pauses) Add(change PauseChange) error {
+	return p.journal.append(change)
+}
+
+// All returns every change in the order they were made
+func (p *Pauses) All() ([]PauseChange, error) {
+	var changes []PauseChange
+	err := p.journal.each(func(data []byte) error {
+		var change PauseChange
+		if err := json.Unmarshal(data, &change); err != nil {
+			return err
+		}
+		changes = append(changes, change)
+		return nil
+	})
+	return changes, err
+}
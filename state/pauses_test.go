@@ -0,0 +1,39 @@
+package state
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPauses(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	store, err := OpenPauses(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	added := []PauseChange{
+		{Mapping: "a", Paused: true, Changed: changed},
+		{Paused: true, Changed: changed.Add(time.Minute)},
+		{Mapping: "a", Paused: false, Changed: changed.Add(2 * time.Minute)},
+	}
+	for _, change := range added {
+		if err := store.Add(change); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err := OpenPauses(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := reopened.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(changes, added) {
+		t.Errorf("All() = %+v, want %+v", changes, added)
+	}
+}
@@ -0,0 +1,53 @@
+package state
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// shadowFile is the name of the dry run call store within the state directory
+const shadowFile = "dry_run.jsonl"
+
+// ShadowCall records a REST call a dry run mapping would have made, had it not been a dry run
+type ShadowCall struct {
+	Mapping      string    `json:"mapping"`
+	SourceBotID  int       `json:"source_bot_id"`
+	SourceDealID int       `json:"source_deal_id"`
+	Method       string    `json:"method"`
+	URL          string    `json:"url"`
+	Created      time.Time `json:"created"`
+}
+
+// Shadow is the dry run call store.  Each call a dry run mapping would have sent is appended to dry_run.jsonl as a
+// JSON object holding the mapping, the source deal, the method and the URL.
+type Shadow struct {
+	journal *journal
+}
+
+// OpenShadow opens the dry run call store in the given state directory, creating the directory if needed
+func OpenShadow(dir string) (*Shadow, error) {
+	j, err := openJournal(dir, shadowFile, "dry run calls")
+	if err != nil {
+		return nil, err
+	}
+	return &Shadow{journal: j}, nil
+}
+
+// Add records a call
+func (s *Shadow) Add(call ShadowCall) error {
+	return s.journal.append(call)
+}
+
+// All returns every call in the order they were recorded
+func (s *Shadow) All() ([]ShadowCall, error) {
+	var calls []ShadowCall
+	err := s.journal.each(func(data []byte) error {
+		var call ShadowCall
+		if err := json.Unmarshal(data, &call); err != nil {
+			return err
+		}
+		calls = append(calls, call)
+		return nil
+	})
+	return calls, err
+}
@@ -0,0 +1,38 @@
+package state
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestShadow(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	shadow, err := OpenShadow(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls, err := shadow.All(); calls != nil || err != nil {
+		t.Fatalf("All() of an empty store = %v, %v, want nil", calls, err)
+	}
+
+	created := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	added := []ShadowCall{
+		{Mapping: "a", SourceBotID: 1, SourceDealID: 100, Method: "POST", URL: "https://api.3commas.io/public/api/ver1/bots/2/start_new_deal?pair=USDT_BTC", Created: created},
+		{Mapping: "b", SourceBotID: 1, SourceDealID: 100, Method: "POST", URL: "https://api.3commas.io/public/api/ver1/bots/3/start_new_deal?pair=USD_BTC", Created: created},
+	}
+	for _, call := range added {
+		if err := shadow.Add(call); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	calls, err := shadow.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(calls, added) {
+		t.Errorf("All() = %v, want %v", calls, added)
+	}
+}
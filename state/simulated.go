@@ -0,0 +1,75 @@
+package state
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// simulatedFile is the name of the simulated deal store within the state directory
+const simulatedFile = "simulated.jsonl"
+
+// SimulatedDeal is a paper deal opened by a simulated destination, following a source deal.  Amounts are in the
+// quote currency of the pair.
+type SimulatedDeal struct {
+	ID               int        `json:"id"`
+	Mapping          string     `json:"mapping"`
+	SourceBotID      int        `json:"source_bot_id"`
+	SourceDealID     int        `json:"source_deal_id"`
+	Pair             string     `json:"pair"`
+	Status           string     `json:"status"`
+	BoughtVolume     float64    `json:"bought_volume"`
+	Profit           float64    `json:"profit"`
+	ProfitPercentage float64    `json:"profit_percentage"`
+	Opened           time.Time  `json:"opened"`
+	Closed           *time.Time `json:"closed,omitempty"`
+}
+
+// Simulated is the simulated deal store.  Each change to a paper deal is appended to simulated.jsonl as the whole
+// deal, its status, volume and profit included, and the latest line with each deal id wins.
+type Simulated struct {
+	journal *journal
+}
+
+// OpenSimulated opens the simulated deal store in the given state directory, creating the directory if needed
+func OpenSimulated(dir string) (*Simulated, error) {
+	j, err := openJournal(dir, simulatedFile, "simulated deals")
+	if err != nil {
+		return nil, err
+	}
+	return &Simulated{journal: j}, nil
+}
+
+// ReadSimulated opens an existing simulated deal store without creating anything, returning nil if there is none
+func ReadSimulated(dir string) (*Simulated, error) {
+	j, err := readJournal(dir, simulatedFile, "simulated deals")
+	if j == nil || err != nil {
+		return nil, err
+	}
+	return &Simulated{journal: j}, nil
+}
+
+// Save records the current state of a deal
+func (s *Simulated) Save(deal SimulatedDeal) error {
+	return s.journal.append(deal)
+}
+
+// All returns the latest state of every deal, ordered by id
+func (s *Simulated) All() ([]SimulatedDeal, error) {
+	latest := make(map[int]SimulatedDeal)
+	err := s.journal.each(func(data []byte) error {
+		var deal SimulatedDeal
+		if err := json.Unmarshal(data, &deal); err != nil {
+			return err
+		}
+		latest[deal.ID] = deal
+		return nil
+	})
+
+	deals := make([]SimulatedDeal, 0, len(latest))
+	for _, deal := range latest {
+		deals = append(deals, deal)
+	}
+	sort.Slice(deals, func(i, j int) bool { return deals[i].ID < deals[j].ID })
+	return deals, err
+}
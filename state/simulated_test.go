@@ -0,0 +1,45 @@
+package state
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSimulated(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "state")
+	if store, err := ReadSimulated(dir); store != nil || err != nil {
+		t.Fatalf("ReadSimulated() of a missing store = %v, %v, want nil", store, err)
+	}
+
+	store, err := OpenSimulated(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opened := time.Date(2022, 5, 1, 10, 0, 0, 0, time.UTC)
+	closed := opened.Add(time.Hour)
+	saved := []SimulatedDeal{
+		{ID: 2, Mapping: "a", SourceDealID: 101, Pair: "USD_ETH", Status: "active", BoughtVolume: 10, Opened: opened},
+		{ID: 1, Mapping: "a", SourceDealID: 100, Pair: "USD_BTC", Status: "active", BoughtVolume: 10, Opened: opened},
+		{ID: 1, Mapping: "a", SourceDealID: 100, Pair: "USD_BTC", Status: "active", BoughtVolume: 20, Opened: opened},
+		{ID: 1, Mapping: "a", SourceDealID: 100, Pair: "USD_BTC", Status: "completed", BoughtVolume: 20, Profit: 0.4, ProfitPercentage: 2, Opened: opened, Closed: &closed},
+	}
+	for _, deal := range saved {
+		if err := store.Save(deal); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read, err := ReadSimulated(dir)
+	if err != nil || read == nil {
+		t.Fatalf("ReadSimulated() = %v, %v", read, err)
+	}
+	deals, err := read.All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []SimulatedDeal{saved[3], saved[0]}; !reflect.DeepEqual(deals, want) {
+		t.Errorf("All() = %+v, want %+v", deals, want)
+	}
+}